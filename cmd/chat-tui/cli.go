@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/evallife/chat-tui/internal/config"
+	"github.com/evallife/chat-tui/internal/export"
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/types"
+	"github.com/evallife/chat-tui/internal/workspace"
+	"golang.org/x/term"
+)
+
+const usage = `Usage:
+  chat-tui                                   start the chat UI
+  chat-tui export [-format json|jsonl|html] [-o file] [id...]
+                                             export conversations (all outside the trash when no id is given)
+  chat-tui import [-on-conflict skip|duplicate|overwrite] file...
+                                             import our JSON/JSONL exports or ChatGPT's conversations.json
+  chat-tui backup [-o file] [-list]          back up the database, or list backups
+  chat-tui restore file                      replace the database with a backup
+  chat-tui encrypt                           encrypt messages, attachments and indexes with a passphrase
+                                             (titles, tags and prompts stay unencrypted)
+  chat-tui decrypt                           store them unencrypted again
+`
+
+// runCLI runs a subcommand and returns the exit code.
+func runCLI(store storage.Store, cfg types.Config, args []string) int {
+	var err error
+	switch args[0] {
+	case "export":
+		err = runExport(store, cfg, args[1:])
+	case "import":
+		err = runImport(store, cfg, args[1:])
+	case "backup":
+		err = runBackup(store, cfg, args[1:])
+	case "restore":
+		err = runRestore(store, cfg, args[1:])
+	case "encrypt":
+		err = runEncrypt(store, cfg)
+	case "decrypt":
+		err = runDecrypt(store, cfg)
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func runExport(store storage.Store, cfg types.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "", "json, jsonl or html (default: from the file name, else json)")
+	out := fs.String("o", "", "output file (default: stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := unlock(store, cfg); err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = "json"
+		if ext := strings.TrimPrefix(filepath.Ext(*out), "."); ext == "jsonl" || ext == "html" {
+			*format = ext
+		}
+	}
+	write := export.WriteJSON
+	switch *format {
+	case "json":
+	case "jsonl":
+		write = export.WriteJSONL
+	case "html":
+		write = export.WriteHTML
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	var convs []types.Conversation
+	if fs.NArg() == 0 {
+		var err error
+		if convs, err = export.LoadAll(store); err != nil {
+			return err
+		}
+	}
+	for _, id := range fs.Args() {
+		c, err := export.Load(store, id)
+		if err != nil {
+			return fmt.Errorf("conversation %s: %w", id, err)
+		}
+		convs = append(convs, c)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := write(w, convs); err != nil {
+		return err
+	}
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d conversations to %s\n", len(convs), *out)
+	}
+	return nil
+}
+
+func runImport(store storage.Store, cfg types.Config, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	onConflict := fs.String("on-conflict", export.Skip, "what to do when a conversation ID exists: skip, duplicate or overwrite")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no file given")
+	}
+	if err := unlock(store, cfg); err != nil {
+		return err
+	}
+	for _, name := range fs.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		convs, err := export.Read(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		res, err := export.Import(store, convs, *onConflict)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fmt.Printf("%s: %s\n", name, res)
+	}
+	return nil
+}
+
+// backupDir is where backups go unless the config names another directory.
+func backupDir(cfg types.Config) string {
+	if cfg.BackupDir != "" {
+		return cfg.BackupDir
+	}
+	return storage.BackupDir()
+}
+
+func runBackup(store storage.Store, cfg types.Config, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := fs.String("o", "", "backup file (default: a new file in the backup directory)")
+	list := fs.Bool("list", false, "list existing backups instead")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	dir := backupDir(cfg)
+	if *list {
+		files, err := storage.ListBackups(dir)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			fmt.Printf("%s  %8s  %s\n", f.ModTime.Format("2006-01-02 15:04"), workspace.FormatSize(f.Size), f.Path)
+		}
+		return nil
+	}
+	bs, err := backupStore(store)
+	if err != nil {
+		return err
+	}
+	dest := *out
+	if dest == "" {
+		dest, err = bs.BackupTo(dir, storage.ManualBackupPrefix)
+	} else {
+		err = bs.Backup(dest)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up %s to %s\n", bs.Path(), dest)
+	return nil
+}
+
+func runRestore(store storage.Store, cfg types.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: chat-tui restore file")
+	}
+	bs, err := backupStore(store)
+	if err != nil {
+		return err
+	}
+	if err := bs.Restore(args[0], backupDir(cfg)); err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s from %s; the previous database was backed up to %s\n", bs.Path(), args[0], backupDir(cfg))
+	return nil
+}
+
+// readPassphrase gets the passphrase from the configured key command, or else
+// asks for it on the terminal.
+func readPassphrase(cfg types.Config, prompt string) (string, error) {
+	if cfg.KeyCommand != "" {
+		return config.RunKeyCommand(cfg.KeyCommand)
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("no terminal to ask for the passphrase; set key_command in the config")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(b), err
+}
+
+// backupStore returns store as a BackupStore; the files storage has no database to back up.
+func backupStore(store storage.Store) (storage.BackupStore, error) {
+	bs, ok := store.(storage.BackupStore)
+	if !ok {
+		return nil, errors.New("backups need the SQLite storage; keep the files storage directory in git instead")
+	}
+	return bs, nil
+}
+
+func encryptedStore(store storage.Store) (storage.EncryptedStore, error) {
+	enc, ok := store.(storage.EncryptedStore)
+	if !ok {
+		return nil, errors.New("encryption needs the SQLite storage")
+	}
+	return enc, nil
+}
+
+// unlock makes the content of an encrypted database readable.
+func unlock(store storage.Store, cfg types.Config) error {
+	if !storage.Locked(store) {
+		return nil
+	}
+	passphrase, err := readPassphrase(cfg, "Passphrase: ")
+	if err != nil {
+		return err
+	}
+	return store.(storage.EncryptedStore).Unlock(passphrase)
+}
+
+func runEncrypt(store storage.Store, cfg types.Config) error {
+	enc, err := encryptedStore(store)
+	if err != nil {
+		return err
+	}
+	if enc.Encrypted() {
+		return errors.New("the database is already encrypted")
+	}
+	passphrase, err := readPassphrase(cfg, "New passphrase: ")
+	if err != nil {
+		return err
+	}
+	if cfg.KeyCommand == "" {
+		again, err := readPassphrase(cfg, "Repeat passphrase: ")
+		if err != nil {
+			return err
+		}
+		if again != passphrase {
+			return errors.New("the passphrases do not match")
+		}
+	}
+	err = enc.EnableEncryption(passphrase)
+	if err != nil && !errors.Is(err, storage.ErrWALInUse) {
+		return err
+	}
+	fmt.Printf("Encrypted messages, attachments and indexes. Titles, tags, system prompts and the prompt library stay unencrypted. Backups made before now are not encrypted; delete them from %s if they hold secrets.\n", backupDir(cfg))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v.\n", err)
+	}
+	return nil
+}
+
+func runDecrypt(store storage.Store, cfg types.Config) error {
+	enc, err := encryptedStore(store)
+	if err != nil {
+		return err
+	}
+	if !enc.Encrypted() {
+		return errors.New("the database is not encrypted")
+	}
+	if err := unlock(store, cfg); err != nil {
+		return err
+	}
+	if err := enc.DisableEncryption(); err != nil {
+		return err
+	}
+	fmt.Println("Decrypted the database.")
+	return nil
+}
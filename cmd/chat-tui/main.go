@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/evallife/chat-tui/internal/config"
 	"github.com/evallife/chat-tui/internal/storage"
@@ -11,14 +12,18 @@ import (
 )
 
 func main() {
-	store, err := storage.NewManager()
+	cfg, cfgErr := config.LoadConfig()
+	store, err := storage.Open(cfg)
 	if err != nil {
 		fmt.Printf("Error initializing storage: %v\n", err)
 		os.Exit(1)
 	}
 
-	cfg, err := config.LoadConfig()
-	if err != nil {
+	if len(os.Args) > 1 {
+		os.Exit(runCLI(store, cfg, os.Args[1:]))
+	}
+
+	if err := cfgErr; err != nil {
 		if os.IsNotExist(err) {
 			defaultCfg := types.Config{
 				BaseURL: "https://api.openai.com/v1",
@@ -31,6 +36,39 @@ func main() {
 		}
 	}
 
+	// Conversations stay in the trash for the retention period; negative keeps them forever.
+	days := cfg.TrashRetentionDays
+	if days == 0 {
+		days = types.DefaultTrashRetentionDays
+	}
+	if days > 0 {
+		if _, err := store.PurgeTrash(time.Duration(days) * 24 * time.Hour); err != nil {
+			fmt.Printf("Error emptying trash: %v\n", err)
+		}
+	}
+
+	keep := cfg.BackupKeep
+	if keep == 0 {
+		keep = types.DefaultBackupKeep
+	}
+	if bs, ok := store.(storage.BackupStore); ok && keep > 0 {
+		if _, err := bs.AutoBackup(backupDir(cfg), keep); err != nil {
+			fmt.Printf("Error backing up database: %v\n", err)
+		}
+	}
+
+	// Without a key command the UI asks for the passphrase.
+	if storage.Locked(store) && cfg.KeyCommand != "" {
+		passphrase, err := config.RunKeyCommand(cfg.KeyCommand)
+		if err == nil {
+			err = store.(storage.EncryptedStore).Unlock(passphrase)
+		}
+		if err != nil {
+			fmt.Printf("Error unlocking database: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	app := ui.NewTViewUI(cfg, store)
 	if err := app.Run(); err != nil {
 		fmt.Printf("Error running program: %v\n", err)
@@ -2,6 +2,9 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"github.com/sashabaranov/go-openai"
 	"github.com/evallife/chat-tui/internal/types"
 )
@@ -30,3 +33,73 @@ func (c *Client) StreamChat(ctx context.Context, messages []openai.ChatCompletio
 	}
 	return c.openaiClient.CreateChatCompletionStream(ctx, req)
 }
+
+// StreamChatWithUsage is StreamChat asking for the token usage, which arrives
+// in a last chunk without choices. Servers that reject stream_options with a
+// 400 are asked again without it, so the stream then carries no usage.
+func (c *Client) StreamChatWithUsage(ctx context.Context, messages []openai.ChatCompletionMessage) (*openai.ChatCompletionStream, error) {
+	req := openai.ChatCompletionRequest{
+		Model:         c.config.Model,
+		Messages:      messages,
+		Stream:        true,
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+	}
+	stream, err := c.openaiClient.CreateChatCompletionStream(ctx, req)
+	if badRequest(err) {
+		return c.StreamChat(ctx, messages)
+	}
+	return stream, err
+}
+
+// badRequest reports whether err is the server answering 400.
+func badRequest(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusBadRequest
+	}
+	var reqErr *openai.RequestError
+	return errors.As(err, &reqErr) && reqErr.HTTPStatusCode == http.StatusBadRequest
+}
+
+// Chat sends a non-streaming request and returns the text of the first choice.
+func (c *Client) Chat(ctx context.Context, messages []openai.ChatCompletionMessage) (string, error) {
+	return c.ChatWithModel(ctx, c.config.Model, messages)
+}
+
+// ChatWithModel is Chat against a model other than the configured one.
+func (c *Client) ChatWithModel(ctx context.Context, model string, messages []openai.ChatCompletionMessage) (string, error) {
+	req := openai.ChatCompletionRequest{
+		Model:    model,
+		Messages: messages,
+	}
+	resp, err := c.openaiClient.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("empty response")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// Embed returns embeddings for texts from the /embeddings endpoint.
+func (c *Client) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	resp, err := c.openaiClient.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input: texts,
+		Model: openai.EmbeddingModel(model),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("got %d embeddings for %d inputs", len(resp.Data), len(texts))
+	}
+	out := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(out) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		out[d.Index] = d.Embedding
+	}
+	return out, nil
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+func GetStatePath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".xftui-state.json")
+}
+
+// LoadState reads the state saved by the last run; a missing file is an empty state.
+func LoadState() (types.State, error) {
+	var state types.State
+	data, err := os.ReadFile(GetStatePath())
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+func SaveState(state types.State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(GetStatePath(), data, 0600)
+}
@@ -0,0 +1,131 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// chatGPTConversation is one entry of ChatGPT's conversations.json. Messages
+// form a tree in Mapping; the branch shown in ChatGPT ends at CurrentNode.
+type chatGPTConversation struct {
+	ID             string                 `json:"id"`
+	ConversationID string                 `json:"conversation_id"`
+	Title          string                 `json:"title"`
+	CreateTime     float64                `json:"create_time"`
+	UpdateTime     float64                `json:"update_time"`
+	CurrentNode    string                 `json:"current_node"`
+	Model          string                 `json:"default_model_slug"`
+	Mapping        map[string]chatGPTNode `json:"mapping"`
+}
+
+type chatGPTNode struct {
+	Parent  string `json:"parent"`
+	Message *struct {
+		Author struct {
+			Role string `json:"role"`
+		} `json:"author"`
+		CreateTime float64 `json:"create_time"`
+		Content    struct {
+			ContentType string            `json:"content_type"`
+			Parts       []json.RawMessage `json:"parts"`
+			Text        string            `json:"text"` // code and tool output
+		} `json:"content"`
+		Metadata struct {
+			Hidden bool `json:"is_visually_hidden_from_conversation"`
+		} `json:"metadata"`
+	} `json:"message"`
+}
+
+func readChatGPT(data []byte) ([]types.Conversation, error) {
+	var in []chatGPTConversation
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, fmt.Errorf("reading ChatGPT export: %w", err)
+	}
+	convs := make([]types.Conversation, 0, len(in))
+	for _, g := range in {
+		c := types.Conversation{
+			ID:        g.ConversationID,
+			Title:     g.Title,
+			Model:     g.Model,
+			CreatedAt: unixTime(g.CreateTime),
+			UpdatedAt: unixTime(g.UpdateTime),
+		}
+		if c.ID == "" {
+			c.ID = g.ID
+		}
+		if c.Title == "" {
+			c.Title = "ChatGPT conversation"
+		}
+		for _, node := range g.branch() {
+			m := node.Message
+			if m == nil || m.Metadata.Hidden {
+				continue
+			}
+			var parts []string
+			for _, raw := range m.Content.Parts {
+				// Parts are strings or objects such as image references, which are dropped.
+				var s string
+				if json.Unmarshal(raw, &s) == nil && s != "" {
+					parts = append(parts, s)
+				}
+			}
+			text := strings.Join(parts, "\n\n")
+			if text == "" {
+				text = m.Content.Text
+			}
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			switch m.Author.Role {
+			case openai.ChatMessageRoleSystem:
+				if c.SystemPrompt == "" && len(c.Messages) == 0 {
+					c.SystemPrompt = text
+					continue
+				}
+			case openai.ChatMessageRoleUser, openai.ChatMessageRoleAssistant:
+			default:
+				continue // tool calls and their output
+			}
+			created := unixTime(m.CreateTime)
+			if m.CreateTime == 0 {
+				created = c.CreatedAt
+			}
+			c.Messages = append(c.Messages, types.Message{Role: m.Author.Role, Content: text, CreatedAt: created})
+		}
+		convs = append(convs, c)
+	}
+	return convs, nil
+}
+
+// branch returns the nodes from the root to the current node.
+func (g chatGPTConversation) branch() []chatGPTNode {
+	var nodes []chatGPTNode
+	seen := make(map[string]bool)
+	for id := g.CurrentNode; id != "" && !seen[id]; {
+		seen[id] = true
+		node, ok := g.Mapping[id]
+		if !ok {
+			break
+		}
+		nodes = append(nodes, node)
+		id = node.Parent
+	}
+	slices.Reverse(nodes)
+	return nodes
+}
+
+func unixTime(sec float64) time.Time {
+	if sec <= 0 {
+		return time.Time{}
+	}
+	whole, frac := math.Modf(sec)
+	return time.Unix(int64(whole), int64(frac*1e9)).UTC()
+}
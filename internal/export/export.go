@@ -0,0 +1,186 @@
+// Package export writes conversations to portable files and reads them back,
+// including ChatGPT's conversations.json.
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+const (
+	// Format identifies our files; Version is bumped on incompatible changes.
+	Format  = "chat-tui"
+	Version = 1
+)
+
+// Header starts every export. In a JSON file it also holds the conversations;
+// a JSONL file has it on the first line and one conversation per line after it.
+type Header struct {
+	Format        string               `json:"format"`
+	Version       int                  `json:"version"`
+	ExportedAt    time.Time            `json:"exported_at"`
+	Conversations []types.Conversation `json:"conversations,omitempty"`
+}
+
+// Conflict policies for imported conversations whose ID already exists.
+const (
+	Skip      = "skip"      // keep the existing conversation
+	Duplicate = "duplicate" // import under a new ID
+	Overwrite = "overwrite" // replace the existing conversation
+)
+
+// Load returns a conversation with all its messages and attachments.
+func Load(store storage.Store, id string) (types.Conversation, error) {
+	c, err := store.GetConversation(id)
+	if err != nil {
+		return c, err
+	}
+	c.Messages, err = store.ListMessages(id)
+	return c, err
+}
+
+// LoadAll returns every conversation that is not in the trash. It is not a
+// backup: the trash, the prompt library and the indexes are left out.
+func LoadAll(store storage.Store) ([]types.Conversation, error) {
+	return LoadWhere(store, func(storage.ConvSummary) bool { return true })
+}
+
+// LoadWhere returns the conversations outside the trash that match keep.
+func LoadWhere(store storage.Store, keep func(storage.ConvSummary) bool) ([]types.Conversation, error) {
+	summaries, err := store.ListConversations()
+	if err != nil {
+		return nil, err
+	}
+	var convs []types.Conversation
+	for _, s := range summaries {
+		if !keep(s) {
+			continue
+		}
+		c, err := Load(store, s.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.Title, err)
+		}
+		convs = append(convs, c)
+	}
+	return convs, nil
+}
+
+// WriteJSON writes convs as one indented JSON document.
+func WriteJSON(w io.Writer, convs []types.Conversation) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(Header{Format: Format, Version: Version, ExportedAt: time.Now().UTC(), Conversations: convs})
+}
+
+// WriteJSONL writes a header line followed by one conversation per line.
+func WriteJSONL(w io.Writer, convs []types.Conversation) error {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(Header{Format: Format, Version: Version, ExportedAt: time.Now().UTC()}); err != nil {
+		return err
+	}
+	for _, c := range convs {
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read parses any file written by WriteJSON or WriteJSONL, or a ChatGPT
+// conversations.json export.
+func Read(r io.Reader) ([]types.Conversation, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty file")
+	}
+	if data[0] == '[' {
+		return readChatGPT(data)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var h Header
+	if err := dec.Decode(&h); err != nil {
+		return nil, err
+	}
+	if h.Format != Format {
+		return nil, fmt.Errorf("not a %s export", Format)
+	}
+	if h.Version > Version {
+		return nil, fmt.Errorf("export version %d is newer than supported version %d", h.Version, Version)
+	}
+	convs := h.Conversations
+	for {
+		var c types.Conversation
+		if err := dec.Decode(&c); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("conversation %d: %w", len(convs)+1, err)
+		}
+		convs = append(convs, c)
+	}
+	return convs, nil
+}
+
+// Result counts what Import did.
+type Result struct {
+	Imported, Skipped, Replaced int
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%d imported, %d replaced, %d skipped", r.Imported, r.Replaced, r.Skipped)
+}
+
+// Import stores convs, resolving ID clashes with onConflict (Skip, Duplicate
+// or Overwrite). Conversations without an ID get a new one.
+func Import(store storage.Store, convs []types.Conversation, onConflict string) (Result, error) {
+	var res Result
+	for _, c := range convs {
+		exists := false
+		if c.ID == "" {
+			c.ID = uuid.New().String()
+		} else {
+			var err error
+			if exists, err = store.HasConversation(c.ID); err != nil {
+				return res, err
+			}
+		}
+		if exists {
+			switch onConflict {
+			case Skip:
+				res.Skipped++
+				continue
+			case Duplicate:
+				c.ID = uuid.New().String()
+				exists = false
+			case Overwrite:
+			default:
+				return res, fmt.Errorf("unknown conflict policy %q", onConflict)
+			}
+		}
+		importConv := store.ImportConversation
+		if exists {
+			importConv = store.ReplaceConversation
+		}
+		if err := importConv(c); err != nil {
+			return res, fmt.Errorf("%s: %w", c.Title, err)
+		}
+		if exists {
+			res.Replaced++
+		} else {
+			res.Imported++
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,180 @@
+package export
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// stores returns a new store of each kind.
+func stores(t *testing.T) map[string]storage.Store {
+	t.Helper()
+	m, err := storage.OpenManager(filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]storage.Store{"sqlite": m, "files": f}
+}
+
+// fixture returns a conversation using everything an export carries.
+func fixture() types.Conversation {
+	created := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	return types.Conversation{
+		ID:           "3f1c2a9e-0000-4000-8000-000000000001",
+		Title:        "Retry loop",
+		Model:        "gpt-4o",
+		SystemPrompt: "You are terse.",
+		Folder:       "work",
+		Tags:         []string{"go", "net"},
+		Pinned:       true,
+		CreatedAt:    created,
+		UpdatedAt:    created.Add(2 * time.Minute),
+		Messages: []types.Message{
+			{Role: "user", Content: "How do I retry?", CreatedAt: created, Attachments: []types.Attachment{
+				{Kind: types.AttachmentFile, Name: "dial.go", Content: "package dial\n", Size: 13},
+				{Kind: types.AttachmentImage, Name: "trace.png", MIME: "image/png", Data: []byte("\x89PNG\r\n"), Size: 6, Width: 2, Height: 1},
+			}},
+			{Role: "assistant", Content: "Wrap the call in a loop.", Pinned: true, CreatedAt: created.Add(time.Minute)},
+			{Role: "system", Content: "Summary of earlier conversation:\n\nRetries.", CreatedAt: created.Add(2 * time.Minute)},
+		},
+	}
+}
+
+// comparable drops what a store assigns itself, the IDs of messages and
+// attachments.
+func comparable(c types.Conversation) types.Conversation {
+	msgs := make([]types.Message, len(c.Messages))
+	for i, m := range c.Messages {
+		m.ID = 0
+		atts := make([]types.Attachment, len(m.Attachments))
+		for j, a := range m.Attachments {
+			a.ID, a.MessageID = 0, 0
+			atts[j] = a
+		}
+		if len(atts) == 0 {
+			atts = nil
+		}
+		m.Attachments = atts
+		msgs[i] = m
+	}
+	c.Messages = msgs
+	return c
+}
+
+func TestRoundTrip(t *testing.T) {
+	for name, store := range stores(t) {
+		want := fixture()
+		if _, err := Import(store, []types.Conversation{want}, Skip); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		convs, err := LoadAll(store)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for format, write := range map[string]func(*bytes.Buffer, []types.Conversation) error{
+			"json":  func(b *bytes.Buffer, c []types.Conversation) error { return WriteJSON(b, c) },
+			"jsonl": func(b *bytes.Buffer, c []types.Conversation) error { return WriteJSONL(b, c) },
+		} {
+			var buf bytes.Buffer
+			if err := write(&buf, convs); err != nil {
+				t.Fatalf("%s %s: %v", name, format, err)
+			}
+			read, err := Read(&buf)
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, format, err)
+			}
+			into := stores(t)[name]
+			if _, err := Import(into, read, Skip); err != nil {
+				t.Fatalf("%s %s: %v", name, format, err)
+			}
+			got, err := Load(into, want.ID)
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, format, err)
+			}
+			if !reflect.DeepEqual(comparable(got), comparable(want)) {
+				t.Errorf("%s %s: got\n%+v\nwant\n%+v", name, format, comparable(got), comparable(want))
+			}
+		}
+	}
+}
+
+func TestImportConflicts(t *testing.T) {
+	for name, store := range stores(t) {
+		original := fixture()
+		if _, err := Import(store, []types.Conversation{original}, Skip); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		changed := fixture()
+		changed.Title = "Changed"
+		changed.Messages = changed.Messages[:1]
+
+		res, err := Import(store, []types.Conversation{changed}, Skip)
+		if err != nil || res != (Result{Skipped: 1}) {
+			t.Errorf("%s skip: %v, %v", name, res, err)
+		}
+		if c, _ := Load(store, original.ID); c.Title != "Retry loop" || len(c.Messages) != 3 {
+			t.Errorf("%s skip changed the conversation to %q with %d messages", name, c.Title, len(c.Messages))
+		}
+
+		res, err = Import(store, []types.Conversation{changed}, Duplicate)
+		if err != nil || res != (Result{Imported: 1}) {
+			t.Errorf("%s duplicate: %v, %v", name, res, err)
+		}
+		if all, _ := LoadAll(store); len(all) != 2 {
+			t.Errorf("%s duplicate: %d conversations, want 2", name, len(all))
+		}
+
+		res, err = Import(store, []types.Conversation{changed}, Overwrite)
+		if err != nil || res != (Result{Replaced: 1}) {
+			t.Errorf("%s overwrite: %v, %v", name, res, err)
+		}
+		if c, _ := Load(store, original.ID); c.Title != "Changed" || len(c.Messages) != 1 {
+			t.Errorf("%s overwrite left %q with %d messages", name, c.Title, len(c.Messages))
+		}
+
+		if _, err := Import(store, []types.Conversation{changed}, "merge"); err == nil {
+			t.Errorf("%s: unknown policy accepted", name)
+		}
+	}
+}
+
+// TestReadChatGPT reads a conversations.json whose answer was regenerated:
+// only the branch ending at current_node is kept.
+func TestReadChatGPT(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "conversations.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	convs, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(convs) != 1 {
+		t.Fatalf("read %d conversations, want 1", len(convs))
+	}
+	c := convs[0]
+	if c.ID != "c0ffee00-0000-4000-8000-000000000001" || c.Title != "Branching" || c.Model != "gpt-4o" || c.SystemPrompt != "Be brief." {
+		t.Errorf("conversation = %+v", c)
+	}
+	if want := time.Unix(1700000000, 0).UTC(); !c.CreatedAt.Equal(want) {
+		t.Errorf("created %v, want %v", c.CreatedAt, want)
+	}
+	var got []string
+	for _, m := range c.Messages {
+		got = append(got, m.Role+": "+m.Content)
+	}
+	want := []string{"user: Hi", "assistant: Second try", "user: Thanks"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,220 @@
+package export
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+
+	"github.com/evallife/chat-tui/internal/types"
+	"github.com/evallife/chat-tui/internal/workspace"
+)
+
+const (
+	// Messages longer than this are collapsed behind their first line.
+	collapseLines = 40
+	collapseBytes = 4000
+	codeStyle     = "github"
+)
+
+// codeRenderer highlights code blocks with chroma, using CSS classes so the
+// style sheet is written once per file.
+type codeRenderer struct {
+	formatter *chromahtml.Formatter
+	style     *chroma.Style
+}
+
+func (r *codeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.renderCode)
+	reg.Register(ast.KindCodeBlock, r.renderCode)
+}
+
+func (r *codeRenderer) renderCode(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	var code strings.Builder
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		code.Write(seg.Value(source))
+	}
+	var lexer chroma.Lexer
+	if fenced, ok := node.(*ast.FencedCodeBlock); ok {
+		lexer = lexers.Get(string(fenced.Language(source)))
+	}
+	if lexer == nil {
+		lexer = lexers.Analyse(code.String())
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	it, err := chroma.Coalesce(lexer).Tokenise(nil, code.String())
+	if err == nil {
+		err = r.formatter.Format(w, r.style, it)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "<pre>%s</pre>", template.HTMLEscapeString(code.String()))
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+type htmlExporter struct {
+	md  goldmark.Markdown
+	css string
+}
+
+func newHTMLExporter() *htmlExporter {
+	code := &codeRenderer{formatter: chromahtml.New(chromahtml.WithClasses(true)), style: styles.Get(codeStyle)}
+	var css bytes.Buffer
+	_ = code.formatter.WriteCSS(&css, code.style)
+	return &htmlExporter{
+		// Raw HTML in messages is left out, as goldmark does by default.
+		md: goldmark.New(
+			goldmark.WithExtensions(extension.GFM),
+			goldmark.WithRendererOptions(renderer.WithNodeRenderers(util.Prioritized(code, 100))),
+		),
+		css: css.String(),
+	}
+}
+
+func (e *htmlExporter) markdown(s string) template.HTML {
+	var buf bytes.Buffer
+	if err := e.md.Convert([]byte(s), &buf); err != nil {
+		return template.HTML("<pre>" + template.HTMLEscapeString(s) + "</pre>")
+	}
+	return template.HTML(buf.String())
+}
+
+// WriteHTML writes convs as a single HTML page with inline styles that can be
+// opened without network access.
+func WriteHTML(w io.Writer, convs []types.Conversation) error {
+	e := newHTMLExporter()
+	title := "Chat export"
+	if len(convs) == 1 {
+		title = convs[0].Title
+	}
+	page := template.Must(htmlPage.Clone()).Funcs(template.FuncMap{"md": e.markdown})
+	return page.Execute(w, map[string]any{
+		"Title":         title,
+		"CSS":           template.CSS(pageCSS + e.css),
+		"Conversations": convs,
+		"ExportedAt":    time.Now(),
+	})
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// isLong reports whether a message is collapsed.
+func isLong(s string) bool {
+	return len(s) > collapseBytes || strings.Count(s, "\n") >= collapseLines
+}
+
+// firstLine is the summary shown for a collapsed message.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	if r := []rune(line); len(r) > 100 {
+		line = string(r[:100]) + "…"
+	}
+	return line
+}
+
+func imageURL(a types.Attachment) template.URL {
+	return template.URL("data:" + a.MIME + ";base64," + base64.StdEncoding.EncodeToString(a.Data))
+}
+
+var htmlPage = template.Must(template.New("page").Funcs(template.FuncMap{
+	"time":      formatTime,
+	"isLong":    isLong,
+	"firstLine": firstLine,
+	"lines":     func(s string) int { return strings.Count(s, "\n") + 1 },
+	"size":      workspace.FormatSize,
+	"imageURL":  imageURL,
+	"md":        func(string) template.HTML { return "" }, // set by WriteHTML
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>{{.CSS}}</style>
+</head>
+<body>
+{{range .Conversations}}
+<article class="conversation">
+<header>
+<h1>{{if .Pinned}}★ {{end}}{{.Title}}</h1>
+<p class="meta">
+{{if .Model}}<span>Model <b>{{.Model}}</b></span>{{end}}
+{{with time .CreatedAt}}<span>Created {{.}}</span>{{end}}
+{{with time .UpdatedAt}}<span>Last active {{.}}</span>{{end}}
+{{if .Folder}}<span>Folder {{.Folder}}/</span>{{end}}
+{{range .Tags}}<span class="tag">#{{.}}</span>{{end}}
+</p>
+{{if .SystemPrompt}}<details class="system-prompt"><summary>System prompt</summary>{{md .SystemPrompt}}</details>{{end}}
+</header>
+{{range .Messages}}
+<section class="message {{.Role}}{{if .Summarized}} summarized{{end}}">
+<div class="head"><span class="role">{{.Role}}</span>{{if .Pinned}} <span class="badge">pinned</span>{{end}}{{if .Summarized}} <span class="badge">summarized</span>{{end}}<time>{{time .CreatedAt}}</time></div>
+{{if isLong .Content}}<details><summary>{{firstLine .Content}} <i>({{lines .Content}} lines)</i></summary><div class="body">{{md .Content}}</div></details>
+{{else}}<div class="body">{{md .Content}}</div>{{end}}
+{{range .Attachments}}
+{{if eq .Kind "image"}}<figure class="attachment"><img src="{{imageURL .}}" alt="{{.Name}}"{{if .Width}} width="{{.Width}}"{{end}}><figcaption>{{.Name}} {{.Width}}×{{.Height}}</figcaption></figure>
+{{else}}<details class="attachment"><summary>{{if eq .Kind "command"}}$ {{end}}{{.Name}} <i>{{.Kind}}, {{size .Size}}</i></summary><pre>{{.Content}}</pre></details>{{end}}
+{{end}}
+</section>
+{{end}}
+</article>
+{{end}}
+<footer>Exported {{time .ExportedAt}} from chat-tui</footer>
+</body>
+</html>
+`))
+
+const pageCSS = `
+body { margin: 0 auto; max-width: 52rem; padding: 1.5rem; font: 15px/1.55 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #1f2328; background: #f6f8fa; }
+h1 { font-size: 1.5rem; margin: 0 0 .3rem; }
+.conversation { margin-bottom: 3rem; }
+.meta { color: #59636e; font-size: .85rem; margin: 0 0 1rem; }
+.meta span { margin-right: 1rem; }
+.tag { color: #0969da; }
+.message { background: #fff; border: 1px solid #d1d9e0; border-left: 4px solid #8c959f; border-radius: 6px; padding: .6rem 1rem; margin: 0 0 1rem; overflow-wrap: anywhere; }
+.message.user { border-left-color: #8250df; }
+.message.assistant { border-left-color: #1a7f37; }
+.message.system { border-left-color: #9a6700; background: #fff8c5; }
+.message.summarized { opacity: .6; }
+.head { display: flex; gap: .5rem; align-items: baseline; font-size: .8rem; color: #59636e; }
+.role { font-weight: 600; text-transform: uppercase; letter-spacing: .04em; }
+.message.user .role { color: #8250df; }
+.message.assistant .role { color: #1a7f37; }
+.head time { margin-left: auto; }
+.badge { border: 1px solid #d1d9e0; border-radius: 1em; padding: 0 .5em; }
+details > summary { cursor: pointer; color: #59636e; }
+pre { overflow-x: auto; padding: .7rem; border-radius: 6px; background: #f6f8fa; font: 13px/1.45 ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; }
+code { font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; font-size: 90%; }
+:not(pre) > code { background: #eff1f3; padding: .1em .3em; border-radius: 4px; }
+table { border-collapse: collapse; } th, td { border: 1px solid #d1d9e0; padding: .3rem .6rem; }
+blockquote { margin: 0; padding-left: 1rem; border-left: 3px solid #d1d9e0; color: #59636e; }
+.attachment { margin: .5rem 0; font-size: .9rem; }
+.attachment img { max-width: 100%; height: auto; border-radius: 4px; }
+figcaption { color: #59636e; font-size: .8rem; }
+footer { color: #59636e; font-size: .8rem; text-align: center; }
+`
@@ -0,0 +1,49 @@
+package export
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+func TestWriteHTML(t *testing.T) {
+	evil := "<script>alert(1)</script>"
+	c := fixture()
+	c.Title = "Title " + evil
+	c.Tags = append(c.Tags, evil)
+	c.SystemPrompt = "Prompt " + evil
+	c.Messages = append(c.Messages,
+		types.Message{Role: "user", Content: "Plain " + evil + "\n\n<img src=x onerror=alert(2)>"},
+		types.Message{Role: "assistant", Content: "```go\nfunc main() {}\n```", Attachments: []types.Attachment{
+			{Kind: types.AttachmentCommand, Name: "echo " + evil, Content: evil},
+		}},
+	)
+	var sb strings.Builder
+	if err := WriteHTML(&sb, []types.Conversation{c}); err != nil {
+		t.Fatal(err)
+	}
+	page := sb.String()
+
+	if strings.Contains(page, "<script") || strings.Contains(page, "onerror") {
+		t.Error("markup from the conversation got through unescaped")
+	}
+	if !strings.Contains(page, "&lt;script&gt;") {
+		t.Error("escaped text missing; was it dropped?")
+	}
+	if !strings.Contains(page, `<pre class="chroma">`) || !regexp.MustCompile(`<span class="kd">func</span>`).MatchString(page) {
+		t.Error("code block not highlighted by chroma")
+	}
+	if !strings.Contains(page, ".chroma") {
+		t.Error("chroma style sheet missing")
+	}
+	if !strings.Contains(page, `src="data:image/png;base64,`) {
+		t.Error("image not inlined")
+	}
+	// Everything the page needs is in it.
+	external := regexp.MustCompile(`(?i)<link|<script|@import|(src|href)\s*=\s*"(https?:)?//|url\(\s*['"]?(https?:)?//`)
+	if m := external.FindString(page); m != "" {
+		t.Errorf("page loads an external asset: %q", m)
+	}
+}
@@ -0,0 +1,194 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// Options choose what an export contains besides the messages themselves.
+type Options struct {
+	SystemPrompt bool
+	Metadata     bool // model, folder, tags, timestamps and message flags
+	Attachments  bool
+}
+
+// Full keeps everything a conversation has, as re-importing needs.
+var Full = Options{SystemPrompt: true, Metadata: true, Attachments: true}
+
+// Filter returns copies of convs without what opts leaves out.
+func Filter(convs []types.Conversation, opts Options) []types.Conversation {
+	out := make([]types.Conversation, len(convs))
+	for i, c := range convs {
+		if !opts.SystemPrompt {
+			c.SystemPrompt = ""
+		}
+		if !opts.Metadata {
+			c.Model, c.Collection, c.Folder, c.Tags, c.Pinned = "", "", "", nil, false
+			c.CreatedAt, c.UpdatedAt = time.Time{}, time.Time{}
+		}
+		msgs := make([]types.Message, len(c.Messages))
+		for j, m := range c.Messages {
+			if !opts.Metadata {
+				m.Pinned, m.Summarized, m.CreatedAt = false, false, time.Time{}
+			}
+			if !opts.Attachments {
+				m.Attachments = nil
+			}
+			msgs[j] = m
+		}
+		c.Messages = msgs
+		out[i] = c
+	}
+	return out
+}
+
+// fenced wraps content in a code fence long enough not to clash with fences inside it.
+func fenced(lang, content string) string {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	return fmt.Sprintf("%s%s\n%s\n%s", fence, lang, strings.TrimRight(content, "\n"), fence)
+}
+
+// attachmentMarkdown shows an attachment below its message.
+func attachmentMarkdown(a types.Attachment) string {
+	switch a.Kind {
+	case types.AttachmentImage:
+		return fmt.Sprintf("*Image: %s (%d×%d)*", a.Name, a.Width, a.Height)
+	case types.AttachmentCommand:
+		return fmt.Sprintf("**$ %s**\n\n%s", a.Name, fenced("", a.Content))
+	case types.AttachmentFile:
+		base, _, _ := strings.Cut(path.Base(a.Name), ":")
+		return fmt.Sprintf("**Attachment: %s**\n\n%s", a.Name, fenced(strings.TrimPrefix(path.Ext(base), "."), a.Content))
+	}
+	return fmt.Sprintf("**Attachment: %s**\n\n%s", a.Name, a.Content)
+}
+
+func roleName(role string) string {
+	if role == "" {
+		return ""
+	}
+	return strings.ToUpper(role[:1]) + role[1:]
+}
+
+// WriteMarkdown writes a full transcript: a heading per conversation with its
+// metadata, then each message under a heading naming its role.
+func WriteMarkdown(w io.Writer, convs []types.Conversation) error {
+	bw := bufio.NewWriter(w)
+	for i, c := range convs {
+		if i > 0 {
+			bw.WriteString("\n---\n\n")
+		}
+		fmt.Fprintf(bw, "# %s\n\n", c.Title)
+		var meta []string
+		if c.Model != "" {
+			meta = append(meta, "- Model: "+c.Model)
+		}
+		if t := formatTime(c.CreatedAt); t != "" {
+			meta = append(meta, "- Created: "+t)
+		}
+		if t := formatTime(c.UpdatedAt); t != "" {
+			meta = append(meta, "- Last active: "+t)
+		}
+		if c.Folder != "" {
+			meta = append(meta, "- Folder: "+c.Folder)
+		}
+		if len(c.Tags) > 0 {
+			meta = append(meta, "- Tags: #"+strings.Join(c.Tags, " #"))
+		}
+		if len(meta) > 0 {
+			bw.WriteString(strings.Join(meta, "\n") + "\n\n")
+		}
+		if c.SystemPrompt != "" {
+			fmt.Fprintf(bw, "> **System prompt:** %s\n\n", strings.ReplaceAll(c.SystemPrompt, "\n", "\n> "))
+		}
+		for _, m := range c.Messages {
+			fmt.Fprintf(bw, "## %s", roleName(m.Role))
+			if t := formatTime(m.CreatedAt); t != "" {
+				fmt.Fprintf(bw, " · %s", t)
+			}
+			if m.Pinned {
+				bw.WriteString(" (pinned)")
+			}
+			if m.Summarized {
+				bw.WriteString(" (summarized)")
+			}
+			fmt.Fprintf(bw, "\n\n%s\n\n", strings.TrimSpace(m.Content))
+			for _, a := range m.Attachments {
+				fmt.Fprintf(bw, "%s\n\n", attachmentMarkdown(a))
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteQA writes the compact "## Q: ... ---" style, user questions as Q and
+// assistant answers as A.
+func WriteQA(w io.Writer, convs []types.Conversation) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range convs {
+		if len(convs) > 1 {
+			fmt.Fprintf(bw, "# %s\n\n", c.Title)
+		}
+		if c.SystemPrompt != "" {
+			fmt.Fprintf(bw, "> System Prompt: %s\n\n", c.SystemPrompt)
+		}
+		for _, m := range c.Messages {
+			label := strings.ToUpper(m.Role)
+			switch m.Role {
+			case openai.ChatMessageRoleUser:
+				label = "Q"
+			case openai.ChatMessageRoleAssistant:
+				label = "A"
+			}
+			content := m.Content
+			for _, a := range m.Attachments {
+				content += "\n\n" + attachmentMarkdown(a)
+			}
+			fmt.Fprintf(bw, "## %s: %s\n\n---\n\n", label, content)
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteText writes plain text without markup, for pasting into mail or tickets.
+func WriteText(w io.Writer, convs []types.Conversation) error {
+	bw := bufio.NewWriter(w)
+	for i, c := range convs {
+		if i > 0 {
+			bw.WriteString("\n" + strings.Repeat("=", 40) + "\n\n")
+		}
+		bw.WriteString(c.Title + "\n")
+		if meta := strings.TrimSpace(c.Model + " " + formatTime(c.CreatedAt)); meta != "" {
+			bw.WriteString(meta + "\n")
+		}
+		bw.WriteString("\n")
+		if c.SystemPrompt != "" {
+			fmt.Fprintf(bw, "System prompt: %s\n\n", c.SystemPrompt)
+		}
+		for _, m := range c.Messages {
+			bw.WriteString(strings.ToUpper(m.Role))
+			if t := formatTime(m.CreatedAt); t != "" {
+				fmt.Fprintf(bw, " (%s)", t)
+			}
+			fmt.Fprintf(bw, ":\n%s\n\n", strings.TrimSpace(m.Content))
+			for _, a := range m.Attachments {
+				if a.Kind == types.AttachmentImage {
+					fmt.Fprintf(bw, "[image %s]\n\n", a.Name)
+					continue
+				}
+				fmt.Fprintf(bw, "[%s %s]\n%s\n\n", a.Kind, a.Name, strings.TrimRight(a.Content, "\n"))
+			}
+		}
+	}
+	return bw.Flush()
+}
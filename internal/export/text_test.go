@@ -0,0 +1,76 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+func TestWriteQA(t *testing.T) {
+	var sb strings.Builder
+	if err := WriteQA(&sb, []types.Conversation{fixture()}); err != nil {
+		t.Fatal(err)
+	}
+	got := sb.String()
+	for _, want := range []string{
+		"> System Prompt: You are terse.\n\n",
+		"## Q: How do I retry?\n\n**Attachment: dial.go**\n\n```go\npackage dial\n```\n\n*Image: trace.png (2×1)*\n\n---\n\n",
+		"## A: Wrap the call in a loop.\n\n---\n\n",
+		"## SYSTEM: Summary of earlier conversation:",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+	if strings.HasPrefix(got, "# ") {
+		t.Error("a single conversation got a title heading")
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	c := fixture()
+	c.Messages[1].Content = "Use ```code``` and **bold**." // left as written
+	var sb strings.Builder
+	if err := WriteText(&sb, []types.Conversation{c, fixture()}); err != nil {
+		t.Fatal(err)
+	}
+	got := sb.String()
+	for _, want := range []string{
+		"Retry loop\ngpt-4o ",
+		"System prompt: You are terse.\n\n",
+		"USER (",
+		"How do I retry?\n\n[file dial.go]\npackage dial\n\n[image trace.png]\n\n",
+		"Use ```code``` and **bold**.",
+		"\n" + strings.Repeat("=", 40) + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+	// No markup is added around what the conversation holds.
+	for _, markup := range []string{"## ", "> ", "```go", "**Attachment"} {
+		if strings.Contains(got, markup) {
+			t.Errorf("plain text contains %q", markup)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	c := fixture()
+	got := Filter([]types.Conversation{c}, Options{})[0]
+	if got.SystemPrompt != "" || got.Model != "" || got.Tags != nil || !got.CreatedAt.IsZero() {
+		t.Errorf("conversation kept %+v", got)
+	}
+	for _, m := range got.Messages {
+		if m.Attachments != nil || m.Pinned || !m.CreatedAt.IsZero() {
+			t.Errorf("message kept %+v", m)
+		}
+	}
+	if c.Messages[0].Attachments == nil || c.SystemPrompt == "" {
+		t.Error("Filter changed its input")
+	}
+	if full := Filter([]types.Conversation{c}, Full)[0]; full.Model != c.Model || len(full.Messages[0].Attachments) != 2 {
+		t.Error("Full left something out")
+	}
+}
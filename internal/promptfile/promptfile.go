@@ -0,0 +1,168 @@
+// Package promptfile reads and writes system prompts and prompt templates as
+// markdown files with a small front matter block, so prompt libraries can be
+// shared as directories.
+//
+//	---
+//	id: coder
+//	name: Code Expert
+//	default: true
+//	kind: system
+//	---
+//	You are an expert software engineer...
+package promptfile
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+const delimiter = "---"
+
+// Marshal renders p as a markdown file with front matter.
+func Marshal(p types.SystemPrompt) []byte {
+	var sb strings.Builder
+	sb.WriteString(delimiter + "\n")
+	fmt.Fprintf(&sb, "id: %s\n", p.ID)
+	fmt.Fprintf(&sb, "name: %s\n", p.Name)
+	if p.IsDefault {
+		sb.WriteString("default: true\n")
+	}
+	if p.Kind != "" {
+		fmt.Fprintf(&sb, "kind: %s\n", p.Kind)
+	}
+	sb.WriteString(delimiter + "\n")
+	sb.WriteString(p.Content)
+	if !strings.HasSuffix(p.Content, "\n") {
+		sb.WriteString("\n")
+	}
+	return []byte(sb.String())
+}
+
+// Parse reads a prompt file. Files without front matter are taken as plain
+// content; the caller fills in a name from the file name.
+func Parse(data []byte) (types.SystemPrompt, error) {
+	var p types.SystemPrompt
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if !strings.HasPrefix(text, delimiter+"\n") {
+		p.Content = strings.TrimSpace(text)
+		return p, nil
+	}
+	// Keep the newline after the opening delimiter so that an empty block
+	// ("---\n---") is found like any other.
+	rest := text[len(delimiter):]
+	end := strings.Index(rest, "\n"+delimiter)
+	if end < 0 {
+		return p, fmt.Errorf("unterminated front matter")
+	}
+	header, body := rest[:end], rest[end+len(delimiter)+1:]
+	body = strings.TrimPrefix(body, "\n")
+
+	sc := bufio.NewScanner(strings.NewReader(header))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return p, fmt.Errorf("invalid front matter line %q", line)
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "id":
+			p.ID = value
+		case "name":
+			p.Name = value
+		case "default":
+			p.IsDefault, _ = strconv.ParseBool(value)
+		case "kind":
+			p.Kind = strings.ToLower(value)
+		}
+	}
+	p.Content = strings.TrimRight(body, "\n")
+	return p, nil
+}
+
+// FileName returns a file name for p derived from its ID or name.
+func FileName(p types.SystemPrompt) string {
+	base := p.ID
+	if base == "" {
+		base = p.Name
+	}
+	var sb strings.Builder
+	for _, r := range strings.ToLower(base) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			sb.WriteRune(r)
+		case r > 0x7f:
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('-')
+		}
+	}
+	name := strings.Trim(sb.String(), "-")
+	if name == "" {
+		name = "prompt"
+	}
+	return name + ".md"
+}
+
+// Existing returns the files in dir that ExportDir would overwrite.
+func Existing(dir string, prompts []types.SystemPrompt) []string {
+	var names []string
+	for _, p := range prompts {
+		name := filepath.Join(dir, FileName(p))
+		if _, err := os.Stat(name); err == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ExportDir writes every prompt to dir as <id>.md, creating dir if needed.
+func ExportDir(dir string, prompts []types.SystemPrompt) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, p := range prompts {
+		if err := os.WriteFile(filepath.Join(dir, FileName(p)), Marshal(p), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportDir reads all *.md files in dir. Prompts without an ID or name get
+// them from the file name.
+func ImportDir(dir string) ([]types.SystemPrompt, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.md"))
+	if err != nil {
+		return nil, err
+	}
+	var prompts []types.SystemPrompt
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		p, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(f), err)
+		}
+		stem := strings.TrimSuffix(filepath.Base(f), filepath.Ext(f))
+		if p.ID == "" {
+			p.ID = stem
+		}
+		if p.Name == "" {
+			p.Name = stem
+		}
+		prompts = append(prompts, p)
+	}
+	return prompts, nil
+}
@@ -0,0 +1,44 @@
+package promptfile
+
+import (
+	"testing"
+
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name, data string
+		want       types.SystemPrompt
+	}{
+		{"plain", "Be brief.\n", types.SystemPrompt{Content: "Be brief."}},
+		{"front matter", "---\nid: coder\nname: Coder\ndefault: true\n---\nBe brief.\n",
+			types.SystemPrompt{ID: "coder", Name: "Coder", IsDefault: true, Content: "Be brief."}},
+		{"empty front matter", "---\n---\nBe brief.\n", types.SystemPrompt{Content: "Be brief."}},
+		{"CRLF", "---\r\nname: Coder\r\n---\r\nBe brief.\r\n", types.SystemPrompt{Name: "Coder", Content: "Be brief."}},
+	}
+	for _, tt := range tests {
+		got, err := Parse([]byte(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+	if _, err := Parse([]byte("---\nname: Coder\nBe brief.\n")); err == nil {
+		t.Error("unterminated front matter parsed")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	p := types.SystemPrompt{ID: "coder", Name: "Coder", Kind: types.PromptKindTemplate, Content: "Explain {{code}}"}
+	got, err := Parse(Marshal(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != p {
+		t.Errorf("got %+v, want %+v", got, p)
+	}
+}
@@ -0,0 +1,181 @@
+// Package rag splits source files into chunks, embeds them and finds the
+// chunks closest to a question.
+package rag
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+const (
+	// ChunkLines is the size of a chunk; consecutive chunks overlap by ChunkOverlap lines.
+	ChunkLines   = 60
+	ChunkOverlap = 10
+	// HashDim is the vector size of the local embedder.
+	HashDim = 512
+)
+
+// Embedder turns texts into vectors of the same dimension.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// Split cuts content into overlapping chunks of ChunkLines lines.
+func Split(path, content string) []types.Chunk {
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	var chunks []types.Chunk
+	for start := 0; start < len(lines); start += ChunkLines - ChunkOverlap {
+		end := min(start+ChunkLines, len(lines))
+		text := strings.Join(lines[start:end], "\n")
+		if strings.TrimSpace(text) != "" {
+			chunks = append(chunks, types.Chunk{Path: path, StartLine: start + 1, EndLine: end, Content: text})
+		}
+		if end == len(lines) {
+			break
+		}
+	}
+	return chunks
+}
+
+// HashEmbedder is an offline stand-in for an embedding model: it hashes the
+// words and identifier parts of a text into a fixed number of buckets. It only
+// captures shared vocabulary, which is often enough to find code by name.
+type HashEmbedder struct{}
+
+func (HashEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		v := make([]float32, HashDim)
+		for _, w := range words(t) {
+			if len(w) < 2 || stopWords[w] {
+				continue
+			}
+			h := fnv.New32a()
+			h.Write([]byte(w))
+			v[h.Sum32()%HashDim]++
+		}
+		// Dampen repeated words so one frequent term doesn't decide the match.
+		for j, x := range v {
+			if x > 0 {
+				v[j] = 1 + float32(math.Log(float64(x)))
+			}
+		}
+		normalize(v)
+		out[i] = v
+	}
+	return out, nil
+}
+
+// stopWords are common English and Go words that say little about a chunk.
+var stopWords = map[string]bool{
+	"the": true, "is": true, "are": true, "of": true, "to": true, "in": true, "and": true, "or": true,
+	"a": true, "an": true, "it": true, "for": true, "on": true, "at": true, "by": true, "be": true,
+	"how": true, "what": true, "where": true, "which": true, "does": true, "do": true, "this": true, "that": true,
+	"with": true, "from": true, "as": true, "if": true, "not": true, "we": true, "you": true,
+	"func": true, "return": true, "err": true, "nil": true, "string": true, "int": true, "var": true, "type": true,
+}
+
+// words lowercases t and splits it into words, also splitting camelCase and
+// snake_case identifiers into their parts.
+func words(t string) []string {
+	var out []string
+	for _, f := range strings.FieldsFunc(t, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' }) {
+		out = append(out, strings.ToLower(f))
+		var part []rune
+		flush := func() {
+			if len(part) > 1 {
+				out = append(out, strings.ToLower(string(part)))
+			}
+			part = part[:0]
+		}
+		rs := []rune(f)
+		for j, r := range rs {
+			if r == '_' || (unicode.IsUpper(r) && j > 0 && unicode.IsLower(rs[j-1])) {
+				flush()
+			}
+			if r != '_' {
+				part = append(part, r)
+			}
+		}
+		if len(part) < len(rs) {
+			flush()
+		}
+	}
+	return out
+}
+
+func normalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	n := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= n
+	}
+}
+
+// Cosine returns the cosine similarity of a and b, or 0 when their sizes differ.
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// Search returns the k chunks most similar to query, best first.
+func Search(chunks []types.Chunk, query []float32, k int) []types.Chunk {
+	type scored struct {
+		idx   int
+		score float64
+	}
+	scores := make([]scored, 0, len(chunks))
+	for i, c := range chunks {
+		if s := Cosine(c.Vector, query); s > 0 {
+			scores = append(scores, scored{i, s})
+		}
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
+	out := make([]types.Chunk, 0, k)
+	for _, s := range scores[:min(k, len(scores))] {
+		out = append(out, chunks[s.idx])
+	}
+	return out
+}
+
+// EncodeVector packs v as little-endian float32s for storage.
+func EncodeVector(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(x))
+	}
+	return b
+}
+
+// DecodeVector is the inverse of EncodeVector.
+func DecodeVector(b []byte) []float32 {
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v
+}
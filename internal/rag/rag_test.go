@@ -0,0 +1,165 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+func TestSplit(t *testing.T) {
+	numbered := func(n int) string {
+		var sb strings.Builder
+		for i := 1; i <= n; i++ {
+			fmt.Fprintf(&sb, "line %d\n", i)
+		}
+		return sb.String()
+	}
+	tests := []struct {
+		name    string
+		content string
+		want    [][2]int // first and last line of each chunk
+	}{
+		{"empty", "", nil},
+		{"short", numbered(5), [][2]int{{1, 5}}},
+		{"exactly one chunk", numbered(ChunkLines), [][2]int{{1, 60}}},
+		{"one line more", numbered(ChunkLines + 1), [][2]int{{1, 60}, {51, 61}}},
+		{"overlapping", numbered(120), [][2]int{{1, 60}, {51, 110}, {101, 120}}},
+		{"blank chunks skipped", strings.Repeat("\n", 110) + "x", [][2]int{{101, 111}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := Split("a.go", tt.content)
+			var got [][2]int
+			for _, c := range chunks {
+				got = append(got, [2]int{c.StartLine, c.EndLine})
+				if c.Path != "a.go" {
+					t.Errorf("chunk path %q", c.Path)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got chunks %v, want %v", got, tt.want)
+			}
+			lines := strings.Split(tt.content, "\n")
+			for _, c := range chunks {
+				if want := strings.Join(lines[c.StartLine-1:c.EndLine], "\n"); c.Content != want {
+					t.Errorf("chunk %d-%d holds %q, want %q", c.StartLine, c.EndLine, c.Content, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHashEmbedder(t *testing.T) {
+	texts := []string{
+		"func parseConfig(path string) (*Config, error)",
+		"The retry loop backs off exponentially.",
+		"how is the of",
+	}
+	a, err := HashEmbedder{}.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := HashEmbedder{}.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != len(texts) {
+		t.Fatalf("got %d vectors for %d texts", len(a), len(texts))
+	}
+	for i := range a {
+		if !slices.Equal(a[i], b[i]) {
+			t.Errorf("text %d embedded differently the second time", i)
+		}
+		if len(a[i]) != HashDim {
+			t.Errorf("vector %d has %d dimensions, want %d", i, len(a[i]), HashDim)
+		}
+	}
+	for i, v := range a[:2] {
+		if n := math.Sqrt(dot(v, v)); math.Abs(n-1) > 1e-5 {
+			t.Errorf("vector %d has length %f, want 1", i, n)
+		}
+	}
+	if slices.ContainsFunc(a[2], func(x float32) bool { return x != 0 }) {
+		t.Error("stop words alone give a non-zero vector")
+	}
+
+	q, err := HashEmbedder{}.Embed(context.Background(), []string{"where is the config parsed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, prose := Cosine(q[0], a[0]), Cosine(q[0], a[1]); code <= prose {
+		t.Errorf("question matches the config code %f, no better than the retry prose %f", code, prose)
+	}
+}
+
+func dot(a, b []float32) float64 {
+	var s float64
+	for i := range a {
+		s += float64(a[i]) * float64(b[i])
+	}
+	return s
+}
+
+func TestCosine(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float32
+		want float64
+	}{
+		{"same", []float32{1, 2, 3}, []float32{1, 2, 3}, 1},
+		{"scaled", []float32{1, 2, 3}, []float32{2, 4, 6}, 1},
+		{"orthogonal", []float32{1, 0}, []float32{0, 5}, 0},
+		{"opposite", []float32{1, -1}, []float32{-2, 2}, -1},
+		{"zero vector", []float32{0, 0}, []float32{1, 1}, 0},
+		{"sizes differ", []float32{1, 0}, []float32{1, 0, 0}, 0},
+	}
+	for _, tt := range tests {
+		if got := Cosine(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: got %f, want %f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	chunks := []types.Chunk{
+		{Path: "across", Vector: []float32{0, 1, 0}},
+		{Path: "close", Vector: []float32{0.8, 0.6, 0}},
+		{Path: "same", Vector: []float32{1, 0, 0}},
+		{Path: "away", Vector: []float32{-1, 0, 0}},
+		{Path: "same too", Vector: []float32{2, 0, 0}},
+		{Path: "nearly", Vector: []float32{0.6, 0.8, 0}},
+		{Path: "other model", Vector: []float32{1, 0}},
+	}
+	query := []float32{1, 0, 0}
+	tests := []struct {
+		k    int
+		want []string
+	}{
+		{0, nil},
+		{1, []string{"same"}},
+		{3, []string{"same", "same too", "close"}},
+		// Chunks with no similarity at all are never returned.
+		{10, []string{"same", "same too", "close", "nearly"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, c := range Search(chunks, query, tt.k) {
+			got = append(got, c.Path)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("top %d: got %q, want %q", tt.k, got, tt.want)
+		}
+	}
+}
+
+func TestVectorEncoding(t *testing.T) {
+	v := []float32{0, 1, -2.5, float32(math.Pi), math.SmallestNonzeroFloat32}
+	if got := DecodeVector(EncodeVector(v)); !slices.Equal(got, v) {
+		t.Errorf("got %v back, want %v", got, v)
+	}
+}
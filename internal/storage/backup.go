@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is stored in PRAGMA user_version. Bump it when a migration
+// changes the schema so that restores of newer backups are refused.
+const SchemaVersion = 3
+
+// promptsSeededVersion is the first schema version whose databases have had
+// the built-in prompts added.
+const promptsSeededVersion = 3
+
+// Backup name prefixes; only automatic backups are rotated.
+const (
+	AutoBackupPrefix    = "auto-"
+	ManualBackupPrefix  = "manual-"
+	RestoreBackupPrefix = "pre-restore-"
+)
+
+// BackupDir is the default directory for backups, next to the database.
+func BackupDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".xftui-backups")
+}
+
+// Path returns the file the database lives in.
+func (m *Manager) Path() string {
+	return m.path
+}
+
+// Backup writes a consistent copy of the database to dest, which must not exist.
+func (m *Manager) Backup(dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+	_, err := m.db.Exec("VACUUM INTO ?", dest)
+	return err
+}
+
+// BackupTo writes a backup named prefix plus the current time into dir and returns its path.
+func (m *Manager) BackupTo(dir, prefix string) (string, error) {
+	dest := filepath.Join(dir, prefix+time.Now().Format("20060102-150405")+".db")
+	return dest, m.Backup(dest)
+}
+
+// CheckBackup reports whether path holds a database this version can restore:
+// it must pass an integrity check, have our tables and not be from a newer schema.
+func CheckBackup(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA quick_check").Scan(&result); err != nil {
+		return fmt.Errorf("not a readable database: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("database is damaged: %s", result)
+	}
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("backup has schema version %d, newer than %d; upgrade chat-tui first", version, SchemaVersion)
+	}
+	for _, table := range []string{"conversations", "messages"} {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("not a chat-tui database: no %s table", table)
+		}
+	}
+	return nil
+}
+
+// ErrInUse is returned by Restore while another process has the database open.
+var ErrInUse = errors.New("another chat-tui is using the database; quit it first")
+
+// Restore replaces the database with the backup at src after checking it.
+// The current database is first backed up into backupDir, and put back when
+// the restored one cannot be opened. The caller must make sure nothing else
+// uses m meanwhile, as the database is closed and reopened; other processes
+// are detected and refused with ErrInUse.
+func (m *Manager) Restore(src, backupDir string) error {
+	if err := CheckBackup(src); err != nil {
+		return err
+	}
+	alone, err := tryLockExclusive(m.lock)
+	if err != nil {
+		return err
+	}
+	if !alone {
+		return ErrInUse
+	}
+	defer func() { _ = lockShared(m.lock) }()
+	saved, err := m.BackupTo(backupDir, RestoreBackupPrefix)
+	if err != nil {
+		return fmt.Errorf("backing up the current database: %w", err)
+	}
+
+	// Copy next to the database first so the swap itself is a rename.
+	tmp := m.path + ".restore"
+	if err := copyFile(src, tmp); err != nil {
+		return err
+	}
+	reopened, err := m.swapDB(tmp, saved)
+	if reopened {
+		if loadErr := m.loadEncryption(); loadErr != nil {
+			return loadErr
+		}
+	}
+	return err
+}
+
+// swapDB closes the database, renames tmp over it and reopens it, putting
+// saved back when tmp cannot be opened. It reports whether a database is open
+// again. m.mu is held throughout so that Changed never finds it closed.
+func (m *Manager) swapDB(tmp, saved string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closeWatch()
+	if err := m.db.Close(); err != nil {
+		return false, err
+	}
+	renameErr := replaceFile(tmp, m.path)
+	// Reopen whatever is in place now, which also migrates an older backup.
+	db, err := openDB(m.path)
+	if err != nil && renameErr == nil {
+		openErr := err
+		if err = copyFile(saved, tmp); err == nil {
+			err = replaceFile(tmp, m.path)
+		}
+		if err == nil {
+			db, err = openDB(m.path)
+		}
+		if err != nil {
+			return false, fmt.Errorf("opening the restored database: %v; putting back %s: %w", openErr, saved, err)
+		}
+		renameErr = fmt.Errorf("opening the restored database: %w; the previous one is back in place", openErr)
+	}
+	if err != nil {
+		return false, err
+	}
+	m.db = db
+	return true, renameErr
+}
+
+// replaceFile renames src over the database at path, dropping the write-ahead
+// log and journal of the database it replaces.
+func replaceFile(src, path string) error {
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		_ = os.Remove(path + suffix)
+	}
+	return os.Rename(src, path)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// BackupFile is a backup found in a backup directory.
+type BackupFile struct {
+	Path    string
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// ListBackups returns the backups in dir, newest first.
+func ListBackups(dir string) ([]BackupFile, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []BackupFile
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".db") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, BackupFile{Path: filepath.Join(dir, e.Name()), Name: e.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime.After(files[j].ModTime) })
+	return files, nil
+}
+
+// AutoBackup makes an automatic backup in dir when the newest one is older
+// than a day, then deletes automatic backups beyond the keep newest. It
+// returns the path of the new backup, or "" when none was due.
+func (m *Manager) AutoBackup(dir string, keep int) (string, error) {
+	files, err := ListBackups(dir)
+	if err != nil {
+		return "", err
+	}
+	var autos []BackupFile
+	for _, f := range files {
+		if strings.HasPrefix(f.Name, AutoBackupPrefix) {
+			autos = append(autos, f)
+		}
+	}
+	var made string
+	if len(autos) == 0 || time.Since(autos[0].ModTime) > 24*time.Hour {
+		if made, err = m.BackupTo(dir, AutoBackupPrefix); err != nil {
+			return "", err
+		}
+		autos = append([]BackupFile{{Path: made}}, autos...)
+	}
+	for _, f := range autos[min(keep, len(autos)):] {
+		_ = os.Remove(f.Path)
+	}
+	return made, nil
+}
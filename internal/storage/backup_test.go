@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	m, err := OpenManager(filepath.Join(dir, "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateConversation("Before", "m", ""); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := m.BackupTo(filepath.Join(dir, "backups"), ManualBackupPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateConversation("After", "m", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if runtime.GOOS != "windows" {
+		other, err := OpenManager(m.Path())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Restore(backup, filepath.Join(dir, "backups")); !errors.Is(err, ErrInUse) {
+			t.Errorf("restore with another instance open: %v, want ErrInUse", err)
+		}
+		other.db.Close()
+		other.lock.Close()
+	}
+
+	if err := m.Restore(backup, filepath.Join(dir, "backups")); err != nil {
+		t.Fatal(err)
+	}
+	convs, err := m.ListConversations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(convs) != 1 || convs[0].Title != "Before" {
+		t.Errorf("restored %+v, want only Before", convs)
+	}
+}
+
+func TestRestoreUnopenable(t *testing.T) {
+	dir := t.TempDir()
+	m, err := OpenManager(filepath.Join(dir, "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateConversation("Before", "m", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Passes CheckBackup, but the migration cannot index attachments.
+	bad := filepath.Join(dir, "bad.db")
+	db, err := sql.Open("sqlite", bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE conversations (id TEXT PRIMARY KEY);
+	CREATE TABLE messages (id INTEGER PRIMARY KEY);
+	CREATE TABLE attachments (id INTEGER PRIMARY KEY);`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Restore(bad, filepath.Join(dir, "backups")); err == nil {
+		t.Fatal("restoring an unopenable database succeeded")
+	}
+	convs, err := m.ListConversations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(convs) != 1 || convs[0].Title != "Before" {
+		t.Errorf("after a failed restore %+v, want Before", convs)
+	}
+	if _, err := m.CreateConversation("After", "m", ""); err != nil {
+		t.Errorf("writing after a failed restore: %v", err)
+	}
+}
+
+// TestChangedDuringRestore polls Changed while the database is restored, as
+// a watcher running beside the restore would. Run it with -race.
+func TestChangedDuringRestore(t *testing.T) {
+	dir := t.TempDir()
+	m, err := OpenManager(filepath.Join(dir, "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := m.BackupTo(filepath.Join(dir, "backups"), ManualBackupPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				_, _ = m.Changed()
+			}
+		}
+	}()
+	// Each in its own directory, as the pre-restore backups are named by second.
+	for i := range 3 {
+		if err := m.Restore(backup, filepath.Join(dir, fmt.Sprint("restore", i))); err != nil {
+			t.Error(err)
+		}
+	}
+	close(done)
+	<-polled
+	if _, err := m.Changed(); err != nil {
+		t.Errorf("Changed after the restores: %v", err)
+	}
+}
@@ -0,0 +1,344 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// keyIterations is the PBKDF2-SHA256 work factor for new databases; the
+// count used is stored with the salt so it can be raised later.
+const keyIterations = 600_000
+
+// verifierText is encrypted with the key to tell a wrong passphrase apart.
+const verifierText = "chat-tui"
+
+var (
+	ErrLocked          = errors.New("the database is encrypted; unlock it with the passphrase first")
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+)
+
+// encryptedColumns holds what encryption covers: message text, attachments
+// and the retrieval index. Titles, tags and prompts stay readable so the
+// history can be listed. Text columns keep base64 text, blobs raw bytes.
+var encryptedColumns = []struct {
+	table, column string
+	text          bool
+}{
+	{"messages", "content", true},
+	{"attachments", "content", true},
+	{"attachments", "data", false},
+	{"chunks", "content", true},
+	{"chunks", "vector", false},
+}
+
+func newAEAD(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptBytes seals b with a random nonce in front; a nil aead leaves b as it is.
+func encryptBytes(aead cipher.AEAD, b []byte) []byte {
+	if aead == nil || b == nil {
+		return b
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(b)+aead.Overhead())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, b, nil)
+}
+
+func decryptBytes(aead cipher.AEAD, b []byte) ([]byte, error) {
+	if aead == nil || b == nil {
+		return b, nil
+	}
+	if len(b) < aead.NonceSize() {
+		return nil, errors.New("encrypted value is truncated")
+	}
+	return aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], nil)
+}
+
+func encryptString(aead cipher.AEAD, s string) string {
+	if aead == nil {
+		return s
+	}
+	return base64.StdEncoding.EncodeToString(encryptBytes(aead, []byte(s)))
+}
+
+func decryptString(aead cipher.AEAD, s string) (string, error) {
+	if aead == nil {
+		return s, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	b, err = decryptBytes(aead, b)
+	return string(b), err
+}
+
+// queryer is a *sql.DB or a *sql.Tx.
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// loadEncryption reads whether the database is encrypted. It forgets the key,
+// so a reopened database has to be unlocked again.
+func (m *Manager) loadEncryption() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.encrypted, m.salt, m.aead = false, nil, nil
+	return m.checkEncryption(m.db)
+}
+
+// checkEncryption reads the encryption marker through q and catches up with
+// another instance that encrypted or decrypted the database, or encrypted it
+// with a new key: the key is forgotten whenever the salt changes. m.mu must
+// be held.
+func (m *Manager) checkEncryption(q queryer) error {
+	var salt []byte
+	err := q.QueryRow("SELECT salt FROM encryption").Scan(&salt)
+	if errors.Is(err, sql.ErrNoRows) {
+		err, salt = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	if salt == nil {
+		salt = []byte{} // known to be unencrypted, unlike a nil m.salt
+	}
+	if m.salt == nil || !bytes.Equal(salt, m.salt) {
+		m.encrypted, m.salt, m.aead = len(salt) > 0, salt, nil
+	}
+	return nil
+}
+
+// Encrypted reports whether message content is stored encrypted.
+func (m *Manager) Encrypted() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_ = m.checkEncryption(m.db)
+	return m.encrypted
+}
+
+// Locked reports whether the database is encrypted and has not been unlocked
+// yet, which it also is after another instance encrypted it.
+func (m *Manager) Locked() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_ = m.checkEncryption(m.db)
+	return m.encrypted && m.aead == nil
+}
+
+// cipher returns the key to seal and open content with, nil when the database
+// is not encrypted. It checks the marker through q first, so writes pass the
+// transaction they write in: content is then sealed the way the database is
+// encrypted at commit, whatever other instances did.
+func (m *Manager) cipher(q queryer) (cipher.AEAD, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkEncryption(q); err != nil {
+		return nil, err
+	}
+	if m.encrypted && m.aead == nil {
+		return nil, ErrLocked
+	}
+	return m.aead, nil
+}
+
+// Unlock derives the key from passphrase and checks it against the database.
+func (m *Manager) Unlock(passphrase string) error {
+	var salt, verifier []byte
+	var iterations int
+	err := m.db.QueryRow("SELECT salt, iterations, verifier FROM encryption").Scan(&salt, &iterations, &verifier)
+	if errors.Is(err, sql.ErrNoRows) {
+		return m.loadEncryption()
+	}
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(passphrase, salt, iterations)
+	if err != nil {
+		return err
+	}
+	if _, err := decryptBytes(aead, verifier); err != nil {
+		return ErrWrongPassphrase
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.encrypted, m.salt, m.aead = true, salt, aead
+	return nil
+}
+
+// ErrWALInUse is returned by EnableEncryption when the content is encrypted
+// but another connection kept the write-ahead log from being emptied.
+var ErrWALInUse = errors.New("another chat-tui has the database open, so old plaintext may stay in its -wal file until every instance quits")
+
+// EnableEncryption encrypts the existing content with a key derived from
+// passphrase and keeps the database unlocked. The write-ahead log is emptied
+// and the file vacuumed afterwards so no plaintext is left in the log or in
+// free pages; earlier backups are not touched.
+func (m *Manager) EnableEncryption(passphrase string) error {
+	if passphrase == "" {
+		return errors.New("the passphrase is empty")
+	}
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	aead, err := newAEAD(passphrase, salt, keyIterations)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	err = m.checkEncryption(tx)
+	encrypted := m.encrypted
+	m.mu.Unlock()
+	if err == nil && encrypted {
+		err = errors.New("the database is already encrypted")
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := recryptAll(tx, nil, aead); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO encryption (id, salt, iterations, verifier) VALUES (1, ?, ?, ?)",
+		salt, keyIterations, encryptBytes(aead, []byte(verifierText))); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.encrypted, m.salt, m.aead = true, salt, aead
+	m.mu.Unlock()
+	// The plaintext pages the rewrite replaced are still in the log, and
+	// VACUUM copies the whole database through it.
+	if err := m.truncateWAL(); err != nil {
+		return err
+	}
+	if _, err := m.db.Exec("VACUUM"); err != nil {
+		return err
+	}
+	return m.truncateWAL()
+}
+
+// truncateWAL writes the write-ahead log into the database and empties it.
+func (m *Manager) truncateWAL() error {
+	var busy, logged, checkpointed int
+	if err := m.db.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logged, &checkpointed); err != nil {
+		return err
+	}
+	if busy != 0 {
+		return ErrWALInUse
+	}
+	return nil
+}
+
+// DisableEncryption decrypts all content again; the database must be unlocked.
+func (m *Manager) DisableEncryption() error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	aead, err := m.cipher(tx)
+	if err == nil && aead == nil {
+		err = errors.New("the database is not encrypted")
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := recryptAll(tx, aead, nil); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM encryption"); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.encrypted, m.salt, m.aead = false, []byte{}, nil
+	return nil
+}
+
+// recryptAll rewrites every encrypted column, opening values with from and
+// sealing them with to; nil stands for plaintext.
+func recryptAll(tx *sql.Tx, from, to cipher.AEAD) error {
+	for _, c := range encryptedColumns {
+		if err := recryptColumn(tx, c.table, c.column, c.text, from, to); err != nil {
+			return fmt.Errorf("%s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
+
+func recryptColumn(tx *sql.Tx, table, column string, text bool, from, to cipher.AEAD) error {
+	rows, err := tx.Query(fmt.Sprintf("SELECT id FROM %s WHERE %s IS NOT NULL", table, column))
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Values are read one at a time, as attachments may hold large images.
+	for _, id := range ids {
+		var value []byte
+		if err := tx.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE id = ?", column, table), id).Scan(&value); err != nil {
+			return err
+		}
+		var out any
+		if text {
+			s, err := decryptString(from, string(value))
+			if err != nil {
+				return err
+			}
+			out = encryptString(to, s)
+		} else {
+			b, err := decryptBytes(from, value)
+			if err != nil {
+				return err
+			}
+			out = encryptBytes(to, b)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", table, column), out, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
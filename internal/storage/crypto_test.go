@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestEncryptionByAnotherInstance checks that an instance that opened the
+// database before another one encrypted it stops writing plaintext.
+func TestEncryptionByAnotherInstance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.db")
+	a, err := OpenManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := OpenManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := b.CreateConversation("Chat", "m", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.SaveMessage(id, "user", "before"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.EnableEncryption("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.SaveMessage(id, "user", "after"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("saving after another instance encrypted: %v, want ErrLocked", err)
+	}
+	if !b.Locked() {
+		t.Error("not locked after another instance encrypted")
+	}
+	if err := b.Unlock("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.SaveMessage(id, "user", "unlocked"); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := a.ListMessages(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Content != "before" || msgs[1].Content != "unlocked" {
+		t.Errorf("messages = %+v, want before and unlocked", msgs)
+	}
+
+	if err := a.DisableEncryption(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.SaveMessage(id, "user", "plain"); err != nil {
+		t.Fatal(err)
+	}
+	if b.Encrypted() {
+		t.Error("still encrypted after another instance decrypted")
+	}
+	if msgs, err := a.ListMessages(id); err != nil || len(msgs) != 3 || msgs[2].Content != "plain" {
+		t.Errorf("messages = %+v, %v, want three readable ones", msgs, err)
+	}
+}
+
+// TestEncryptionLeavesNoPlaintext checks the database file and its
+// write-ahead log for a message after encrypting.
+func TestEncryptionLeavesNoPlaintext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.db")
+	m, err := OpenManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := m.CreateConversation("Chat", "m", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const secret = "the launch code is 0000"
+	for i := 0; i < 50; i++ {
+		if _, err := m.SaveMessage(id, "user", secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.EnableEncryption("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{path, path + "-wal"} {
+		data, err := os.ReadFile(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("%s still holds the message in plain text", filepath.Base(name))
+		}
+		if name != path && len(data) != 0 {
+			t.Errorf("write-ahead log not emptied: %d bytes", len(data))
+		}
+	}
+}
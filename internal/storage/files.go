@@ -0,0 +1,766 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+	"github.com/evallife/chat-tui/internal/promptfile"
+	"github.com/evallife/chat-tui/internal/rag"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// FileStore keeps every conversation as an indented JSON file and every
+// prompt as a markdown file, so a team can keep them in git or sync them with
+// other tools:
+//
+//	dir/conversations/<id>.json
+//	dir/prompts/<id>.md
+//	dir/collections/<id>.json   (retrieval indexes; usually not worth committing)
+//
+// Files are replaced atomically, but concurrent edits of the same
+// conversation from two places are not merged; the last write wins.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+
+	watched time.Time // newest directory change seen by Changed
+
+	// Conversations as last read for listing, without their messages, by
+	// file name; a file is read again once its size or time changes.
+	headers map[string]header
+}
+
+type header struct {
+	modTime time.Time
+	size    int64
+	conv    convFile
+}
+
+// SkippedError is returned together with the conversations that could be
+// listed when some files could not be read.
+type SkippedError struct {
+	Errs []error // one per file
+}
+
+func (e *SkippedError) Error() string {
+	return fmt.Sprintf("%d conversation file(s) skipped: %v", len(e.Errs), errors.Join(e.Errs...))
+}
+
+// FilesDir is the default directory of the files store.
+func FilesDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".xftui-conversations")
+}
+
+// NewFileStore opens the files store in dir, creating it if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	// Built-in prompts are added once, with the prompts directory, so that
+	// deleting them all leaves none.
+	_, err := os.Stat(filepath.Join(dir, "prompts"))
+	fresh := os.IsNotExist(err)
+	for _, sub := range []string{"conversations", "prompts", "collections"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	s := &FileStore{dir: dir, headers: make(map[string]header)}
+	if fresh {
+		for _, p := range defaultPrompts() {
+			if err := s.writePrompt(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// convFile is the content of a conversation file.
+type convFile struct {
+	types.Conversation
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func (c convFile) summary() ConvSummary {
+	s := ConvSummary{ID: c.ID, Title: c.Title, Folder: c.Folder, Tags: c.Tags, Pinned: c.Pinned, UpdatedAt: c.UpdatedAt}
+	if c.DeletedAt != nil {
+		s.DeletedAt = *c.DeletedAt
+	}
+	return s
+}
+
+// now is the time stamped on new rows, in whole seconds like CURRENT_TIMESTAMP.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// fileName checks that id can be used as a file name.
+func fileName(id, ext string) (string, error) {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\:`) {
+		return "", fmt.Errorf("invalid ID %q", id)
+	}
+	return id + ext, nil
+}
+
+func (s *FileStore) convPath(id string) (string, error) {
+	name, err := fileName(id, ".json")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, "conversations", name), nil
+}
+
+// writeFile replaces path by writing a temporary file and renaming it.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(path, append(data, '\n'))
+}
+
+func (s *FileStore) readConv(id string) (convFile, error) {
+	var c convFile
+	path, err := s.convPath(id)
+	if err != nil {
+		return c, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return c, nil
+}
+
+func (s *FileStore) writeConv(c convFile) error {
+	path, err := s.convPath(c.ID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(path, c)
+}
+
+// update rewrites conversation id after fn changed it.
+func (s *FileStore) update(id string, fn func(c *convFile) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.readConv(id)
+	if err != nil {
+		return err
+	}
+	if err := fn(&c); err != nil {
+		return err
+	}
+	return s.writeConv(c)
+}
+
+// updateEach applies fn to each conversation in ids.
+func (s *FileStore) updateEach(ids []string, fn func(c *convFile)) error {
+	for _, id := range ids {
+		if err := s.update(id, func(c *convFile) error { fn(c); return nil }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readHeaders returns every conversation without its messages, reading only
+// the files that changed since the last call. Files that cannot be read are
+// left out and reported with a *SkippedError.
+func (s *FileStore) readHeaders() ([]convFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := os.ReadDir(filepath.Join(s.dir, "conversations"))
+	if err != nil {
+		return nil, err
+	}
+	var convs []convFile
+	var skipped []error
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		info, err := e.Info()
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			skipped = append(skipped, err)
+			continue
+		}
+		h, ok := s.headers[name]
+		if !ok || h.size != info.Size() || !h.modTime.Equal(info.ModTime()) {
+			c, err := s.readConv(strings.TrimSuffix(name, ".json"))
+			if err != nil {
+				skipped = append(skipped, err)
+				continue
+			}
+			c.Messages = nil
+			h = header{modTime: info.ModTime(), size: info.Size(), conv: c}
+			s.headers[name] = h
+		}
+		seen[name] = true
+		convs = append(convs, h.conv)
+	}
+	for name := range s.headers {
+		if !seen[name] {
+			delete(s.headers, name)
+		}
+	}
+	if len(skipped) > 0 {
+		return convs, &SkippedError{Errs: skipped}
+	}
+	return convs, nil
+}
+
+func (s *FileStore) CreateConversation(title, modelName, systemPrompt string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := now()
+	c := convFile{Conversation: types.Conversation{
+		ID: uuid.New().String(), Title: title, Model: modelName, SystemPrompt: systemPrompt, CreatedAt: t, UpdatedAt: t,
+	}}
+	return c.ID, s.writeConv(c)
+}
+
+func (s *FileStore) GetConversation(id string) (types.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.readConv(id)
+	c.Messages = nil
+	return c.Conversation, err
+}
+
+func (s *FileStore) HasConversation(id string) (bool, error) {
+	path, err := s.convPath(id)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *FileStore) ListConversations() ([]ConvSummary, error) {
+	convs, err := s.readHeaders()
+	if convs == nil && err != nil {
+		return nil, err
+	}
+	var list []ConvSummary
+	for _, c := range convs {
+		if c.DeletedAt == nil {
+			list = append(list, c.summary())
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Pinned != list[j].Pinned {
+			return list[i].Pinned
+		}
+		return list[i].UpdatedAt.After(list[j].UpdatedAt)
+	})
+	return list, err
+}
+
+func (s *FileStore) ListTrash() ([]ConvSummary, error) {
+	convs, err := s.readHeaders()
+	if convs == nil && err != nil {
+		return nil, err
+	}
+	var list []ConvSummary
+	for _, c := range convs {
+		if c.DeletedAt != nil {
+			list = append(list, c.summary())
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].DeletedAt.After(list[j].DeletedAt) })
+	return list, err
+}
+
+func (s *FileStore) RenameConversation(id, title string) error {
+	return s.update(id, func(c *convFile) error { c.Title = title; return nil })
+}
+
+func (s *FileStore) SetConversationSystemPrompt(convID, prompt string) error {
+	return s.update(convID, func(c *convFile) error { c.SystemPrompt = prompt; return nil })
+}
+
+func (s *FileStore) SetConversationCollection(convID, collectionID string) error {
+	return s.update(convID, func(c *convFile) error { c.Collection = collectionID; return nil })
+}
+
+func (s *FileStore) SetConversationTags(id string, tags []string) error {
+	return s.update(id, func(c *convFile) error {
+		seen := make(map[string]bool)
+		c.Tags = nil
+		for _, t := range tags {
+			if !seen[t] {
+				seen[t] = true
+				c.Tags = append(c.Tags, t)
+			}
+		}
+		sort.Strings(c.Tags)
+		return nil
+	})
+}
+
+func (s *FileStore) SetConversationFolder(id, folder string) error {
+	return s.update(id, func(c *convFile) error { c.Folder = folder; return nil })
+}
+
+func (s *FileStore) SetConversationPinned(id string, pinned bool) error {
+	return s.update(id, func(c *convFile) error { c.Pinned = pinned; return nil })
+}
+
+func (s *FileStore) ImportConversation(conv types.Conversation) error {
+	return s.importConversation(conv, false)
+}
+
+// ReplaceConversation writes conv over the file of the conversation with the
+// same ID; the file is replaced in one rename.
+func (s *FileStore) ReplaceConversation(conv types.Conversation) error {
+	return s.importConversation(conv, true)
+}
+
+func (s *FileStore) importConversation(conv types.Conversation, replace bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path, err := s.convPath(conv.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil && !replace {
+		return fmt.Errorf("conversation %s already exists", conv.ID)
+	}
+	c := convFile{Conversation: conv}
+	c.Tags = append([]string(nil), conv.Tags...)
+	sort.Strings(c.Tags)
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = now()
+	}
+	if c.UpdatedAt.IsZero() {
+		c.UpdatedAt = now()
+	}
+	c.Messages = nil
+	var attachmentID int64
+	for i, msg := range conv.Messages {
+		msg.ID = int64(i + 1)
+		if msg.CreatedAt.IsZero() {
+			msg.CreatedAt = now()
+		}
+		msg.Attachments = append([]types.Attachment(nil), msg.Attachments...)
+		for j := range msg.Attachments {
+			attachmentID++
+			msg.Attachments[j].ID, msg.Attachments[j].MessageID = attachmentID, msg.ID
+		}
+		c.Messages = append(c.Messages, msg)
+	}
+	return s.writeConv(c)
+}
+
+func (s *FileStore) DeleteConversation(convID string) error {
+	return s.DeleteConversations([]string{convID})
+}
+
+func (s *FileStore) DeleteConversations(ids []string) error {
+	t := now()
+	return s.updateEach(ids, func(c *convFile) { c.DeletedAt = &t })
+}
+
+func (s *FileStore) RestoreConversations(ids []string) error {
+	return s.updateEach(ids, func(c *convFile) { c.DeletedAt = nil })
+}
+
+func (s *FileStore) PurgeConversations(ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		path, err := s.convPath(id)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) PurgeTrash(olderThan time.Duration) (int, error) {
+	trash, err := s.ListTrash()
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-olderThan)
+	var ids []string
+	for _, c := range trash {
+		if c.DeletedAt.Before(cutoff) {
+			ids = append(ids, c.ID)
+		}
+	}
+	return len(ids), s.PurgeConversations(ids)
+}
+
+func (s *FileStore) SaveMessage(convID, role, content string) (int64, error) {
+	msg, err := s.AddMessage(convID, types.Message{Role: role, Content: content})
+	return msg.ID, err
+}
+
+// nextIDs returns the IDs after the highest message and attachment IDs of c.
+func (c *convFile) nextIDs() (msgID, attachmentID int64) {
+	for _, m := range c.Messages {
+		msgID = max(msgID, m.ID)
+		for _, a := range m.Attachments {
+			attachmentID = max(attachmentID, a.ID)
+		}
+	}
+	return msgID + 1, attachmentID + 1
+}
+
+func (s *FileStore) AddMessage(convID string, msg types.Message) (types.Message, error) {
+	err := s.update(convID, func(c *convFile) error {
+		var attachmentID int64
+		msg.ID, attachmentID = c.nextIDs()
+		msg.CreatedAt = now()
+		msg.Attachments = append([]types.Attachment(nil), msg.Attachments...)
+		for i := range msg.Attachments {
+			msg.Attachments[i].ID, msg.Attachments[i].MessageID = attachmentID, msg.ID
+			attachmentID++
+		}
+		c.Messages = append(c.Messages, msg)
+		c.UpdatedAt = msg.CreatedAt
+		return nil
+	})
+	return msg, err
+}
+
+func (s *FileStore) ListMessages(convID string) ([]types.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.readConv(convID)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return c.Messages, err
+}
+
+func (s *FileStore) GetMessages(convID string) ([]openai.ChatCompletionMessage, error) {
+	msgs, err := s.ListMessages(convID)
+	if err != nil {
+		return nil, err
+	}
+	var out []openai.ChatCompletionMessage
+	for _, m := range msgs {
+		out = append(out, openai.ChatCompletionMessage{Role: m.Role, Content: m.Content})
+	}
+	return out, nil
+}
+
+// filterMessages keeps the messages of conversation convID for which keep is true.
+func (s *FileStore) filterMessages(convID string, keep func(types.Message) bool) error {
+	return s.update(convID, func(c *convFile) error {
+		msgs := c.Messages[:0]
+		for _, m := range c.Messages {
+			if keep(m) {
+				msgs = append(msgs, m)
+			}
+		}
+		c.Messages = msgs
+		return nil
+	})
+}
+
+func (s *FileStore) DeleteMessage(convID string, id int64) error {
+	return s.filterMessages(convID, func(m types.Message) bool { return m.ID != id })
+}
+
+func (s *FileStore) DeleteMessagesFrom(convID string, id int64) error {
+	return s.filterMessages(convID, func(m types.Message) bool { return m.ID < id })
+}
+
+func (s *FileStore) SetMessagePinned(convID string, id int64, pinned bool) error {
+	return s.update(convID, func(c *convFile) error {
+		for i := range c.Messages {
+			if c.Messages[i].ID == id {
+				c.Messages[i].Pinned = pinned
+			}
+		}
+		return nil
+	})
+}
+
+func (s *FileStore) SaveSummary(convID, summary string, covered []int64) (int64, error) {
+	var id int64
+	err := s.update(convID, func(c *convFile) error {
+		for i := range c.Messages {
+			for _, cid := range covered {
+				if c.Messages[i].ID == cid {
+					c.Messages[i].Summarized = true
+				}
+			}
+		}
+		id, _ = c.nextIDs()
+		c.Messages = append(c.Messages, types.Message{ID: id, Role: openai.ChatMessageRoleSystem, Content: summary, Pinned: true, CreatedAt: now()})
+		return nil
+	})
+	return id, err
+}
+
+func (s *FileStore) promptPath(id string) string {
+	return filepath.Join(s.dir, "prompts", promptfile.FileName(types.SystemPrompt{ID: id}))
+}
+
+func (s *FileStore) readPrompts() ([]types.SystemPrompt, error) {
+	prompts, err := promptfile.ImportDir(filepath.Join(s.dir, "prompts"))
+	for i := range prompts {
+		if prompts[i].Kind == "" {
+			prompts[i].Kind = types.PromptKindSystem
+		}
+	}
+	return prompts, err
+}
+
+func (s *FileStore) writePrompt(p types.SystemPrompt) error {
+	return writeFile(s.promptPath(p.ID), promptfile.Marshal(p))
+}
+
+func (s *FileStore) ListSystemPrompts() ([]types.SystemPrompt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readPrompts()
+}
+
+// setDefault marks the prompt with id as the default and clears the flag on
+// all others, rewriting the files that change.
+func (s *FileStore) setDefault(id string) error {
+	prompts, err := s.readPrompts()
+	if err != nil {
+		return err
+	}
+	for _, p := range prompts {
+		isDefault := p.ID == id && p.Kind == types.PromptKindSystem
+		if p.IsDefault != isDefault {
+			p.IsDefault = isDefault
+			if err := s.writePrompt(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) SaveSystemPrompt(p types.SystemPrompt) (types.SystemPrompt, error) {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	if p.Kind == "" {
+		p.Kind = types.PromptKindSystem
+	}
+	if p.Kind != types.PromptKindSystem {
+		p.IsDefault = false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.writePrompt(p); err != nil {
+		return p, err
+	}
+	if p.IsDefault {
+		return p, s.setDefault(p.ID)
+	}
+	return p, nil
+}
+
+func (s *FileStore) DeleteSystemPrompt(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.promptPath(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *FileStore) SetDefaultSystemPrompt(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.setDefault(id)
+}
+
+func (s *FileStore) DefaultSystemPrompt() (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prompts, err := s.readPrompts()
+	if err != nil {
+		return "", false, err
+	}
+	for _, p := range prompts {
+		if p.IsDefault {
+			return p.Content, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// collectionFile is the content of a collection file; vectors are stored in
+// the same little-endian encoding as in SQLite.
+type collectionFile struct {
+	types.Collection
+	Index []chunkFile `json:"index"`
+}
+
+type chunkFile struct {
+	types.Chunk
+	Vector []byte `json:"vector"`
+}
+
+func (s *FileStore) collectionPath(id string) (string, error) {
+	name, err := fileName(id, ".json")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, "collections", name), nil
+}
+
+func (s *FileStore) readCollection(id string) (collectionFile, error) {
+	var c collectionFile
+	path, err := s.collectionPath(id)
+	if err != nil {
+		return c, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	return c, json.Unmarshal(data, &c)
+}
+
+func (s *FileStore) ListCollections() ([]types.Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := filepath.Glob(filepath.Join(s.dir, "collections", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var cols []types.Collection
+	for _, f := range files {
+		c, err := s.readCollection(strings.TrimSuffix(filepath.Base(f), ".json"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(f), err)
+		}
+		cols = append(cols, c.Collection)
+	}
+	sort.Slice(cols, func(i, j int) bool { return cols[i].Name < cols[j].Name })
+	return cols, nil
+}
+
+func (s *FileStore) SaveCollection(c types.Collection, chunks []types.Chunk) (types.Collection, error) {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	c.Chunks = len(chunks)
+	c.UpdatedAt = now()
+	f := collectionFile{Collection: c, Index: make([]chunkFile, len(chunks))}
+	for i, ch := range chunks {
+		f.Index[i] = chunkFile{Chunk: ch, Vector: rag.EncodeVector(ch.Vector)}
+	}
+	path, err := s.collectionPath(c.ID)
+	if err != nil {
+		return c, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return c, writeJSON(path, f)
+}
+
+func (s *FileStore) CollectionChunks(collectionID string) ([]types.Chunk, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.readCollection(collectionID)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make([]types.Chunk, len(f.Index))
+	for i, ch := range f.Index {
+		chunks[i] = ch.Chunk
+		chunks[i].Vector = rag.DecodeVector(ch.Vector)
+	}
+	return chunks, nil
+}
+
+func (s *FileStore) DeleteCollection(id string) error {
+	path, err := s.collectionPath(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	err = os.Remove(path)
+	s.mu.Unlock()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	convs, err := s.readHeaders()
+	for _, c := range convs {
+		if c.Collection == id {
+			if err := s.SetConversationCollection(c.ID, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return err
+}
+
+// Changed reports whether a file was added, replaced or removed since the
+// previous call, by this store, another chat-tui or a git pull. The first
+// call only takes note of the current state.
+func (s *FileStore) Changed() (bool, error) {
+	var newest time.Time
+	for _, sub := range []string{"conversations", "prompts", "collections"} {
+		info, err := os.Stat(filepath.Join(s.dir, sub))
+		if err != nil {
+			return false, err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := !s.watched.IsZero() && !newest.Equal(s.watched)
+	s.watched = newest
+	return changed, nil
+}
@@ -0,0 +1,57 @@
+package storage_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/storage/storetest"
+)
+
+func TestFileStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.Store {
+		s, err := storage.NewFileStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestFileStoreSkipsBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	s, err := storage.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := s.CreateConversation("Good", "m", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "conversations", "bad.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	convs, err := s.ListConversations()
+	var skipped *storage.SkippedError
+	if !errors.As(err, &skipped) || len(skipped.Errs) != 1 {
+		t.Errorf("err = %v, want one skipped file", err)
+	}
+	if len(convs) != 1 || convs[0].ID != id {
+		t.Errorf("listed %+v, want the good conversation", convs)
+	}
+
+	// A change is picked up although the unchanged file is not read again.
+	if err := s.RenameConversation(id, "Renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "conversations", "bad.json")); err != nil {
+		t.Fatal(err)
+	}
+	convs, err = s.ListConversations()
+	if err != nil || len(convs) != 1 || convs[0].Title != "Renamed" {
+		t.Errorf("listed %+v, %v, want Renamed", convs, err)
+	}
+}
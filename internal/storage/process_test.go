@@ -0,0 +1,87 @@
+package storage_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/storage/storetest"
+)
+
+// Several copies of the test binary, hammerProcs of them, each add
+// hammerMessages messages to one conversation of a shared database.
+const (
+	hammerProcs    = 4
+	hammerMessages = 50
+)
+
+// hammerEnv holds the database, conversation ID and worker number, one per
+// line, in a copy started by TestProcesses, which then runs as that worker
+// instead of the tests.
+const hammerEnv = "CHAT_TUI_HAMMER"
+
+func TestMain(m *testing.M) {
+	if args := os.Getenv(hammerEnv); args != "" {
+		if err := hammer(strings.Split(args, "\n")); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func hammer(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("%s = %q, want db, conversation ID and worker", hammerEnv, args)
+	}
+	worker, err := strconv.Atoi(args[2])
+	if err != nil {
+		return err
+	}
+	m, err := storage.OpenManager(args[0])
+	if err != nil {
+		return err
+	}
+	return storetest.Hammer(m, args[1], worker, hammerMessages)
+}
+
+// TestProcesses has several processes write to one database at once, as
+// several chat-tui instances do.
+func TestProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared.db")
+	m, err := storage.OpenManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	convID, err := m.CreateConversation("Shared", "gpt-x", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmds := make([]*exec.Cmd, hammerProcs)
+	outputs := make([]strings.Builder, hammerProcs)
+	for i := range cmds {
+		cmds[i] = exec.Command(os.Args[0], "-test.run=^$")
+		cmds[i].Env = append(os.Environ(), fmt.Sprintf("%s=%s\n%s\n%d", hammerEnv, path, convID, i))
+		cmds[i].Stdout, cmds[i].Stderr = &outputs[i], &outputs[i]
+		if err := cmds[i].Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("process %d: %v: %s", i, err, strings.TrimSpace(outputs[i].String()))
+		}
+	}
+	if t.Failed() {
+		return
+	}
+	if err := storetest.CheckHammered(m, convID, hammerProcs, hammerMessages); err != nil {
+		t.Error(err)
+	}
+}
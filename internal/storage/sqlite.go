@@ -1,27 +1,86 @@
 package storage
 
 import (
+	"context"
+	"crypto/cipher"
 	"database/sql"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/sashabaranov/go-openai"
+	"github.com/evallife/chat-tui/internal/rag"
 	"github.com/evallife/chat-tui/internal/types"
 	_ "modernc.org/sqlite"
 )
 
 type Manager struct {
-	db *sql.DB
+	db   *sql.DB
+	path string
+
+	mu        sync.Mutex  // guards the encryption and watch state below
+	encrypted bool        // content is stored encrypted, see crypto.go
+	salt      []byte      // of the key, empty when unencrypted; nil until read
+	aead      cipher.AEAD // key for encrypted content; nil until unlocked
+
+	watch   *sql.Conn // connection that Changed reads data_version on
+	version int64
+
+	lock *os.File // shared while open; a restore needs it to itself
 }
 
 func NewManager() (*Manager, error) {
 	home, _ := os.UserHomeDir()
-	dbPath := filepath.Join(home, ".xftui.db")
-	db, err := sql.Open("sqlite", dbPath)
+	return OpenManager(filepath.Join(home, ".xftui.db"))
+}
+
+// OpenManager opens the SQLite store at dbPath.
+func OpenManager(dbPath string) (*Manager, error) {
+	db, err := openDB(dbPath)
 	if err != nil {
 		return nil, err
 	}
+	// Every instance holds a shared lock on a file next to the database, so
+	// that a restore can tell whether it is the only one.
+	lock, err := os.OpenFile(dbPath+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockShared(lock); err != nil {
+		return nil, err
+	}
+	m := &Manager{db: db, path: dbPath, lock: lock}
+	return m, m.loadEncryption()
+}
+
+// openDB opens the database at dbPath, creating and migrating it as needed.
+//
+// Several chat-tui instances may share the file, so it is kept in WAL mode,
+// where readers do not block the writer, and every connection waits up to
+// five seconds for a lock instead of failing with "database is locked".
+// Transactions take the write lock when they begin; a deferred transaction
+// that reads first can fail outright once another connection has written.
+func openDB(dbPath string) (db *sql.DB, err error) {
+	db, err = sql.Open("sqlite", "file:"+dbPath+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	opened := db
+	defer func() {
+		if err != nil {
+			_ = opened.Close()
+		}
+	}()
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return nil, err
+	}
 
 	// Create tables
 	query := `
@@ -44,6 +103,49 @@ func NewManager() (*Manager, error) {
 		id TEXT PRIMARY KEY,
 		name TEXT,
 		content TEXT
+	);
+	CREATE TABLE IF NOT EXISTS attachments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id INTEGER,
+		kind TEXT,
+		name TEXT,
+		content TEXT,
+		size INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(message_id) REFERENCES messages(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_attachments_message ON attachments(message_id);
+	CREATE TABLE IF NOT EXISTS collections (
+		id TEXT PRIMARY KEY,
+		name TEXT,
+		root TEXT,
+		model TEXT,
+		files INTEGER,
+		chunks INTEGER,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS chunks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		collection_id TEXT,
+		path TEXT,
+		start_line INTEGER,
+		end_line INTEGER,
+		content TEXT,
+		vector BLOB,
+		FOREIGN KEY(collection_id) REFERENCES collections(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_chunks_collection ON chunks(collection_id);
+	CREATE TABLE IF NOT EXISTS conversation_tags (
+		conversation_id TEXT,
+		tag TEXT,
+		PRIMARY KEY(conversation_id, tag),
+		FOREIGN KEY(conversation_id) REFERENCES conversations(id)
+	);
+	CREATE TABLE IF NOT EXISTS encryption (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		salt BLOB,
+		iterations INTEGER,
+		verifier BLOB
 	);`
 	_, err = db.Exec(query)
 	if err != nil {
@@ -52,22 +154,218 @@ func NewManager() (*Manager, error) {
 
 	// Migrate if needed
 	_, _ = db.Exec("ALTER TABLE conversations ADD COLUMN system_prompt TEXT")
+	_, _ = db.Exec("ALTER TABLE messages ADD COLUMN pinned INTEGER DEFAULT 0")
+	_, _ = db.Exec("ALTER TABLE messages ADD COLUMN summarized INTEGER DEFAULT 0")
+	_, _ = db.Exec("ALTER TABLE system_prompts ADD COLUMN is_default INTEGER DEFAULT 0")
+	_, _ = db.Exec("ALTER TABLE system_prompts ADD COLUMN kind TEXT DEFAULT 'system'")
+	_, _ = db.Exec("ALTER TABLE attachments ADD COLUMN mime TEXT DEFAULT ''")
+	_, _ = db.Exec("ALTER TABLE attachments ADD COLUMN data BLOB")
+	_, _ = db.Exec("ALTER TABLE attachments ADD COLUMN width INTEGER DEFAULT 0")
+	_, _ = db.Exec("ALTER TABLE attachments ADD COLUMN height INTEGER DEFAULT 0")
+	_, _ = db.Exec("ALTER TABLE conversations ADD COLUMN collection TEXT DEFAULT ''")
+	_, _ = db.Exec("ALTER TABLE conversations ADD COLUMN folder TEXT DEFAULT ''")
+	_, _ = db.Exec("ALTER TABLE conversations ADD COLUMN pinned INTEGER DEFAULT 0")
+	_, _ = db.Exec("ALTER TABLE conversations ADD COLUMN deleted_at DATETIME")
+	if _, err := db.Exec("ALTER TABLE conversations ADD COLUMN updated_at DATETIME"); err == nil {
+		// Backfill last activity from the newest message.
+		_, _ = db.Exec(`UPDATE conversations SET updated_at = COALESCE(
+			(SELECT MAX(created_at) FROM messages WHERE conversation_id = conversations.id), created_at)`)
+	}
+	// Built-in prompts are added once per database, including databases from
+	// before they were, so that deleting them all leaves none.
+	if version < promptsSeededVersion {
+		if err := seedPrompts(db, defaultPrompts()); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion)); err != nil {
+		return nil, err
+	}
 
-	return &Manager{db: db}, nil
+	return db, nil
 }
 
 func (m *Manager) CreateConversation(title, modelName, systemPrompt string) (string, error) {
 	id := uuid.New().String()
-	_, err := m.db.Exec("INSERT INTO conversations (id, title, model, system_prompt) VALUES (?, ?, ?, ?)", id, title, modelName, systemPrompt)
+	_, err := m.db.Exec("INSERT INTO conversations (id, title, model, system_prompt, updated_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)", id, title, modelName, systemPrompt)
 	return id, err
 }
 
-func (m *Manager) SaveMessage(convID, role, content string) error {
-	_, err := m.db.Exec("INSERT INTO messages (conversation_id, role, content) VALUES (?, ?, ?)", convID, role, content)
+func (m *Manager) SaveMessage(convID, role, content string) (int64, error) {
+	msg, err := m.AddMessage(convID, types.Message{Role: role, Content: content})
+	return msg.ID, err
+}
+
+// AddMessage stores msg together with its attachments and returns it with IDs filled in.
+func (m *Manager) AddMessage(convID string, msg types.Message) (types.Message, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return msg, err
+	}
+	aead, err := m.cipher(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return msg, err
+	}
+	res, err := tx.Exec("INSERT INTO messages (conversation_id, role, content, pinned) VALUES (?, ?, ?, ?)", convID, msg.Role, encryptString(aead, msg.Content), msg.Pinned)
+	if err != nil {
+		_ = tx.Rollback()
+		return msg, err
+	}
+	if msg.ID, err = res.LastInsertId(); err != nil {
+		_ = tx.Rollback()
+		return msg, err
+	}
+	if _, err := tx.Exec("UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", convID); err != nil {
+		_ = tx.Rollback()
+		return msg, err
+	}
+	for i := range msg.Attachments {
+		a := &msg.Attachments[i]
+		a.MessageID = msg.ID
+		res, err := tx.Exec("INSERT INTO attachments (message_id, kind, name, content, size, mime, data, width, height) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			a.MessageID, a.Kind, a.Name, encryptString(aead, a.Content), a.Size, a.MIME, encryptBytes(aead, a.Data), a.Width, a.Height)
+		if err != nil {
+			_ = tx.Rollback()
+			return msg, err
+		}
+		a.ID, _ = res.LastInsertId()
+	}
+	return msg, tx.Commit()
+}
+
+// ListMessages returns the messages of a conversation with their row IDs and flags.
+func (m *Manager) ListMessages(convID string) ([]types.Message, error) {
+	aead, err := m.cipher(m.db)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := m.db.Query("SELECT id, role, content, COALESCE(pinned, 0), COALESCE(summarized, 0), created_at FROM messages WHERE conversation_id = ? ORDER BY id ASC", convID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []types.Message
+	for rows.Next() {
+		var msg types.Message
+		if err := rows.Scan(&msg.ID, &msg.Role, &msg.Content, &msg.Pinned, &msg.Summarized, &msg.CreatedAt); err != nil {
+			return nil, err
+		}
+		if msg.Content, err = decryptString(aead, msg.Content); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return msgs, m.loadAttachments(aead, convID, msgs)
+}
+
+func (m *Manager) loadAttachments(aead cipher.AEAD, convID string, msgs []types.Message) error {
+	rows, err := m.db.Query(`SELECT a.id, a.message_id, a.kind, a.name, a.content, a.size,
+		COALESCE(a.mime, ''), a.data, COALESCE(a.width, 0), COALESCE(a.height, 0) FROM attachments a
+		JOIN messages msg ON msg.id = a.message_id WHERE msg.conversation_id = ? ORDER BY a.id ASC`, convID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]int, len(msgs))
+	for i, msg := range msgs {
+		byID[msg.ID] = i
+	}
+	for rows.Next() {
+		var a types.Attachment
+		if err := rows.Scan(&a.ID, &a.MessageID, &a.Kind, &a.Name, &a.Content, &a.Size, &a.MIME, &a.Data, &a.Width, &a.Height); err != nil {
+			return err
+		}
+		if a.Content, err = decryptString(aead, a.Content); err != nil {
+			return err
+		}
+		if a.Data, err = decryptBytes(aead, a.Data); err != nil {
+			return err
+		}
+		if i, ok := byID[a.MessageID]; ok {
+			msgs[i].Attachments = append(msgs[i].Attachments, a)
+		}
+	}
+	return rows.Err()
+}
+
+func (m *Manager) DeleteMessage(convID string, id int64) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM attachments WHERE message_id IN (SELECT id FROM messages WHERE conversation_id = ? AND id = ?)", convID, id); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM messages WHERE conversation_id = ? AND id = ?", convID, id); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteMessagesFrom removes the message with the given ID and everything after it.
+func (m *Manager) DeleteMessagesFrom(convID string, id int64) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM attachments WHERE message_id IN (SELECT id FROM messages WHERE conversation_id = ? AND id >= ?)", convID, id); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM messages WHERE conversation_id = ? AND id >= ?", convID, id); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *Manager) SetMessagePinned(convID string, id int64, pinned bool) error {
+	_, err := m.db.Exec("UPDATE messages SET pinned = ? WHERE conversation_id = ? AND id = ?", pinned, convID, id)
 	return err
 }
 
+// SaveSummary stores summary as a pinned system message and marks the covered
+// messages as summarized, so they are kept for display but no longer sent.
+func (m *Manager) SaveSummary(convID, summary string, covered []int64) (int64, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	aead, err := m.cipher(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	res, err := tx.Exec("INSERT INTO messages (conversation_id, role, content, pinned) VALUES (?, ?, ?, 1)", convID, openai.ChatMessageRoleSystem, encryptString(aead, summary))
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	for _, id := range covered {
+		if _, err := tx.Exec("UPDATE messages SET summarized = 1 WHERE conversation_id = ? AND id = ?", convID, id); err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
 func (m *Manager) GetMessages(convID string) ([]openai.ChatCompletionMessage, error) {
+	aead, err := m.cipher(m.db)
+	if err != nil {
+		return nil, err
+	}
 	rows, err := m.db.Query("SELECT role, content FROM messages WHERE conversation_id = ? ORDER BY id ASC", convID)
 	if err != nil {
 		return nil, err
@@ -80,18 +378,39 @@ func (m *Manager) GetMessages(convID string) ([]openai.ChatCompletionMessage, er
 		if err := rows.Scan(&msg.Role, &msg.Content); err != nil {
 			return nil, err
 		}
+		if msg.Content, err = decryptString(aead, msg.Content); err != nil {
+			return nil, err
+		}
 		msgs = append(msgs, msg)
 	}
 	return msgs, nil
 }
 
 type ConvSummary struct {
-	ID    string
-	Title string
+	ID        string
+	Title     string
+	Folder    string
+	Tags      []string
+	Pinned    bool
+	UpdatedAt time.Time
+	DeletedAt time.Time // zero unless the conversation is in the trash
 }
 
+// ListConversations returns pinned conversations first, then the rest by last
+// activity. Conversations in the trash are left out.
 func (m *Manager) ListConversations() ([]ConvSummary, error) {
-	rows, err := m.db.Query("SELECT id, title FROM conversations ORDER BY created_at DESC")
+	return m.listConversations("deleted_at IS NULL ORDER BY pinned DESC, updated_at DESC")
+}
+
+// ListTrash returns the deleted conversations, most recently deleted first.
+func (m *Manager) ListTrash() ([]ConvSummary, error) {
+	return m.listConversations("deleted_at IS NOT NULL ORDER BY deleted_at DESC")
+}
+
+func (m *Manager) listConversations(where string) ([]ConvSummary, error) {
+	rows, err := m.db.Query(`SELECT id, title, COALESCE(folder, ''), COALESCE(pinned, 0), updated_at, deleted_at,
+		COALESCE((SELECT GROUP_CONCAT(tag, ',') FROM conversation_tags t WHERE t.conversation_id = conversations.id), '')
+		FROM conversations WHERE ` + where)
 	if err != nil {
 		return nil, err
 	}
@@ -100,23 +419,76 @@ func (m *Manager) ListConversations() ([]ConvSummary, error) {
 	var convs []ConvSummary
 	for rows.Next() {
 		var c ConvSummary
-		if err := rows.Scan(&c.ID, &c.Title); err != nil {
+		var updated, deleted sql.NullTime
+		var tags string
+		if err := rows.Scan(&c.ID, &c.Title, &c.Folder, &c.Pinned, &updated, &deleted, &tags); err != nil {
 			return nil, err
 		}
+		c.UpdatedAt, c.DeletedAt = updated.Time, deleted.Time
+		c.Tags = splitTags(tags)
 		convs = append(convs, c)
 	}
 	return convs, nil
 }
 
+func splitTags(s string) []string {
+	if s == "" {
+		return nil
+	}
+	tags := strings.Split(s, ",")
+	sort.Strings(tags)
+	return tags
+}
+
+// SetConversationTags replaces the tags of a conversation.
+func (m *Manager) SetConversationTags(id string, tags []string) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM conversation_tags WHERE conversation_id = ?", id); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	for _, t := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO conversation_tags (conversation_id, tag) VALUES (?, ?)", id, t); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (m *Manager) SetConversationFolder(id, folder string) error {
+	_, err := m.db.Exec("UPDATE conversations SET folder = ? WHERE id = ?", folder, id)
+	return err
+}
+
+func (m *Manager) SetConversationPinned(id string, pinned bool) error {
+	_, err := m.db.Exec("UPDATE conversations SET pinned = ? WHERE id = ?", pinned, id)
+	return err
+}
+
+func (m *Manager) RenameConversation(id, title string) error {
+	_, err := m.db.Exec("UPDATE conversations SET title = ? WHERE id = ?", title, id)
+	return err
+}
+
 func (m *Manager) GetConversation(id string) (types.Conversation, error) {
 	var c types.Conversation
-	err := m.db.QueryRow("SELECT id, title, model, system_prompt FROM conversations WHERE id = ?", id).
-		Scan(&c.ID, &c.Title, &c.Model, &c.SystemPrompt)
+	var created, updated sql.NullTime
+	var tags string
+	err := m.db.QueryRow(`SELECT id, title, model, system_prompt, COALESCE(collection, ''), COALESCE(folder, ''), COALESCE(pinned, 0),
+		created_at, updated_at, COALESCE((SELECT GROUP_CONCAT(tag, ',') FROM conversation_tags t WHERE t.conversation_id = conversations.id), '')
+		FROM conversations WHERE id = ?`, id).
+		Scan(&c.ID, &c.Title, &c.Model, &c.SystemPrompt, &c.Collection, &c.Folder, &c.Pinned, &created, &updated, &tags)
+	c.CreatedAt, c.UpdatedAt = created.Time, updated.Time
+	c.Tags = splitTags(tags)
 	return c, err
 }
 
 func (m *Manager) ListSystemPrompts() ([]types.SystemPrompt, error) {
-	rows, err := m.db.Query("SELECT id, name, content FROM system_prompts")
+	rows, err := m.db.Query("SELECT id, name, content, COALESCE(is_default, 0), COALESCE(kind, 'system') FROM system_prompts ORDER BY rowid")
 	if err != nil {
 		return nil, err
 	}
@@ -124,39 +496,407 @@ func (m *Manager) ListSystemPrompts() ([]types.SystemPrompt, error) {
 	var prompts []types.SystemPrompt
 	for rows.Next() {
 		var p types.SystemPrompt
-		if err := rows.Scan(&p.ID, &p.Name, &p.Content); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.Content, &p.IsDefault, &p.Kind); err != nil {
 			return nil, err
 		}
 		prompts = append(prompts, p)
 	}
-	// Add default ones if empty
-	if len(prompts) == 0 {
-		defaults := []types.SystemPrompt{
-			{ID: "default", Name: "Default Chat", Content: ""},
-			{ID: "translator", Name: "Translator (ZH-EN)", Content: "You are a professional translator. Translate between Chinese and English."},
-			{ID: "coder", Name: "Code Expert", Content: "You are an expert software engineer. Provide concise and accurate code solutions."},
+	return prompts, rows.Err()
+}
+
+// seedPrompts inserts prompts in one transaction, leaving out any that
+// another instance seeded in the meantime.
+func seedPrompts(db *sql.DB, prompts []types.SystemPrompt) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, p := range prompts {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO system_prompts (id, name, content, kind) VALUES (?, ?, ?, ?)", p.ID, p.Name, p.Content, p.Kind); err != nil {
+			_ = tx.Rollback()
+			return err
 		}
-		for _, p := range defaults {
-			_, _ = m.db.Exec("INSERT INTO system_prompts (id, name, content) VALUES (?, ?, ?)", p.ID, p.Name, p.Content)
+	}
+	return tx.Commit()
+}
+
+// SaveSystemPrompt inserts or updates a prompt, assigning an ID to new ones.
+// Marking a prompt as default clears the flag on all others.
+func (m *Manager) SaveSystemPrompt(p types.SystemPrompt) (types.SystemPrompt, error) {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	if p.Kind == "" {
+		p.Kind = types.PromptKindSystem
+	}
+	if p.Kind != types.PromptKindSystem {
+		p.IsDefault = false
+	}
+	tx, err := m.db.Begin()
+	if err != nil {
+		return p, err
+	}
+	if p.IsDefault {
+		if _, err := tx.Exec("UPDATE system_prompts SET is_default = 0"); err != nil {
+			_ = tx.Rollback()
+			return p, err
 		}
-		return defaults, nil
 	}
-	return prompts, nil
+	_, err = tx.Exec(`INSERT INTO system_prompts (id, name, content, is_default, kind) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET name = excluded.name, content = excluded.content, is_default = excluded.is_default, kind = excluded.kind`,
+		p.ID, p.Name, p.Content, p.IsDefault, p.Kind)
+	if err != nil {
+		_ = tx.Rollback()
+		return p, err
+	}
+	return p, tx.Commit()
+}
+
+func (m *Manager) DeleteSystemPrompt(id string) error {
+	_, err := m.db.Exec("DELETE FROM system_prompts WHERE id = ?", id)
+	return err
+}
+
+// SetDefaultSystemPrompt makes id the prompt for new chats; an empty id clears it.
+func (m *Manager) SetDefaultSystemPrompt(id string) error {
+	_, err := m.db.Exec("UPDATE system_prompts SET is_default = (id = ? AND COALESCE(kind, 'system') = 'system')", id)
+	return err
+}
+
+// DefaultSystemPrompt returns the content of the default prompt and whether one is set.
+func (m *Manager) DefaultSystemPrompt() (string, bool, error) {
+	var content string
+	err := m.db.QueryRow("SELECT content FROM system_prompts WHERE is_default = 1 LIMIT 1").Scan(&content)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	return content, err == nil, err
+}
+
+func (m *Manager) SetConversationSystemPrompt(convID, prompt string) error {
+	_, err := m.db.Exec("UPDATE conversations SET system_prompt = ? WHERE id = ?", prompt, convID)
+	return err
 }
 
 
+// DeleteConversation moves a conversation to the trash.
 func (m *Manager) DeleteConversation(convID string) error {
+	return m.DeleteConversations([]string{convID})
+}
+
+// DeleteConversations moves conversations to the trash, from where
+// RestoreConversations brings them back until they are purged.
+func (m *Manager) DeleteConversations(ids []string) error {
+	return m.execEach("UPDATE conversations SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", ids)
+}
+
+func (m *Manager) RestoreConversations(ids []string) error {
+	return m.execEach("UPDATE conversations SET deleted_at = NULL WHERE id = ?", ids)
+}
+
+// execEach runs query once per ID in a single transaction.
+func (m *Manager) execEach(query string, ids []string) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := tx.Exec(query, id); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// PurgeConversations permanently removes conversations with their messages, attachments and tags.
+func (m *Manager) PurgeConversations(ids []string) error {
 	tx, err := m.db.Begin()
 	if err != nil {
 		return err
 	}
-	if _, err := tx.Exec("DELETE FROM messages WHERE conversation_id = ?", convID); err != nil {
+	if err := purge(tx, ids); err != nil {
 		_ = tx.Rollback()
 		return err
 	}
-	if _, err := tx.Exec("DELETE FROM conversations WHERE id = ?", convID); err != nil {
+	return tx.Commit()
+}
+
+func purge(tx *sql.Tx, ids []string) error {
+	for _, id := range ids {
+		for _, q := range []string{
+			"DELETE FROM attachments WHERE message_id IN (SELECT id FROM messages WHERE conversation_id = ?)",
+			"DELETE FROM messages WHERE conversation_id = ?",
+			"DELETE FROM conversation_tags WHERE conversation_id = ?",
+			"DELETE FROM conversations WHERE id = ?",
+		} {
+			if _, err := tx.Exec(q, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PurgeTrash permanently removes conversations that were deleted more than
+// olderThan ago and returns how many there were. The selection and the purge
+// share a transaction, so a conversation that another instance restores in
+// between is left alone.
+func (m *Manager) PurgeTrash(olderThan time.Duration) (int, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	ids, err := trashedBefore(tx, olderThan)
+	if err == nil {
+		err = purge(tx, ids)
+	}
+	if err != nil {
 		_ = tx.Rollback()
+		return 0, err
+	}
+	return len(ids), tx.Commit()
+}
+
+func trashedBefore(tx *sql.Tx, olderThan time.Duration) ([]string, error) {
+	rows, err := tx.Query("SELECT id FROM conversations WHERE deleted_at IS NOT NULL AND deleted_at < datetime('now', ?)",
+		fmt.Sprintf("-%d seconds", int64(olderThan.Seconds())))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Changed reports whether anything was committed to the database since the
+// previous call, whether by this store or by another process such as a second
+// chat-tui. The first call only takes note of the current state.
+func (m *Manager) Changed() (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx := context.Background()
+	first := m.watch == nil
+	if first {
+		// data_version only moves for commits made through other
+		// connections, so it is read on one that is never used to write.
+		conn, err := m.db.Conn(ctx)
+		if err != nil {
+			return false, err
+		}
+		m.watch = conn
+	}
+	var version int64
+	if err := m.watch.QueryRowContext(ctx, "PRAGMA data_version").Scan(&version); err != nil {
+		return false, err
+	}
+	changed := !first && version != m.version
+	m.version = version
+	return changed, nil
+}
+
+// closeWatch releases the connection held by Changed. m.mu must be held.
+func (m *Manager) closeWatch() {
+	if m.watch != nil {
+		_ = m.watch.Close()
+		m.watch = nil
+	}
+}
+
+// HasConversation reports whether a conversation with id exists, in the trash or not.
+func (m *Manager) HasConversation(id string) (bool, error) {
+	var n int
+	err := m.db.QueryRow("SELECT COUNT(*) FROM conversations WHERE id = ?", id).Scan(&n)
+	return n > 0, err
+}
+
+// ImportConversation stores c with its messages, attachments and tags, keeping
+// its ID and timestamps. It fails if a conversation with the same ID exists.
+func (m *Manager) ImportConversation(c types.Conversation) error {
+	return m.importConversation(c, false)
+}
+
+// ReplaceConversation stores c like ImportConversation, first removing the
+// conversation with the same ID in the same transaction, so that a failed
+// import leaves the old one in place.
+func (m *Manager) ReplaceConversation(c types.Conversation) error {
+	return m.importConversation(c, true)
+}
+
+func (m *Manager) importConversation(c types.Conversation, replace bool) error {
+	tx, err := m.db.Begin()
+	if err != nil {
 		return err
 	}
+	fail := func(err error) error {
+		_ = tx.Rollback()
+		return err
+	}
+	aead, err := m.cipher(tx)
+	if err != nil {
+		return fail(err)
+	}
+	if replace {
+		if err := purge(tx, []string{c.ID}); err != nil {
+			return fail(err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO conversations (id, title, model, system_prompt, collection, folder, pinned, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, c.Title, c.Model, c.SystemPrompt, c.Collection, c.Folder, c.Pinned, sqlTime(c.CreatedAt), sqlTime(c.UpdatedAt)); err != nil {
+		return fail(err)
+	}
+	for _, t := range c.Tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO conversation_tags (conversation_id, tag) VALUES (?, ?)", c.ID, t); err != nil {
+			return fail(err)
+		}
+	}
+	for _, msg := range c.Messages {
+		res, err := tx.Exec("INSERT INTO messages (conversation_id, role, content, pinned, summarized, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+			c.ID, msg.Role, encryptString(aead, msg.Content), msg.Pinned, msg.Summarized, sqlTime(msg.CreatedAt))
+		if err != nil {
+			return fail(err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fail(err)
+		}
+		for _, a := range msg.Attachments {
+			if _, err := tx.Exec("INSERT INTO attachments (message_id, kind, name, content, size, mime, data, width, height) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+				id, a.Kind, a.Name, encryptString(aead, a.Content), a.Size, a.MIME, encryptBytes(aead, a.Data), a.Width, a.Height); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// sqlTime formats t the way CURRENT_TIMESTAMP does, so imported rows sort and
+// compare with the rest; a zero time becomes the current time.
+func sqlTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// SetConversationCollection sets the collection retrieved from for a conversation; empty turns retrieval off.
+func (m *Manager) SetConversationCollection(convID, collectionID string) error {
+	_, err := m.db.Exec("UPDATE conversations SET collection = ? WHERE id = ?", collectionID, convID)
+	return err
+}
+
+func (m *Manager) ListCollections() ([]types.Collection, error) {
+	rows, err := m.db.Query("SELECT id, name, root, model, files, chunks, updated_at FROM collections ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []types.Collection
+	for rows.Next() {
+		var c types.Collection
+		if err := rows.Scan(&c.ID, &c.Name, &c.Root, &c.Model, &c.Files, &c.Chunks, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	return cols, rows.Err()
+}
+
+// SaveCollection stores c with its chunks, replacing the chunks of an earlier
+// index with the same ID. A new ID is generated when c has none.
+func (m *Manager) SaveCollection(c types.Collection, chunks []types.Chunk) (types.Collection, error) {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	c.Chunks = len(chunks)
+	tx, err := m.db.Begin()
+	if err != nil {
+		return c, err
+	}
+	aead, err := m.cipher(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return c, err
+	}
+	if _, err := tx.Exec("DELETE FROM chunks WHERE collection_id = ?", c.ID); err != nil {
+		_ = tx.Rollback()
+		return c, err
+	}
+	if _, err := tx.Exec(`INSERT INTO collections (id, name, root, model, files, chunks, updated_at) VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(id) DO UPDATE SET name = excluded.name, root = excluded.root, model = excluded.model,
+		files = excluded.files, chunks = excluded.chunks, updated_at = CURRENT_TIMESTAMP`,
+		c.ID, c.Name, c.Root, c.Model, c.Files, c.Chunks); err != nil {
+		_ = tx.Rollback()
+		return c, err
+	}
+	stmt, err := tx.Prepare("INSERT INTO chunks (collection_id, path, start_line, end_line, content, vector) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		_ = tx.Rollback()
+		return c, err
+	}
+	defer stmt.Close()
+	for _, ch := range chunks {
+		if _, err := stmt.Exec(c.ID, ch.Path, ch.StartLine, ch.EndLine, encryptString(aead, ch.Content), encryptBytes(aead, rag.EncodeVector(ch.Vector))); err != nil {
+			_ = tx.Rollback()
+			return c, err
+		}
+	}
+	return c, tx.Commit()
+}
+
+// CollectionChunks loads all chunks of a collection, vectors included.
+func (m *Manager) CollectionChunks(collectionID string) ([]types.Chunk, error) {
+	aead, err := m.cipher(m.db)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := m.db.Query("SELECT path, start_line, end_line, content, vector FROM chunks WHERE collection_id = ? ORDER BY id", collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var chunks []types.Chunk
+	for rows.Next() {
+		var ch types.Chunk
+		var vec []byte
+		if err := rows.Scan(&ch.Path, &ch.StartLine, &ch.EndLine, &ch.Content, &vec); err != nil {
+			return nil, err
+		}
+		if ch.Content, err = decryptString(aead, ch.Content); err != nil {
+			return nil, err
+		}
+		if vec, err = decryptBytes(aead, vec); err != nil {
+			return nil, err
+		}
+		ch.Vector = rag.DecodeVector(vec)
+		chunks = append(chunks, ch)
+	}
+	return chunks, rows.Err()
+}
+
+// DeleteCollection removes a collection and turns retrieval off where it was used.
+func (m *Manager) DeleteCollection(id string) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, q := range []string{
+		"DELETE FROM chunks WHERE collection_id = ?",
+		"DELETE FROM collections WHERE id = ?",
+		"UPDATE conversations SET collection = '' WHERE collection = ?",
+	} {
+		if _, err := tx.Exec(q, id); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
 	return tx.Commit()
 }
@@ -0,0 +1,47 @@
+package storage_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/storage/storetest"
+)
+
+func TestManager(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storage.Store {
+		m, err := storage.OpenManager(filepath.Join(t.TempDir(), "chat.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	})
+}
+
+// TestManagerUpgradePrompts opens a database made by the first release,
+// which created the prompts table empty and filled it when first listed.
+func TestManagerUpgradePrompts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+	CREATE TABLE conversations (id TEXT PRIMARY KEY, title TEXT, model TEXT, system_prompt TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);
+	CREATE TABLE messages (id INTEGER PRIMARY KEY AUTOINCREMENT, conversation_id TEXT, role TEXT, content TEXT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);
+	CREATE TABLE system_prompts (id TEXT PRIMARY KEY, name TEXT, content TEXT);`)
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = storetest.CheckUpgradedPrompts(func() (storage.Store, error) {
+		return storage.OpenManager(path)
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// Store keeps conversations with their messages, the system prompt library
+// and retrieval indexes. Manager (SQLite) is the default; FileStore keeps
+// plain files that can live in git.
+type Store interface {
+	CreateConversation(title, modelName, systemPrompt string) (string, error)
+	GetConversation(id string) (types.Conversation, error)
+	HasConversation(id string) (bool, error)
+	// ListConversations returns pinned conversations first, then the rest by
+	// last activity, leaving out the trash. A store that cannot read some
+	// conversations returns the others along with the error.
+	ListConversations() ([]ConvSummary, error)
+	RenameConversation(id, title string) error
+	SetConversationSystemPrompt(convID, prompt string) error
+	SetConversationCollection(convID, collectionID string) error
+	SetConversationTags(id string, tags []string) error
+	SetConversationFolder(id, folder string) error
+	SetConversationPinned(id string, pinned bool) error
+	// ImportConversation stores c with its messages, keeping its ID and
+	// timestamps; it fails if the ID is taken.
+	ImportConversation(c types.Conversation) error
+	// ReplaceConversation is ImportConversation replacing the conversation
+	// with the same ID, if any, in one step.
+	ReplaceConversation(c types.Conversation) error
+
+	DeleteConversation(convID string) error
+	DeleteConversations(ids []string) error
+	RestoreConversations(ids []string) error
+	// ListTrash returns the deleted conversations, most recently deleted first.
+	ListTrash() ([]ConvSummary, error)
+	PurgeConversations(ids []string) error
+	PurgeTrash(olderThan time.Duration) (int, error)
+
+	SaveMessage(convID, role, content string) (int64, error)
+	AddMessage(convID string, msg types.Message) (types.Message, error)
+	ListMessages(convID string) ([]types.Message, error)
+	GetMessages(convID string) ([]openai.ChatCompletionMessage, error)
+	DeleteMessage(convID string, id int64) error
+	DeleteMessagesFrom(convID string, id int64) error
+	SetMessagePinned(convID string, id int64, pinned bool) error
+	SaveSummary(convID, summary string, covered []int64) (int64, error)
+
+	// ListSystemPrompts returns the prompt library. The built-in prompts are
+	// added once, when the store is created.
+	ListSystemPrompts() ([]types.SystemPrompt, error)
+	SaveSystemPrompt(p types.SystemPrompt) (types.SystemPrompt, error)
+	DeleteSystemPrompt(id string) error
+	SetDefaultSystemPrompt(id string) error
+	DefaultSystemPrompt() (string, bool, error)
+
+	ListCollections() ([]types.Collection, error)
+	SaveCollection(c types.Collection, chunks []types.Chunk) (types.Collection, error)
+	CollectionChunks(collectionID string) ([]types.Chunk, error)
+	DeleteCollection(id string) error
+}
+
+// BackupStore is implemented by stores kept in a single database file.
+type BackupStore interface {
+	Path() string
+	Backup(dest string) error
+	BackupTo(dir, prefix string) (string, error)
+	Restore(src, backupDir string) error
+	AutoBackup(dir string, keep int) (string, error)
+}
+
+// EncryptedStore is implemented by stores that can encrypt content at rest.
+type EncryptedStore interface {
+	Encrypted() bool
+	Locked() bool
+	Unlock(passphrase string) error
+	EnableEncryption(passphrase string) error
+	DisableEncryption() error
+}
+
+// WatchedStore is implemented by stores that can tell when they were written
+// to, so that the UI picks up changes made by another instance.
+type WatchedStore interface {
+	Changed() (bool, error)
+}
+
+var (
+	_ Store          = (*Manager)(nil)
+	_ BackupStore    = (*Manager)(nil)
+	_ EncryptedStore = (*Manager)(nil)
+	_ WatchedStore   = (*Manager)(nil)
+	_ Store          = (*FileStore)(nil)
+	_ WatchedStore   = (*FileStore)(nil)
+)
+
+// Encrypted reports whether s stores content encrypted.
+func Encrypted(s Store) bool {
+	enc, ok := s.(EncryptedStore)
+	return ok && enc.Encrypted()
+}
+
+// Locked reports whether s is encrypted and still waits for its passphrase.
+func Locked(s Store) bool {
+	enc, ok := s.(EncryptedStore)
+	return ok && enc.Locked()
+}
+
+// Open opens the store chosen in the config.
+func Open(cfg types.Config) (Store, error) {
+	switch cfg.Storage {
+	case "", types.StorageSQLite:
+		return NewManager()
+	case types.StorageFiles:
+		dir := cfg.StorageDir
+		if dir == "" {
+			dir = FilesDir()
+		}
+		if rest, ok := strings.CutPrefix(dir, "~"); ok {
+			home, _ := os.UserHomeDir()
+			dir = filepath.Join(home, rest)
+		}
+		return NewFileStore(dir)
+	}
+	return nil, fmt.Errorf("unknown storage %q, expected %q or %q", cfg.Storage, types.StorageSQLite, types.StorageFiles)
+}
+
+// defaultPrompts are seeded into a new prompt library.
+func defaultPrompts() []types.SystemPrompt {
+	prompts := []types.SystemPrompt{
+		{ID: "default", Name: "Default Chat", Content: ""},
+		{ID: "translator", Name: "Translator (ZH-EN)", Content: "You are a professional translator. Translate between Chinese and English."},
+		{ID: "coder", Name: "Code Expert", Content: "You are an expert software engineer. Provide concise and accurate code solutions."},
+		{ID: "review", Name: "Code Review", Kind: types.PromptKindTemplate, Content: "Review the following {{language}} code for bugs, readability and performance. Focus on: {{focus}}\n\n```\n{{code}}\n```"},
+		{ID: "translate", Name: "Translate", Kind: types.PromptKindTemplate, Content: "Translate the following text into {{target_language}}, keeping formatting intact:\n\n{{text}}"},
+		{ID: "commit", Name: "Commit Message", Kind: types.PromptKindTemplate, Content: "Write a concise conventional commit message for this diff ({{date}}):\n\n```diff\n{{diff}}\n```"},
+	}
+	for i := range prompts {
+		if prompts[i].Kind == "" {
+			prompts[i].Kind = types.PromptKindSystem
+		}
+	}
+	return prompts
+}
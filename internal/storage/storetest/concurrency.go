@@ -0,0 +1,111 @@
+package storetest
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/evallife/chat-tui/internal/storage"
+)
+
+// Hammer writes to s as one of several concurrent workers, goroutines or
+// processes: it adds n messages to convID, interleaved with the reads and
+// small updates the UI makes meanwhile, and edits a conversation of its own.
+func Hammer(s storage.Store, convID string, worker, n int) error {
+	own, err := s.CreateConversation(fmt.Sprintf("worker %d", worker), "gpt-x", "")
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if _, err := s.SaveMessage(convID, "user", hammerText(worker, i)); err != nil {
+			return fmt.Errorf("SaveMessage: %w", err)
+		}
+		if _, err := s.ListMessages(convID); err != nil {
+			return fmt.Errorf("ListMessages: %w", err)
+		}
+		if _, err := s.ListConversations(); err != nil {
+			return fmt.Errorf("ListConversations: %w", err)
+		}
+		if err := s.SetConversationPinned(convID, i%2 == 0); err != nil {
+			return fmt.Errorf("SetConversationPinned: %w", err)
+		}
+		if err := s.SetConversationTags(own, []string{"hammer", fmt.Sprint(i)}); err != nil {
+			return fmt.Errorf("SetConversationTags: %w", err)
+		}
+	}
+	if err := s.DeleteConversations([]string{own}); err != nil {
+		return fmt.Errorf("DeleteConversations: %w", err)
+	}
+	return s.RestoreConversations([]string{own})
+}
+
+func hammerText(worker, i int) string {
+	return fmt.Sprintf("worker %d message %d", worker, i)
+}
+
+// CheckHammered checks that every message of workers Hammer calls with n
+// messages each arrived exactly once and in order per worker, and that every
+// worker's own conversation is intact.
+func CheckHammered(s storage.Store, convID string, workers, n int) error {
+	c := &checker{}
+	msgs, err := s.ListMessages(convID)
+	if !c.ok(err, "ListMessages") {
+		return c.err()
+	}
+	c.equal("number of messages", len(msgs), workers*n)
+	seen := make(map[string]bool)
+	next := make([]int, workers)
+	for i, m := range msgs {
+		if i > 0 && m.ID <= msgs[i-1].ID {
+			c.errorf("message IDs out of order: %d after %d", m.ID, msgs[i-1].ID)
+		}
+		if seen[m.Content] {
+			c.errorf("message %q stored twice", m.Content)
+		}
+		seen[m.Content] = true
+		var w, j int
+		if _, err := fmt.Sscanf(m.Content, "worker %d message %d", &w, &j); err != nil || w < 0 || w >= workers {
+			c.errorf("unexpected message %q", m.Content)
+			continue
+		}
+		if j != next[w] {
+			c.errorf("worker %d: message %d stored where %d was expected", w, j, next[w])
+		}
+		next[w] = j + 1
+	}
+
+	convs, err := s.ListConversations()
+	if !c.ok(err, "ListConversations") {
+		return c.err()
+	}
+	c.equal("number of conversations", len(convs), workers+1)
+	for _, conv := range convs {
+		if conv.ID != convID && !slices.Equal(conv.Tags, []string{fmt.Sprint(n - 1), "hammer"}) {
+			c.errorf("%s: tags = %q", conv.Title, conv.Tags)
+		}
+	}
+	return c.err()
+}
+
+// checkConcurrent hammers the store from several goroutines at once.
+func checkConcurrent(c *checker, s storage.Store) {
+	const workers, n = 8, 20
+	id, err := s.CreateConversation("Shared", "gpt-x", "")
+	if !c.ok(err, "CreateConversation") {
+		return
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[w] = Hammer(s, id, w, n)
+		}()
+	}
+	wg.Wait()
+	for w, err := range errs {
+		c.ok(err, fmt.Sprintf("worker %d", w))
+	}
+	c.ok(CheckHammered(s, id, workers, n), "CheckHammered")
+}
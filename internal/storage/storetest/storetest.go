@@ -0,0 +1,513 @@
+// Package storetest is a conformance suite for storage.Store. Every backend
+// is held to the behaviour of the SQLite store; each one runs it from its own
+// test.
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// checker collects the failures of one check.
+type checker struct {
+	errs []error
+}
+
+func (c *checker) errorf(format string, args ...any) {
+	c.errs = append(c.errs, fmt.Errorf(format, args...))
+}
+
+// ok records err and reports whether there was none.
+func (c *checker) ok(err error, what string) bool {
+	if err != nil {
+		c.errorf("%s: %v", what, err)
+		return false
+	}
+	return true
+}
+
+// err returns the failures as one error, nil when there were none.
+func (c *checker) err() error {
+	return errors.Join(c.errs...)
+}
+
+func (c *checker) equal(what string, got, want any) {
+	if !reflect.DeepEqual(got, want) {
+		c.errorf("%s = %#v, want %#v", what, got, want)
+	}
+}
+
+var checks = []struct {
+	name string
+	fn   func(c *checker, s storage.Store)
+}{
+	{"conversations", checkConversations},
+	{"order", checkOrder},
+	{"messages", checkMessages},
+	{"attachments", checkAttachments},
+	{"summary", checkSummary},
+	{"trash", checkTrash},
+	{"import", checkImport},
+	{"prompts", checkPrompts},
+	{"collections", checkCollections},
+	{"concurrent", checkConcurrent},
+}
+
+// Run runs every check as a subtest of t against a new, empty store from
+// newStore.
+func Run(t *testing.T, newStore func(t *testing.T) storage.Store) {
+	for _, check := range checks {
+		t.Run(check.name, func(t *testing.T) {
+			c := &checker{}
+			check.fn(c, newStore(t))
+			for _, err := range c.errs {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func checkConversations(c *checker, s storage.Store) {
+	id, err := s.CreateConversation("First", "gpt-x", "Be brief.")
+	if !c.ok(err, "CreateConversation") {
+		return
+	}
+	conv, err := s.GetConversation(id)
+	if !c.ok(err, "GetConversation") {
+		return
+	}
+	c.equal("title", conv.Title, "First")
+	c.equal("model", conv.Model, "gpt-x")
+	c.equal("system prompt", conv.SystemPrompt, "Be brief.")
+	if conv.CreatedAt.IsZero() || conv.UpdatedAt.IsZero() {
+		c.errorf("timestamps not set: %v, %v", conv.CreatedAt, conv.UpdatedAt)
+	}
+
+	c.ok(s.RenameConversation(id, "Renamed"), "RenameConversation")
+	c.ok(s.SetConversationSystemPrompt(id, "Be verbose."), "SetConversationSystemPrompt")
+	c.ok(s.SetConversationCollection(id, "col"), "SetConversationCollection")
+	c.ok(s.SetConversationFolder(id, "work"), "SetConversationFolder")
+	c.ok(s.SetConversationPinned(id, true), "SetConversationPinned")
+	c.ok(s.SetConversationTags(id, []string{"go", "bug", "go"}), "SetConversationTags")
+	if conv, err = s.GetConversation(id); c.ok(err, "GetConversation") {
+		c.equal("title", conv.Title, "Renamed")
+		c.equal("system prompt", conv.SystemPrompt, "Be verbose.")
+		c.equal("collection", conv.Collection, "col")
+		c.equal("folder", conv.Folder, "work")
+		c.equal("pinned", conv.Pinned, true)
+		c.equal("tags", conv.Tags, []string{"bug", "go"})
+	}
+
+	if has, err := s.HasConversation(id); c.ok(err, "HasConversation") && !has {
+		c.errorf("HasConversation(%s) = false", id)
+	}
+	if has, err := s.HasConversation("missing"); c.ok(err, "HasConversation") && has {
+		c.errorf("HasConversation(missing) = true")
+	}
+	if _, err := s.GetConversation("missing"); err == nil {
+		c.errorf("GetConversation(missing) did not fail")
+	}
+	if list, err := s.ListConversations(); c.ok(err, "ListConversations") {
+		if len(list) != 1 {
+			c.errorf("ListConversations returned %d conversations, want 1", len(list))
+		} else {
+			c.equal("summary", []any{list[0].ID, list[0].Title, list[0].Folder, list[0].Tags, list[0].Pinned}, []any{id, "Renamed", "work", []string{"bug", "go"}, true})
+		}
+	}
+}
+
+func checkOrder(c *checker, s storage.Store) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, id := range []string{"old", "new", "pinned"} {
+		conv := types.Conversation{ID: id, Title: id, CreatedAt: base, UpdatedAt: base.Add(time.Duration(i) * time.Hour)}
+		if id == "pinned" {
+			conv.UpdatedAt, conv.Pinned = base.Add(-time.Hour), true
+		}
+		if !c.ok(s.ImportConversation(conv), "ImportConversation") {
+			return
+		}
+	}
+	list, err := s.ListConversations()
+	if !c.ok(err, "ListConversations") {
+		return
+	}
+	var ids []string
+	for _, conv := range list {
+		ids = append(ids, conv.ID)
+	}
+	c.equal("order", ids, []string{"pinned", "new", "old"})
+	if len(list) == 3 {
+		c.equal("updated at", list[1].UpdatedAt.UTC(), base.Add(time.Hour))
+	}
+}
+
+func checkMessages(c *checker, s storage.Store) {
+	id, err := s.CreateConversation("Chat", "m", "")
+	if !c.ok(err, "CreateConversation") {
+		return
+	}
+	var ids []int64
+	for _, content := range []string{"one", "two", "three", "four"} {
+		role := openai.ChatMessageRoleUser
+		if len(ids)%2 == 1 {
+			role = openai.ChatMessageRoleAssistant
+		}
+		msgID, err := s.SaveMessage(id, role, content)
+		if !c.ok(err, "SaveMessage") {
+			return
+		}
+		if msgID == 0 || slices.Contains(ids, msgID) {
+			c.errorf("SaveMessage returned ID %d after %v", msgID, ids)
+		}
+		ids = append(ids, msgID)
+	}
+
+	msgs, err := s.ListMessages(id)
+	if !c.ok(err, "ListMessages") || len(msgs) != 4 {
+		c.errorf("ListMessages returned %d messages, want 4", len(msgs))
+		return
+	}
+	for i, m := range msgs {
+		c.equal("message ID", m.ID, ids[i])
+		if m.CreatedAt.IsZero() {
+			c.errorf("message %d has no time", m.ID)
+		}
+	}
+	c.equal("content", []string{msgs[0].Content, msgs[1].Content}, []string{"one", "two"})
+	c.equal("role", msgs[1].Role, openai.ChatMessageRoleAssistant)
+
+	if chat, err := s.GetMessages(id); c.ok(err, "GetMessages") && len(chat) == 4 {
+		c.equal("GetMessages", chat[3], openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "four"})
+	}
+
+	c.ok(s.SetMessagePinned(id, ids[0], true), "SetMessagePinned")
+	c.ok(s.DeleteMessage(id, ids[1]), "DeleteMessage")
+	if msgs, err = s.ListMessages(id); c.ok(err, "ListMessages") && len(msgs) == 3 {
+		c.equal("pinned", msgs[0].Pinned, true)
+		c.equal("after delete", msgs[1].Content, "three")
+	} else {
+		c.errorf("%d messages after DeleteMessage, want 3", len(msgs))
+	}
+	c.ok(s.DeleteMessagesFrom(id, ids[2]), "DeleteMessagesFrom")
+	if msgs, err = s.ListMessages(id); c.ok(err, "ListMessages") {
+		c.equal("messages after DeleteMessagesFrom", len(msgs), 1)
+	}
+
+	if conv, err := s.GetConversation(id); c.ok(err, "GetConversation") && conv.UpdatedAt.IsZero() {
+		c.errorf("last activity not set")
+	}
+	if msgs, err := s.ListMessages("missing"); c.ok(err, "ListMessages(missing)") {
+		c.equal("messages of a missing conversation", len(msgs), 0)
+	}
+}
+
+func checkAttachments(c *checker, s storage.Store) {
+	id, err := s.CreateConversation("Files", "m", "")
+	if !c.ok(err, "CreateConversation") {
+		return
+	}
+	attachments := func() []types.Attachment {
+		return []types.Attachment{
+			{Kind: types.AttachmentFile, Name: "main.go", Content: "package main", Size: 12},
+			{Kind: types.AttachmentImage, Name: "a.png", MIME: "image/png", Data: []byte{0x89, 'P', 'N', 'G'}, Size: 4, Width: 2, Height: 3},
+		}
+	}
+	out, err := s.AddMessage(id, types.Message{Role: openai.ChatMessageRoleUser, Content: "see attached", Attachments: attachments()})
+	if !c.ok(err, "AddMessage") {
+		return
+	}
+	if out.ID == 0 || len(out.Attachments) != 2 || out.Attachments[0].ID == 0 || out.Attachments[0].ID == out.Attachments[1].ID {
+		c.errorf("AddMessage did not fill in IDs: %+v", out)
+		return
+	}
+	c.equal("attachment message ID", out.Attachments[1].MessageID, out.ID)
+
+	msgs, err := s.ListMessages(id)
+	if !c.ok(err, "ListMessages") || len(msgs) != 1 || len(msgs[0].Attachments) != 2 {
+		c.errorf("attachments not listed: %+v", msgs)
+		return
+	}
+	got := msgs[0].Attachments
+	for i := range got {
+		got[i].ID, got[i].MessageID = 0, 0
+	}
+	c.equal("attachments", got, attachments())
+}
+
+func checkSummary(c *checker, s storage.Store) {
+	id, err := s.CreateConversation("Long", "m", "")
+	if !c.ok(err, "CreateConversation") {
+		return
+	}
+	a, _ := s.SaveMessage(id, openai.ChatMessageRoleUser, "q")
+	b, _ := s.SaveMessage(id, openai.ChatMessageRoleAssistant, "a")
+	sumID, err := s.SaveSummary(id, "summary", []int64{a, b})
+	if !c.ok(err, "SaveSummary") {
+		return
+	}
+	msgs, err := s.ListMessages(id)
+	if !c.ok(err, "ListMessages") || len(msgs) != 3 {
+		c.errorf("%d messages after SaveSummary, want 3", len(msgs))
+		return
+	}
+	c.equal("summarized", []bool{msgs[0].Summarized, msgs[1].Summarized}, []bool{true, true})
+	c.equal("summary", []any{msgs[2].ID, msgs[2].Role, msgs[2].Content, msgs[2].Pinned}, []any{sumID, openai.ChatMessageRoleSystem, "summary", true})
+}
+
+func checkTrash(c *checker, s storage.Store) {
+	var ids []string
+	for _, title := range []string{"a", "b", "c"} {
+		id, err := s.CreateConversation(title, "m", "")
+		if !c.ok(err, "CreateConversation") {
+			return
+		}
+		ids = append(ids, id)
+	}
+	c.ok(s.DeleteConversations(ids[:2]), "DeleteConversations")
+	listed := func(list []storage.ConvSummary) []string {
+		var out []string
+		for _, conv := range list {
+			out = append(out, conv.ID)
+		}
+		slices.Sort(out)
+		return out
+	}
+	sorted := func(ids ...string) []string {
+		slices.Sort(ids)
+		return ids
+	}
+	if list, err := s.ListConversations(); c.ok(err, "ListConversations") {
+		c.equal("listed", listed(list), sorted(ids[2]))
+	}
+	if trash, err := s.ListTrash(); c.ok(err, "ListTrash") {
+		c.equal("trash", listed(trash), sorted(ids[0], ids[1]))
+		for _, conv := range trash {
+			if conv.DeletedAt.IsZero() {
+				c.errorf("no deletion time on %s", conv.ID)
+			}
+		}
+	}
+
+	c.ok(s.RestoreConversations(ids[:1]), "RestoreConversations")
+	if list, err := s.ListConversations(); c.ok(err, "ListConversations") {
+		c.equal("listed after restore", listed(list), sorted(ids[0], ids[2]))
+	}
+	if n, err := s.PurgeTrash(time.Hour); c.ok(err, "PurgeTrash") {
+		c.equal("purged recent", n, 0)
+	}
+	c.ok(s.PurgeConversations(ids[1:2]), "PurgeConversations")
+	if has, err := s.HasConversation(ids[1]); c.ok(err, "HasConversation") && has {
+		c.errorf("purged conversation still exists")
+	}
+	c.ok(s.DeleteConversation(ids[2]), "DeleteConversation")
+	if trash, err := s.ListTrash(); c.ok(err, "ListTrash") {
+		c.equal("trash", listed(trash), sorted(ids[2]))
+	}
+}
+
+func checkImport(c *checker, s storage.Store) {
+	at := time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)
+	in := types.Conversation{
+		ID: "imported-1", Title: "Imported", Model: "m", SystemPrompt: "sys", Folder: "f", Tags: []string{"x", "a"}, Pinned: true,
+		CreatedAt: at, UpdatedAt: at.Add(time.Minute),
+		Messages: []types.Message{
+			{Role: openai.ChatMessageRoleUser, Content: "hi", CreatedAt: at},
+			{Role: openai.ChatMessageRoleAssistant, Content: "hello", Pinned: true, Summarized: true, CreatedAt: at.Add(time.Second),
+				Attachments: []types.Attachment{{Kind: types.AttachmentCommand, Name: "ls", Content: "a b", Size: 3}}},
+		},
+	}
+	if !c.ok(s.ImportConversation(in), "ImportConversation") {
+		return
+	}
+	if err := s.ImportConversation(in); err == nil {
+		c.errorf("importing the same ID twice did not fail")
+	}
+	conv, err := s.GetConversation(in.ID)
+	if !c.ok(err, "GetConversation") {
+		return
+	}
+	c.equal("conversation", []any{conv.Title, conv.Model, conv.SystemPrompt, conv.Folder, conv.Tags, conv.Pinned},
+		[]any{"Imported", "m", "sys", "f", []string{"a", "x"}, true})
+	c.equal("created at", conv.CreatedAt.UTC(), at)
+	c.equal("updated at", conv.UpdatedAt.UTC(), at.Add(time.Minute))
+
+	msgs, err := s.ListMessages(in.ID)
+	if !c.ok(err, "ListMessages") || len(msgs) != 2 {
+		c.errorf("%d messages imported, want 2", len(msgs))
+		return
+	}
+	c.equal("message time", msgs[1].CreatedAt.UTC(), at.Add(time.Second))
+	c.equal("message", []any{msgs[1].Role, msgs[1].Content, msgs[1].Pinned, msgs[1].Summarized}, []any{openai.ChatMessageRoleAssistant, "hello", true, true})
+	if len(msgs[1].Attachments) == 1 {
+		c.equal("attachment", msgs[1].Attachments[0].Content, "a b")
+	} else {
+		c.errorf("%d attachments imported, want 1", len(msgs[1].Attachments))
+	}
+
+	in.Title, in.Tags, in.Messages = "Replaced", []string{"y"}, in.Messages[:1]
+	if !c.ok(s.ReplaceConversation(in), "ReplaceConversation") {
+		return
+	}
+	if conv, err := s.GetConversation(in.ID); c.ok(err, "GetConversation") {
+		c.equal("replaced conversation", []any{conv.Title, conv.Tags}, []any{"Replaced", []string{"y"}})
+	}
+	if msgs, err := s.ListMessages(in.ID); c.ok(err, "ListMessages") {
+		c.equal("replaced messages", len(msgs), 1)
+	}
+	in.ID = "imported-2"
+	c.ok(s.ReplaceConversation(in), "ReplaceConversation of a new ID")
+}
+
+func checkPrompts(c *checker, s storage.Store) {
+	prompts, err := s.ListSystemPrompts()
+	if !c.ok(err, "ListSystemPrompts") {
+		return
+	}
+	if len(prompts) == 0 {
+		c.errorf("no built-in prompts")
+	}
+	if _, ok, err := s.DefaultSystemPrompt(); c.ok(err, "DefaultSystemPrompt") && ok {
+		c.errorf("a default prompt is set initially")
+	}
+
+	p, err := s.SaveSystemPrompt(types.SystemPrompt{Name: "Mine", Content: "Be kind.", IsDefault: true})
+	if !c.ok(err, "SaveSystemPrompt") {
+		return
+	}
+	if p.ID == "" || p.Kind != types.PromptKindSystem {
+		c.errorf("SaveSystemPrompt returned %+v", p)
+	}
+	if content, ok, err := s.DefaultSystemPrompt(); c.ok(err, "DefaultSystemPrompt") {
+		c.equal("default", []any{content, ok}, []any{"Be kind.", true})
+	}
+	other, err := s.SaveSystemPrompt(types.SystemPrompt{ID: "other", Name: "Other", Content: "Be terse.", IsDefault: true})
+	c.ok(err, "SaveSystemPrompt")
+	if content, _, err := s.DefaultSystemPrompt(); c.ok(err, "DefaultSystemPrompt") {
+		c.equal("default after saving another", content, "Be terse.")
+	}
+	tmpl, err := s.SaveSystemPrompt(types.SystemPrompt{Name: "Tmpl", Kind: types.PromptKindTemplate, Content: "{{x}}", IsDefault: true})
+	c.ok(err, "SaveSystemPrompt")
+	c.equal("template default", tmpl.IsDefault, false)
+	c.ok(s.SetDefaultSystemPrompt(tmpl.ID), "SetDefaultSystemPrompt")
+	if _, ok, err := s.DefaultSystemPrompt(); c.ok(err, "DefaultSystemPrompt") && ok {
+		c.errorf("a template became the default")
+	}
+	c.ok(s.SetDefaultSystemPrompt(p.ID), "SetDefaultSystemPrompt")
+	c.ok(s.SetDefaultSystemPrompt(""), "SetDefaultSystemPrompt")
+	if _, ok, err := s.DefaultSystemPrompt(); c.ok(err, "DefaultSystemPrompt") && ok {
+		c.errorf("default not cleared")
+	}
+
+	p.Content = "Be very kind."
+	_, err = s.SaveSystemPrompt(p)
+	c.ok(err, "SaveSystemPrompt")
+	c.ok(s.DeleteSystemPrompt(other.ID), "DeleteSystemPrompt")
+	after, err := s.ListSystemPrompts()
+	if !c.ok(err, "ListSystemPrompts") {
+		return
+	}
+	c.equal("prompt count", len(after), len(prompts)+2)
+	for _, q := range after {
+		switch q.ID {
+		case other.ID:
+			c.errorf("deleted prompt still listed")
+		case p.ID:
+			c.equal("updated prompt", q.Content, "Be very kind.")
+		case tmpl.ID:
+			c.equal("template kind", q.Kind, types.PromptKindTemplate)
+		}
+	}
+
+	// The built-in prompts are not added back once they are all deleted.
+	for _, q := range after {
+		c.ok(s.DeleteSystemPrompt(q.ID), "DeleteSystemPrompt")
+	}
+	if left, err := s.ListSystemPrompts(); c.ok(err, "ListSystemPrompts") {
+		c.equal("prompts after deleting all", len(left), 0)
+	}
+}
+
+func checkCollections(c *checker, s storage.Store) {
+	chunks := []types.Chunk{
+		{Path: "a.go", StartLine: 1, EndLine: 60, Content: "package a", Vector: []float32{0.5, -1, 2}},
+		{Path: "b.go", StartLine: 61, EndLine: 80, Content: "package b", Vector: []float32{1, 0, 0}},
+	}
+	col, err := s.SaveCollection(types.Collection{Name: "repo", Root: "/src", Model: "emb", Files: 2}, chunks)
+	if !c.ok(err, "SaveCollection") {
+		return
+	}
+	if col.ID == "" || col.Chunks != 2 {
+		c.errorf("SaveCollection returned %+v", col)
+	}
+	if cols, err := s.ListCollections(); c.ok(err, "ListCollections") && len(cols) == 1 {
+		c.equal("collection", []any{cols[0].ID, cols[0].Name, cols[0].Root, cols[0].Model, cols[0].Files, cols[0].Chunks},
+			[]any{col.ID, "repo", "/src", "emb", 2, 2})
+	} else {
+		c.errorf("ListCollections returned %d collections, want 1", len(cols))
+	}
+	if got, err := s.CollectionChunks(col.ID); c.ok(err, "CollectionChunks") {
+		c.equal("chunks", got, chunks)
+	}
+
+	// Indexing again replaces the chunks.
+	col, err = s.SaveCollection(col, chunks[:1])
+	c.ok(err, "SaveCollection")
+	if got, err := s.CollectionChunks(col.ID); c.ok(err, "CollectionChunks") {
+		c.equal("chunks after reindexing", len(got), 1)
+	}
+
+	id, _ := s.CreateConversation("RAG", "m", "")
+	c.ok(s.SetConversationCollection(id, col.ID), "SetConversationCollection")
+	c.ok(s.DeleteCollection(col.ID), "DeleteCollection")
+	if cols, err := s.ListCollections(); c.ok(err, "ListCollections") {
+		c.equal("collections after delete", len(cols), 0)
+	}
+	if conv, err := s.GetConversation(id); c.ok(err, "GetConversation") {
+		c.equal("collection of the conversation", conv.Collection, "")
+	}
+}
+
+// CheckUpgradedPrompts checks the prompts of a store opened on data from a
+// version that had no built-in prompts yet: open opens it, again each time.
+// The built-in prompts, templates included, are added on the first open and
+// stay deleted once deleted.
+func CheckUpgradedPrompts(open func() (storage.Store, error)) error {
+	c := &checker{}
+	s, err := open()
+	if !c.ok(err, "open") {
+		return c.err()
+	}
+	prompts, err := s.ListSystemPrompts()
+	if !c.ok(err, "ListSystemPrompts") {
+		return c.err()
+	}
+	var system, templates int
+	for _, p := range prompts {
+		if p.Kind == types.PromptKindTemplate {
+			templates++
+		} else {
+			system++
+		}
+		c.ok(s.DeleteSystemPrompt(p.ID), "DeleteSystemPrompt")
+	}
+	if system == 0 || templates == 0 {
+		c.errorf("upgraded store lists %d system prompts and %d templates", system, templates)
+	}
+
+	s, err = open()
+	if !c.ok(err, "open again") {
+		return c.err()
+	}
+	if left, err := s.ListSystemPrompts(); c.ok(err, "ListSystemPrompts") {
+		c.equal("prompts after deleting all and reopening", len(left), 0)
+	}
+	return c.err()
+}
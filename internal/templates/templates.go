@@ -0,0 +1,75 @@
+// Package templates expands {{var}} placeholders in prompt templates.
+//
+// Built-in variables are resolved automatically:
+//
+//	{{date}}       current date (2006-01-02)
+//	{{time}}       current time (15:04)
+//	{{cwd}}        working directory
+//	{{clipboard}}  system clipboard contents
+//	{{file:path}}  contents of the file at path
+//
+// Everything else is a user variable that has to be filled in.
+package templates
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/atotto/clipboard"
+)
+
+var placeholder = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// Vars returns the distinct variable names in text in order of first use.
+func Vars(text string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range placeholder.FindAllStringSubmatch(text, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// IsBuiltin reports whether name is resolved by Builtin rather than the user.
+func IsBuiltin(name string) bool {
+	switch name {
+	case "date", "time", "cwd", "clipboard":
+		return true
+	}
+	return strings.HasPrefix(name, "file:")
+}
+
+// Builtin resolves a built-in variable.
+func Builtin(name string) (string, error) {
+	switch {
+	case name == "date":
+		return time.Now().Format("2006-01-02"), nil
+	case name == "time":
+		return time.Now().Format("15:04"), nil
+	case name == "cwd":
+		return os.Getwd()
+	case name == "clipboard":
+		return clipboard.ReadAll()
+	case strings.HasPrefix(name, "file:"):
+		data, err := os.ReadFile(strings.TrimSpace(strings.TrimPrefix(name, "file:")))
+		return string(data), err
+	}
+	return "", fmt.Errorf("unknown built-in variable %q", name)
+}
+
+// Expand replaces placeholders with values. Placeholders without a value are kept.
+func Expand(text string, values map[string]string) string {
+	return placeholder.ReplaceAllStringFunc(text, func(m string) string {
+		name := placeholder.FindStringSubmatch(m)[1]
+		if v, ok := values[name]; ok {
+			return v
+		}
+		return m
+	})
+}
@@ -0,0 +1,95 @@
+// Package tokens gives a rough, offline estimate of how many tokens chat
+// messages use, and the context window of common models.
+package tokens
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// MessageOverhead approximates the per-message framing of the chat format.
+const MessageOverhead = 4
+
+// DefaultLimit is assumed for models that are neither configured nor known.
+const DefaultLimit = 8192
+
+// knownLimits maps model name prefixes to their context window.
+var knownLimits = map[string]int{
+	"gpt-3.5-turbo": 16385,
+	"gpt-4":         8192,
+	"gpt-4-32k":     32768,
+	"gpt-4-turbo":   128000,
+	"gpt-4o":        128000,
+	"gpt-4.1":       1047576,
+	"gpt-5":         400000,
+	"o1":            200000,
+	"o3":            200000,
+	"o4-mini":       200000,
+	"claude":        200000,
+	"deepseek":      65536,
+	"qwen":          32768,
+}
+
+// Estimate approximates the token count of s: about four bytes per token for
+// ASCII text and one token per rune for CJK and other non-ASCII scripts.
+func Estimate(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < 0x80 {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// EstimateMessage is Estimate plus the per-message overhead.
+func EstimateMessage(content string) int {
+	return Estimate(content) + MessageOverhead
+}
+
+// Image estimates the cost of a w×h image input: it is fit into 2048×2048,
+// scaled so the short side is at most 768, and billed 170 tokens per 512px
+// tile on top of a base of 85.
+func Image(w, h int) int {
+	if w <= 0 || h <= 0 {
+		return 85
+	}
+	fw, fh := float64(w), float64(h)
+	if s := 2048 / max(fw, fh); s < 1 {
+		fw, fh = fw*s, fh*s
+	}
+	if s := 768 / min(fw, fh); s < 1 {
+		fw, fh = fw*s, fh*s
+	}
+	tiles := int(math.Ceil(fw/512)) * int(math.Ceil(fh/512))
+	return 85 + 170*tiles
+}
+
+// Limit returns the context window for model. Entries in overrides win over
+// the built-in table; both match on the longest model name prefix.
+func Limit(model string, overrides map[string]int) int {
+	if n, ok := lookup(model, overrides); ok {
+		return n
+	}
+	if n, ok := lookup(model, knownLimits); ok {
+		return n
+	}
+	return DefaultLimit
+}
+
+func lookup(model string, limits map[string]int) (int, bool) {
+	prefixes := make([]string, 0, len(limits))
+	for p := range limits {
+		if strings.HasPrefix(model, p) && limits[p] > 0 {
+			prefixes = append(prefixes, p)
+		}
+	}
+	if len(prefixes) == 0 {
+		return 0, false
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	return limits[prefixes[0]], true
+}
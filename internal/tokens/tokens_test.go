@@ -0,0 +1,46 @@
+package tokens
+
+import "testing"
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"你好", 2},
+		{"hi 你好", 3},
+	}
+	for _, tt := range tests {
+		if got := Estimate(tt.s); got != tt.want {
+			t.Errorf("Estimate(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+	if got := EstimateMessage("abcd"); got != 1+MessageOverhead {
+		t.Errorf("EstimateMessage = %d", got)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	overrides := map[string]int{"gpt-4o-mini": 64000, "local": 4096, "off": 0}
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"gpt-4", 8192},
+		{"gpt-4-turbo-2024-04-09", 128000}, // the longest prefix wins
+		{"gpt-4o", 128000},
+		{"gpt-4o-mini", 64000}, // overrides win
+		{"local-llama", 4096},
+		{"off", DefaultLimit}, // zero entries are ignored
+		{"unknown", DefaultLimit},
+	}
+	for _, tt := range tests {
+		if got := Limit(tt.model, overrides); got != tt.want {
+			t.Errorf("Limit(%q) = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+}
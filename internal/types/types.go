@@ -2,26 +2,172 @@ package types
 
 import (
 	"time"
-	"github.com/sashabaranov/go-openai"
 )
 
 type Config struct {
 	BaseURL string `json:"base_url"`
 	APIKey  string `json:"api_key"`
 	Model   string `json:"model"`
+
+	// ContextLimits overrides the context window (in tokens) per model name prefix.
+	ContextLimits map[string]int `json:"context_limits,omitempty"`
+	// ContextStrategy is what happens when a chat outgrows the window: "drop"
+	// (default) leaves out the oldest turns, "summarize" replaces them with a summary.
+	ContextStrategy string `json:"context_strategy,omitempty"`
+	// TitleModel is a cheap model used to name new conversations; empty uses Model.
+	TitleModel string `json:"title_model,omitempty"`
+	// TemplateDir is a shared directory of prompt templates looked up by /t.
+	TemplateDir string `json:"template_dir,omitempty"`
+	// VisionModels lists model name prefixes that accept images; images are
+	// left out of requests to any other model.
+	VisionModels []string `json:"vision_models,omitempty"`
+	// EmbeddingModel is used by /index and retrieval through the /embeddings
+	// endpoint; empty uses a local hashing embedder that needs no network.
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	// RetrievalTopK is the number of indexed chunks attached per question (default 5).
+	RetrievalTopK int `json:"retrieval_top_k,omitempty"`
+	// ExportDir is where exports with a relative file name are written; empty
+	// means the working directory.
+	ExportDir string `json:"export_dir,omitempty"`
+	// TrashRetentionDays is how long deleted conversations stay in the trash
+	// (default 30); a negative value keeps them until the trash is emptied.
+	TrashRetentionDays int `json:"trash_retention_days,omitempty"`
+	// BackupDir holds the database backups; empty means ~/.xftui-backups.
+	BackupDir string `json:"backup_dir,omitempty"`
+	// BackupKeep is how many daily automatic backups are kept (default 7); a
+	// negative value turns automatic backups off.
+	BackupKeep int `json:"backup_keep,omitempty"`
+	// KeyCommand prints the passphrase of an encrypted database, e.g.
+	// "pass show chat-tui"; when empty the passphrase is asked for.
+	KeyCommand string `json:"key_command,omitempty"`
+	// Storage selects where conversations are kept: StorageSQLite (default)
+	// or StorageFiles, one file per conversation in StorageDir.
+	Storage    string `json:"storage,omitempty"`
+	StorageDir string `json:"storage_dir,omitempty"` // default ~/.xftui-conversations
+	// Profiles are named endpoints that /compare can send to next to plain
+	// model names.
+	Profiles map[string]Profile `json:"profiles,omitempty"`
+}
+
+// Profile is another endpoint and model; fields left empty are taken from the
+// main settings.
+type Profile struct {
+	BaseURL string `json:"base_url,omitempty"`
+	APIKey  string `json:"api_key,omitempty"`
+	Model   string `json:"model,omitempty"`
+}
+
+const (
+	StorageSQLite = "sqlite"
+	StorageFiles  = "files"
+)
+
+// State is what the UI remembers between runs, kept apart from the config
+// the user edits.
+type State struct {
+	Tabs      []TabState `json:"open_tabs"`
+	ActiveTab int        `json:"active_tab"`
 }
 
+// TabState is an open tab as saved at exit. The draft and attachments are
+// left out while the store is encrypted, as they would be kept in plain text.
+type TabState struct {
+	ConvID      string       `json:"conv_id,omitempty"` // "" for a new chat
+	Draft       string       `json:"draft,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Row         int          `json:"row,omitempty"` // scroll offset of the chat view
+	Col         int          `json:"col,omitempty"`
+}
+
+const (
+	DefaultTrashRetentionDays = 30
+	DefaultBackupKeep         = 7
+)
+
+const (
+	ContextDrop      = "drop"
+	ContextSummarize = "summarize"
+)
+
 type Conversation struct {
 	ID           string                         `json:"id"`
 	Title        string                         `json:"title"`
 	Model        string                         `json:"model"`
 	SystemPrompt string                         `json:"system_prompt"`
-	Messages     []openai.ChatCompletionMessage `json:"messages"`
+	Collection   string                         `json:"collection,omitempty"` // ID of the collection retrieved from, if any
+	Folder       string                         `json:"folder,omitempty"`
+	Tags         []string                       `json:"tags,omitempty"`
+	Pinned       bool                           `json:"pinned,omitempty"`
+	Messages     []Message                      `json:"messages"` // filled for export and import only
 	CreatedAt    time.Time                      `json:"created_at"`
+	UpdatedAt    time.Time                      `json:"updated_at"` // time of the last message
+}
+
+// Message is a stored chat message. ID is zero for messages that only live in memory.
+type Message struct {
+	ID         int64     `json:"id"`
+	Role       string    `json:"role"`
+	Content    string    `json:"content"`
+	Pinned     bool      `json:"pinned"`
+	Summarized bool      `json:"summarized"` // covered by a summary message and no longer sent
+	CreatedAt  time.Time `json:"created_at"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is content sent along with a message but shown as a compact chip.
+type Attachment struct {
+	ID        int64  `json:"id"`
+	MessageID int64  `json:"message_id"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"` // e.g. the path relative to the working directory
+	Content   string `json:"content"`
+	Size      int64  `json:"size"`
+
+	// Images keep their bytes in Data instead of Content.
+	MIME   string `json:"mime,omitempty"`
+	Data   []byte `json:"data,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+const (
+	AttachmentFile    = "file"
+	AttachmentDir     = "dir" // files of a directory, already formatted
+	AttachmentImage   = "image"
+	AttachmentCommand = "command" // output of a shell command, Name holds the command line
+	AttachmentContext = "context" // chunks retrieved from a collection, Name lists the citations
+)
+
+// Collection is an indexed directory that questions can retrieve chunks from.
+type Collection struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Root      string    `json:"root"`  // absolute path of the indexed directory
+	Model     string    `json:"model"` // embedding model; empty for the local embedder
+	Files     int       `json:"files"`
+	Chunks    int       `json:"chunks"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Chunk is a range of lines of an indexed file with its embedding.
+type Chunk struct {
+	Path      string    `json:"path"` // relative to the collection root
+	StartLine int       `json:"start_line"`
+	EndLine   int       `json:"end_line"`
+	Content   string    `json:"content"`
+	Vector    []float32 `json:"-"`
 }
 
 type SystemPrompt struct {
-	ID      string `json:"id"`
-	Name    string `json:"name"`
-	Content string `json:"content"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Content   string `json:"content"`
+	IsDefault bool   `json:"is_default"` // used for new chats
+	Kind      string `json:"kind"`       // PromptKindSystem or PromptKindTemplate
 }
+
+const (
+	PromptKindSystem   = "system"
+	PromptKindTemplate = "template" // expanded into the composer by /t
+)
@@ -0,0 +1,327 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rivo/tview"
+	"github.com/evallife/chat-tui/internal/export"
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// Export formats, as offered by the export dialog.
+const (
+	formatMarkdown = "Markdown"
+	formatQA       = "Q&A Markdown"
+	formatHTML     = "HTML"
+	formatJSON     = "JSON"
+	formatJSONL    = "JSONL"
+	formatText     = "Plain text"
+)
+
+var exportFormats = []string{formatMarkdown, formatQA, formatHTML, formatJSON, formatJSONL, formatText}
+
+var exportExtensions = map[string]string{
+	formatMarkdown: ".md",
+	formatQA:       ".md",
+	formatHTML:     ".html",
+	formatJSON:     ".json",
+	formatJSONL:    ".jsonl",
+	formatText:     ".txt",
+}
+
+var exportWriters = map[string]func(io.Writer, []types.Conversation) error{
+	formatMarkdown: export.WriteMarkdown,
+	formatQA:       export.WriteQA,
+	formatHTML:     export.WriteHTML,
+	formatJSON:     export.WriteJSON,
+	formatJSONL:    export.WriteJSONL,
+	formatText:     export.WriteText,
+}
+
+// formatOf picks the export format from a file name; Markdown and unknown
+// names get the Q&A style that /save and /export always wrote.
+func formatOf(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return formatJSON
+	case ".jsonl":
+		return formatJSONL
+	case ".html", ".htm":
+		return formatHTML
+	case ".txt":
+		return formatText
+	}
+	return formatQA
+}
+
+// Export scopes besides "Tagged #name", which exports all chats with that tag.
+const (
+	scopeCurrent  = "Current chat"
+	scopeSelected = "Selected messages"
+	scopeAll      = "All chats"
+	scopeTagged   = "Tagged #"
+)
+
+// exportScopes lists the scopes for the export dialog, one per tag in use.
+func (ui *TViewUI) exportScopes() []string {
+	scopes := []string{scopeCurrent, scopeSelected, scopeAll}
+	convs, _ := ui.storage.ListConversations()
+	var tags []string
+	for _, c := range convs {
+		for _, t := range c.Tags {
+			if !slices.Contains(tags, t) {
+				tags = append(tags, t)
+			}
+		}
+	}
+	slices.Sort(tags)
+	for _, t := range tags {
+		scopes = append(scopes, scopeTagged+t)
+	}
+	return scopes
+}
+
+// currentConversation returns the open conversation with all its messages;
+// one that is not saved yet is taken from memory.
+func (ui *TViewUI) currentConversation() (types.Conversation, error) {
+	if ui.convID == "" {
+		return types.Conversation{Title: "New conversation", Model: ui.config.Model, SystemPrompt: ui.systemPrompt, Messages: ui.messages}, nil
+	}
+	return export.Load(ui.storage, ui.convID)
+}
+
+// exportScope loads the conversations a scope covers.
+func (ui *TViewUI) exportScope(scope string) ([]types.Conversation, error) {
+	switch {
+	case scope == scopeAll:
+		return export.LoadAll(ui.storage)
+	case strings.HasPrefix(scope, scopeTagged):
+		tag := strings.TrimPrefix(scope, scopeTagged)
+		return export.LoadWhere(ui.storage, func(c storage.ConvSummary) bool { return slices.Contains(c.Tags, tag) })
+	}
+	c, err := ui.currentConversation()
+	if err != nil {
+		return nil, err
+	}
+	if scope == scopeSelected {
+		c.Messages = slices.DeleteFunc(c.Messages, func(m types.Message) bool { return !ui.isMarked(m) })
+		if len(c.Messages) == 0 {
+			return nil, fmt.Errorf("no messages selected; select messages with Alt+Up/Down and mark them with m")
+		}
+	}
+	return []types.Conversation{c}, nil
+}
+
+// isMarked reports whether m was marked for export, or is the selected
+// message when none are marked.
+func (ui *TViewUI) isMarked(m types.Message) bool {
+	if len(ui.markedMsgs) == 0 {
+		return ui.selectedMsg >= 0 && ui.selectedMsg < len(ui.messages) && ui.messages[ui.selectedMsg].ID == m.ID
+	}
+	return ui.markedMsgs[m.ID]
+}
+
+// toggleMarkSelected marks or unmarks the selected message for export.
+func (ui *TViewUI) toggleMarkSelected() {
+	if ui.selectedMsg < 0 {
+		return
+	}
+	id := ui.messages[ui.selectedMsg].ID
+	if id == 0 {
+		return
+	}
+	if ui.markedMsgs[id] {
+		delete(ui.markedMsgs, id)
+	} else {
+		ui.markedMsgs[id] = true
+	}
+	ui.redrawChat(false)
+}
+
+// exportPath places relative names in the configured export directory.
+func (ui *TViewUI) exportPath(dir, filename string) string {
+	if filepath.IsAbs(filename) || dir == "" {
+		return filename
+	}
+	if rest, ok := strings.CutPrefix(dir, "~"); ok {
+		home, _ := os.UserHomeDir()
+		dir = home + rest
+	}
+	return filepath.Join(dir, filename)
+}
+
+// freeName returns name, or name-1, name-2, ... before the extension if it is taken.
+func freeName(name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
+
+// exportConversations writes the conversations of scope to filename. An
+// existing file is only replaced after the user agrees.
+func (ui *TViewUI) exportConversations(filename, format, scope string, opts export.Options) {
+	convs, err := ui.exportScope(scope)
+	if err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Export failed: %v", err))
+		return
+	}
+	convs = export.Filter(convs, opts)
+	write := func(name string) {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Export failed: %v", err))
+			return
+		}
+		f, err := os.Create(name)
+		if err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Export failed: %v", err))
+			return
+		}
+		err = exportWriters[format](f, convs)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Export failed: %v", err))
+			return
+		}
+		ui.appendSystemMsg(fmt.Sprintf("Exported %d conversation(s) to %s", len(convs), name))
+	}
+
+	if _, err := os.Stat(filename); err != nil {
+		write(filename)
+		return
+	}
+	back := ui.App.GetFocus()
+	modal := tview.NewModal().
+		SetText(fmt.Sprintf("%s already exists.", filename)).
+		AddButtons([]string{"Overwrite", "Keep Both", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			ui.Pages.RemovePage("confirm-overwrite")
+			ui.App.SetFocus(back)
+			switch buttonLabel {
+			case "Overwrite":
+				write(filename)
+			case "Keep Both":
+				write(freeName(filename))
+			}
+		})
+	ui.Pages.AddPage("confirm-overwrite", modal, true, true)
+}
+
+// exportCurrent exports the open conversation with everything included, in
+// the format the file name suggests.
+func (ui *TViewUI) exportCurrent(filename string) {
+	ui.exportConversations(ui.exportPath(ui.config.ExportDir, filename), formatOf(filename), scopeCurrent, export.Full)
+}
+
+// exportAll implements /export all: every chat as JSON, or in the format the
+// file name suggests, with full transcripts for Markdown.
+func (ui *TViewUI) exportAll(filename string) {
+	if filename == "" {
+		filename = fmt.Sprintf("chat_export_%d.json", time.Now().Unix())
+	}
+	format := formatOf(filename)
+	if format == formatQA {
+		format = formatMarkdown
+	}
+	ui.exportConversations(ui.exportPath(ui.config.ExportDir, filename), format, scopeAll, export.Full)
+}
+
+// showExportDialog asks for the format, scope, contents and destination of an export.
+func (ui *TViewUI) showExportDialog() {
+	form := tview.NewForm()
+	form.SetBorder(true).SetTitle(" Export Options ").SetTitleAlign(tview.AlignLeft)
+
+	base := fmt.Sprintf("chat_export_%d", time.Now().Unix())
+	format, scope := formatMarkdown, scopeCurrent
+	opts := export.Full
+
+	filenameField := tview.NewInputField().SetLabel("Filename:").SetText(base + exportExtensions[format]).SetFieldWidth(40)
+	form.AddDropDown("Format:", exportFormats, 0, func(option string, _ int) {
+		format = option
+		// Follow the format with the extension unless the user typed their own name.
+		if name := filenameField.GetText(); name == "" || strings.HasPrefix(name, base) {
+			filenameField.SetText(base + exportExtensions[option])
+		}
+	})
+	form.AddDropDown("Scope:", ui.exportScopes(), 0, func(option string, _ int) {
+		scope = option
+	})
+	form.AddInputField("Directory:", ui.config.ExportDir, 40, nil, nil)
+	form.AddFormItem(filenameField)
+	form.AddCheckbox("System prompt", opts.SystemPrompt, func(checked bool) { opts.SystemPrompt = checked })
+	form.AddCheckbox("Metadata", opts.Metadata, func(checked bool) { opts.Metadata = checked })
+	form.AddCheckbox("Attachments", opts.Attachments, func(checked bool) { opts.Attachments = checked })
+
+	dismiss := func() {
+		ui.Pages.RemovePage("export-dialog")
+	}
+	form.AddButton("Export", func() {
+		filename := strings.TrimSpace(filenameField.GetText())
+		if filename == "" {
+			filename = base + exportExtensions[format]
+		}
+		dir := strings.TrimSpace(form.GetFormItemByLabel("Directory:").(*tview.InputField).GetText())
+		dismiss()
+		ui.exportConversations(ui.exportPath(dir, filename), format, scope, opts)
+	})
+	form.AddButton("Cancel", dismiss)
+	form.SetCancelFunc(dismiss)
+
+	modal := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
+			AddItem(nil, 0, 1, false).
+			AddItem(form, 64, 1, true).
+			AddItem(nil, 0, 1, false), 19, 1, true).
+		AddItem(nil, 0, 1, false)
+
+	ui.Pages.AddPage("export-dialog", modal, true, true)
+}
+
+// importConversations implements /import <path> [skip|duplicate|overwrite].
+func (ui *TViewUI) importConversations(args []string) {
+	policy := export.Skip
+	if n := len(args); n > 1 && slices.Contains([]string{export.Skip, export.Duplicate, export.Overwrite}, args[n-1]) {
+		policy, args = args[n-1], args[:n-1]
+	}
+	if len(args) == 0 {
+		ui.appendSystemMsg("Usage: /import <path> [skip|duplicate|overwrite]")
+		return
+	}
+	filename := strings.Join(args, " ")
+	f, err := os.Open(filename)
+	if err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Import failed: %v", err))
+		return
+	}
+	convs, err := export.Read(f)
+	f.Close()
+	if err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Import failed: %v", err))
+		return
+	}
+	res, err := export.Import(ui.storage, convs, policy)
+	if err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Import failed after %s: %v", res, err))
+		return
+	}
+	ui.appendSystemMsg(fmt.Sprintf("Imported %s: %s", filename, res))
+	ui.reloadTabTitles()
+	// An overwrite may have replaced the open conversation.
+	if policy == export.Overwrite && slices.ContainsFunc(convs, func(c types.Conversation) bool { return c.ID == ui.convID }) {
+		ui.loadConversation(ui.convID)
+	}
+}
@@ -0,0 +1,123 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/evallife/chat-tui/internal/export"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// press sends keys to the UI as if typed.
+func press(ui *TViewUI, keys ...tcell.Key) {
+	for _, k := range keys {
+		ui.App.QueueEvent(tcell.NewEventKey(k, 0, tcell.ModNone))
+	}
+}
+
+// TestExportOverwrite exports onto an existing file: it is only replaced
+// once the user picks Overwrite.
+func TestExportOverwrite(t *testing.T) {
+	ui, _ := startUI(t, "http://127.0.0.1:0")
+	name := filepath.Join(t.TempDir(), "chat.md")
+	if err := os.WriteFile(name, []byte("keep me"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	content := func(name string) string {
+		data, _ := os.ReadFile(name)
+		return string(data)
+	}
+	asked := func() bool { return ui.Pages.HasPage("confirm-overwrite") }
+	exportAgain := func() {
+		do(ui, func() {
+			ui.messages = []types.Message{{Role: "user", Content: "Question"}, {Role: "assistant", Content: "Answer"}}
+			ui.exportConversations(name, formatQA, scopeCurrent, export.Full)
+		})
+		waitFor(t, ui, "the overwrite question", asked)
+		if got := content(name); got != "keep me" {
+			t.Fatalf("file replaced before asking: %q", got)
+		}
+	}
+
+	exportAgain()
+	press(ui, tcell.KeyRight, tcell.KeyRight, tcell.KeyEnter) // Cancel
+	waitFor(t, ui, "the question to close", func() bool { return !asked() })
+	if got := content(name); got != "keep me" {
+		t.Errorf("Cancel replaced the file: %q", got)
+	}
+
+	exportAgain()
+	press(ui, tcell.KeyRight, tcell.KeyEnter) // Keep Both
+	waitFor(t, ui, "the question to close", func() bool { return !asked() })
+	other := strings.TrimSuffix(name, ".md") + "-1.md"
+	if got := content(name); got != "keep me" || !strings.Contains(content(other), "## A: Answer") {
+		t.Errorf("Keep Both left %q and wrote %q", got, content(other))
+	}
+
+	exportAgain()
+	press(ui, tcell.KeyEnter) // Overwrite
+	waitFor(t, ui, "the question to close", func() bool { return !asked() })
+	if got := content(name); !strings.Contains(got, "## Q: Question") {
+		t.Errorf("Overwrite left %q", got)
+	}
+}
+
+// TestExportScope checks which conversations and messages each scope covers.
+func TestExportScope(t *testing.T) {
+	ui, _ := startUI(t, "http://127.0.0.1:0")
+	var ids []string
+	for _, title := range []string{"Tagged", "Other"} {
+		id, err := ui.storage.CreateConversation(title, "gpt-4o", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, content := range []string{"one", "two", "three"} {
+			if _, err := ui.storage.SaveMessage(id, "user", content); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ids = append(ids, id)
+	}
+	if err := ui.storage.SetConversationTags(ids[0], []string{"work"}); err != nil {
+		t.Fatal(err)
+	}
+
+	do(ui, func() {
+		ui.openConversation(ids[1])
+		if scopes := ui.exportScopes(); !strings.Contains(strings.Join(scopes, "|"), scopeTagged+"work") {
+			t.Errorf("scopes = %q", scopes)
+		}
+		titles := func(scope string) string {
+			convs, err := ui.exportScope(scope)
+			if err != nil {
+				return err.Error()
+			}
+			var out []string
+			for _, c := range convs {
+				out = append(out, fmt.Sprintf("%s:%d", c.Title, len(c.Messages)))
+			}
+			return strings.Join(out, ",")
+		}
+		if got := titles(scopeCurrent); got != "Other:3" {
+			t.Errorf("current: %s", got)
+		}
+		if got := titles(scopeTagged + "work"); got != "Tagged:3" {
+			t.Errorf("tagged: %s", got)
+		}
+		if got := titles(scopeAll); !strings.Contains(got, "Tagged:3") || !strings.Contains(got, "Other:3") {
+			t.Errorf("all: %s", got)
+		}
+		if got := titles(scopeSelected); !strings.HasPrefix(got, "no messages selected") {
+			t.Errorf("selected without a selection: %s", got)
+		}
+		ui.markedMsgs[ui.messages[0].ID] = true
+		ui.markedMsgs[ui.messages[2].ID] = true
+		if got := titles(scopeSelected); got != "Other:2" {
+			t.Errorf("selected: %s", got)
+		}
+	})
+}
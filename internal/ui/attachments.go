@@ -0,0 +1,394 @@
+package ui
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/evallife/chat-tui/internal/tokens"
+	"github.com/evallife/chat-tui/internal/types"
+	"github.com/evallife/chat-tui/internal/workspace"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/sahilm/fuzzy"
+)
+
+// pickerLimit caps the number of matches shown in the file picker.
+const pickerLimit = 200
+
+// fenced wraps content in a code fence long enough not to clash with fences inside it.
+func fenced(lang, content string) string {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	return fmt.Sprintf("%s%s\n%s\n%s", fence, lang, strings.TrimRight(content, "\n"), fence)
+}
+
+// fileBlock formats a file for the model. name may carry a line range, as in "main.go:10-80".
+func fileBlock(name, content string) string {
+	base, _, _ := strings.Cut(path.Base(name), ":")
+	return fmt.Sprintf("File: %s\n%s", name, fenced(strings.TrimPrefix(path.Ext(base), "."), content))
+}
+
+// attachmentText is what the model sees for an attachment.
+func attachmentText(a types.Attachment) string {
+	switch a.Kind {
+	case types.AttachmentFile:
+		return fileBlock(a.Name, a.Content)
+	case types.AttachmentCommand:
+		return fmt.Sprintf("$ %s\n%s", a.Name, fenced("", a.Content))
+	}
+	return a.Content
+}
+
+// messageText is the content sent for m: its text followed by its attachments.
+func messageText(m types.Message) string {
+	if len(m.Attachments) == 0 {
+		return m.Content
+	}
+	parts := make([]string, 0, len(m.Attachments)+1)
+	if m.Content != "" {
+		parts = append(parts, m.Content)
+	}
+	for _, a := range m.Attachments {
+		if a.Kind != types.AttachmentImage {
+			parts = append(parts, attachmentText(a))
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func imageAttachments(m types.Message) []types.Attachment {
+	var images []types.Attachment
+	for _, a := range m.Attachments {
+		if a.Kind == types.AttachmentImage {
+			images = append(images, a)
+		}
+	}
+	return images
+}
+
+// messageTokens estimates what m costs in a request, images included.
+func messageTokens(m types.Message) int {
+	n := tokens.EstimateMessage(messageText(m))
+	for _, a := range imageAttachments(m) {
+		n += tokens.Image(a.Width, a.Height)
+	}
+	return n
+}
+
+func dataURL(a types.Attachment) string {
+	return "data:" + a.MIME + ";base64," + base64.StdEncoding.EncodeToString(a.Data)
+}
+
+// visionModel reports whether the configured model is listed as accepting images.
+func (ui *TViewUI) visionModel() bool {
+	return isVisionModel(ui.config)
+}
+
+// isVisionModel reports whether cfg.Model is listed in cfg.VisionModels.
+func isVisionModel(cfg types.Config) bool {
+	for _, p := range cfg.VisionModels {
+		if p != "" && strings.HasPrefix(cfg.Model, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// attachmentChips renders attachments as one line of compact labels.
+func attachmentChips(atts []types.Attachment) string {
+	chips := make([]string, len(atts))
+	for i, a := range atts {
+		switch a.Kind {
+		case types.AttachmentImage:
+			chips[i] = fmt.Sprintf("[black:darkmagenta] image %s %d×%d · %s [-:-]", tview.Escape(a.Name), a.Width, a.Height, workspace.FormatSize(a.Size))
+			continue
+		case types.AttachmentCommand:
+			chips[i] = fmt.Sprintf("[black:olive] $ %s · %s [-:-]", tview.Escape(truncateRunes(a.Name, 40)), workspace.FormatSize(a.Size))
+			continue
+		case types.AttachmentContext:
+			chips[i] = fmt.Sprintf("[black:teal] context %s [-:-]", tview.Escape(a.Name))
+			continue
+		}
+		chips[i] = fmt.Sprintf("[black:darkcyan] @%s · %s [-:-]", tview.Escape(a.Name), workspace.FormatSize(a.Size))
+	}
+	return strings.Join(chips, " ")
+}
+
+func (ui *TViewUI) setupAttachmentBar() {
+	ui.AttachmentBar = tview.NewTextView().SetDynamicColors(true).SetWrap(false)
+}
+
+// updateAttachmentBar shows the pending attachments above the composer and
+// hides the bar when there are none.
+func (ui *TViewUI) updateAttachmentBar() {
+	if len(ui.pendingAttachments) == 0 {
+		ui.AttachmentBar.SetText("")
+		ui.chatFlex.ResizeItem(ui.AttachmentBar, 0, 0)
+	} else {
+		ui.AttachmentBar.SetText(attachmentChips(ui.pendingAttachments) + " [gray](Backspace on empty input removes, /detach clears)[-]")
+		ui.chatFlex.ResizeItem(ui.AttachmentBar, 1, 0)
+	}
+	ui.updateInputTitle()
+}
+
+func (ui *TViewUI) attach(atts ...types.Attachment) {
+	ui.pendingAttachments = append(ui.pendingAttachments, atts...)
+	ui.updateAttachmentBar()
+}
+
+// detach removes pending attachment n (1-based), or all of them without an argument.
+func (ui *TViewUI) detach(args []string) {
+	if len(args) == 0 {
+		ui.pendingAttachments = nil
+		ui.updateAttachmentBar()
+		return
+	}
+	var n int
+	if _, err := fmt.Sscan(args[0], &n); err != nil || n < 1 || n > len(ui.pendingAttachments) {
+		ui.appendSystemMsg(fmt.Sprintf("Usage: /detach [N], with N between 1 and %d", len(ui.pendingAttachments)))
+		return
+	}
+	ui.pendingAttachments = append(ui.pendingAttachments[:n-1], ui.pendingAttachments[n:]...)
+	ui.updateAttachmentBar()
+}
+
+// attachPath reads a file or directory of the working tree into a pending attachment.
+func (ui *TViewUI) attachPath(rel string, listing []string) error {
+	root, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if workspace.IsImage(rel) {
+		return ui.attachImage(filepath.Join(root, filepath.FromSlash(rel)), rel)
+	}
+	if !strings.HasSuffix(rel, "/") {
+		content, err := workspace.ReadText(filepath.Join(root, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+		ui.attach(types.Attachment{Kind: types.AttachmentFile, Name: rel, Content: content, Size: int64(len(content))})
+		return nil
+	}
+
+	files, skipped, err := workspace.ExpandDir(root, rel, listing)
+	if err != nil {
+		return err
+	}
+	blocks := make([]string, len(files))
+	var size int64
+	for i, f := range files {
+		blocks[i] = fileBlock(f.Path, f.Content)
+		size += int64(len(f.Content))
+	}
+	ui.attach(types.Attachment{Kind: types.AttachmentDir, Name: rel, Content: strings.Join(blocks, "\n\n"), Size: size})
+	if skipped > 0 {
+		ui.appendSystemMsg(fmt.Sprintf("Attached %d files from %s; %d binary or over-limit files were skipped (limits: %d files, %s).",
+			len(files), rel, skipped, workspace.MaxDirFiles, workspace.FormatSize(workspace.MaxDirSize)))
+	}
+	return nil
+}
+
+// showFilePicker opens a fuzzy finder over the working tree. The chosen file
+// or directory is attached and its mention replaces the "@" that opened it.
+func (ui *TViewUI) showFilePicker() {
+	root, err := os.Getwd()
+	if err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("File picker failed: %v", err))
+		return
+	}
+	listing, err := workspace.List(root)
+	if err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("File picker failed: %v", err))
+		return
+	}
+
+	query := tview.NewInputField().SetLabel("@").SetFieldWidth(0)
+	query.SetFieldBackgroundColor(tcell.ColorBlack)
+	results := tview.NewList().ShowSecondaryText(false).SetHighlightFullLine(true)
+	var shown []string
+
+	filter := func(text string) {
+		results.Clear()
+		shown = shown[:0]
+		if text == "" {
+			shown = append(shown, listing[:min(len(listing), pickerLimit)]...)
+		} else {
+			for _, m := range fuzzy.Find(text, listing) {
+				if len(shown) == pickerLimit {
+					break
+				}
+				shown = append(shown, m.Str)
+			}
+		}
+		for _, s := range shown {
+			results.AddItem(tview.Escape(s), "", 0, nil)
+		}
+	}
+	filter("")
+
+	dismiss := func() {
+		ui.Pages.RemovePage("file-picker")
+		ui.App.SetFocus(ui.InputField)
+	}
+	choose := func() {
+		idx := results.GetCurrentItem()
+		if idx < 0 || idx >= len(shown) {
+			return
+		}
+		rel := shown[idx]
+		dismiss()
+		if err := ui.attachPath(rel, listing); err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Attach failed: %v", err))
+			return
+		}
+		text := strings.TrimSuffix(ui.InputField.GetText(), "@")
+		ui.InputField.SetText(text + "@" + rel + " ")
+	}
+
+	query.SetChangedFunc(filter)
+	query.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyUp, tcell.KeyDown, tcell.KeyPgUp, tcell.KeyPgDn:
+			results.InputHandler()(event, nil)
+			return nil
+		case tcell.KeyEnter:
+			choose()
+			return nil
+		case tcell.KeyEsc:
+			dismiss()
+			return nil
+		}
+		return event
+	})
+	results.SetSelectedFunc(func(int, string, string, rune) { choose() })
+
+	box := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(query, 1, 0, true).
+		AddItem(results, 0, 1, false)
+	box.SetBorder(true).SetTitle(" Attach File (type to filter, Enter to attach, Esc to cancel) ").SetTitleAlign(tview.AlignLeft)
+
+	modal := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
+			AddItem(nil, 0, 1, false).
+			AddItem(box, 80, 1, true).
+			AddItem(nil, 0, 1, false), 20, 1, true).
+		AddItem(nil, 0, 1, false)
+	ui.Pages.AddPage("file-picker", modal, true, true)
+	ui.App.SetFocus(query)
+}
+
+// attachImage reads the image at name into a pending attachment labelled label.
+func (ui *TViewUI) attachImage(name, label string) error {
+	img, err := workspace.ReadImage(name)
+	if err != nil {
+		return err
+	}
+	ui.attach(types.Attachment{
+		Kind:   types.AttachmentImage,
+		Name:   label,
+		Size:   int64(len(img.Data)),
+		MIME:   img.MIME,
+		Data:   img.Data,
+		Width:  img.Width,
+		Height: img.Height,
+	})
+	if !ui.visionModel() {
+		ui.appendSystemMsg(fmt.Sprintf("Note: %s is not listed in vision_models, so images are not sent to it.", ui.config.Model))
+	}
+	return nil
+}
+
+// readWarnTokens is the size above which /read asks to double-check an attachment.
+const readWarnTokens = 8000
+
+var lineRange = regexp.MustCompile(`^(.+):(\d+)(?:-(\d*))?$`)
+
+// readFile implements /read: it attaches a file, or a line range of it
+// written as path:from-to, to the next message.
+func (ui *TViewUI) readFile(args []string) {
+	if len(args) == 0 {
+		ui.appendSystemMsg("Usage: /read <path>[:from-to]")
+		return
+	}
+	arg := strings.Join(args, " ")
+	name, from, to := arg, 0, 0
+	if m := lineRange.FindStringSubmatch(arg); m != nil {
+		if _, err := os.Stat(arg); err != nil {
+			name = m[1]
+			from, _ = strconv.Atoi(m[2])
+			to = from
+			if m[3] != "" {
+				to, _ = strconv.Atoi(m[3])
+			} else if strings.HasSuffix(arg, "-") {
+				to = 0
+			}
+		}
+	}
+
+	if from > 0 && to > 0 && to < from {
+		ui.appendSystemMsg(fmt.Sprintf("Invalid line range %d-%d", from, to))
+		return
+	}
+	read := func(limit int64) (string, error) {
+		if from > 0 {
+			return workspace.ReadRangeLimit(name, from, to, limit)
+		}
+		return workspace.ReadTextLimit(name, limit)
+	}
+	content, err := read(workspace.MaxFileSize)
+	if errors.Is(err, workspace.ErrTooLarge) {
+		// Large files are attached on request, up to MaxReadSize; the token
+		// warning still applies.
+		modal := tview.NewModal().
+			SetText(fmt.Sprintf("%v. Attach it anyway (up to %s)?", err, workspace.FormatSize(workspace.MaxReadSize))).
+			AddButtons([]string{"Attach", "Cancel"}).
+			SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+				ui.Pages.RemovePage("confirm-read")
+				ui.App.SetFocus(ui.InputField)
+				if buttonLabel != "Attach" {
+					return
+				}
+				content, err := read(workspace.MaxReadSize)
+				if err != nil {
+					ui.appendSystemMsg(fmt.Sprintf("Error reading file: %v", err))
+					return
+				}
+				ui.attachRead(name, from, to, content)
+			})
+		ui.Pages.AddPage("confirm-read", modal, true, true)
+		return
+	}
+	if err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Error reading file: %v", err))
+		return
+	}
+	ui.attachRead(name, from, to, content)
+}
+
+// attachRead attaches what /read read from name, warning when it takes up a
+// good part of the context window.
+func (ui *TViewUI) attachRead(name string, from, to int, content string) {
+	label := filepath.ToSlash(name)
+	if from > 0 {
+		label = fmt.Sprintf("%s:%d-", label, from)
+		if to > 0 {
+			label += strconv.Itoa(to)
+		}
+	}
+	a := types.Attachment{Kind: types.AttachmentFile, Name: label, Content: content, Size: int64(len(content))}
+	ui.attach(a)
+	if n := tokens.Estimate(attachmentText(a)); n > min(readWarnTokens, ui.contextLimit()/4) {
+		ui.appendSystemMsg(fmt.Sprintf("Warning: %s is about %d tokens of a %d token window. Use /detach to drop it or /read %s:from-to for a part.",
+			label, n, ui.contextLimit(), filepath.ToSlash(name)))
+	}
+}
@@ -0,0 +1,167 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/workspace"
+)
+
+func (ui *TViewUI) backupDir() string {
+	if ui.config.BackupDir != "" {
+		return ui.config.BackupDir
+	}
+	return storage.BackupDir()
+}
+
+// backupStore returns the store for backups and restores, telling the user
+// when the storage is a directory of files, which is better kept in git.
+func (ui *TViewUI) backupStore() (storage.BackupStore, bool) {
+	bs, ok := ui.storage.(storage.BackupStore)
+	if !ok {
+		ui.appendSystemMsg("Backups need the SQLite storage; keep the files storage directory in git instead.")
+	}
+	return bs, ok
+}
+
+// lastBackupText describes the newest backup for the settings page.
+func (ui *TViewUI) lastBackupText() string {
+	if _, ok := ui.storage.(storage.BackupStore); !ok {
+		return "not available with the files storage"
+	}
+	files, err := storage.ListBackups(ui.backupDir())
+	if err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+	if len(files) == 0 {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%s)", files[0].ModTime.Format("2006-01-02 15:04"), files[0].Name)
+}
+
+// backupNow implements /backup, copying the database in the background.
+func (ui *TViewUI) backupNow() {
+	bs, ok := ui.backupStore()
+	if !ok {
+		return
+	}
+	dir := ui.backupDir()
+	ui.appendSystemMsg("Backing up the database...")
+	ui.jobs++
+	go func() {
+		dest, err := bs.BackupTo(dir, storage.ManualBackupPrefix)
+		ui.App.QueueUpdateDraw(func() {
+			ui.jobs--
+			if err != nil {
+				ui.appendSystemMsg(fmt.Sprintf("Backup failed: %v", err))
+				return
+			}
+			ui.appendSystemMsg("Database backed up to " + dest)
+			ui.LastBackupView.SetText(ui.lastBackupText())
+		})
+	}()
+}
+
+// handleRestoreCommand implements /restore [path]; without a path it lists the backups.
+func (ui *TViewUI) handleRestoreCommand(args []string) {
+	if len(args) == 0 {
+		ui.showBackups()
+		return
+	}
+	ui.confirmRestore(strings.Join(args, " "))
+}
+
+// showBackups lists the backups to restore from.
+func (ui *TViewUI) showBackups() {
+	if _, ok := ui.backupStore(); !ok {
+		return
+	}
+	files, err := storage.ListBackups(ui.backupDir())
+	if err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Listing backups failed: %v", err))
+		return
+	}
+	if len(files) == 0 {
+		ui.appendSystemMsg(fmt.Sprintf("No backups in %s yet. Use /backup to make one.", ui.backupDir()))
+		return
+	}
+	list := tview.NewList()
+	list.SetBorder(true).SetTitle(fmt.Sprintf(" Backups in %s (Enter restore, Esc back) ", ui.backupDir()))
+	for _, f := range files {
+		list.AddItem(f.Name, fmt.Sprintf("%s, %s", f.ModTime.Format("2006-01-02 15:04"), workspace.FormatSize(f.Size)), 0, nil)
+	}
+	dismiss := func() {
+		ui.Pages.RemovePage("backups")
+		ui.App.SetFocus(ui.InputField)
+	}
+	list.SetSelectedFunc(func(idx int, _, _ string, _ rune) {
+		path := files[idx].Path
+		dismiss()
+		ui.confirmRestore(path)
+	})
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEsc {
+			dismiss()
+			return nil
+		}
+		return event
+	})
+	ui.Pages.AddPage("backups", list, true, true)
+}
+
+// restoreBlocked tells the user when a restore has to wait because answers,
+// backups or indexing still use the database it would close.
+func (ui *TViewUI) restoreBlocked() bool {
+	switch {
+	case len(ui.replies) > 0:
+		ui.appendSystemMsg("Answers are still arriving; restore once they are saved.")
+	case ui.jobs > 0:
+		ui.appendSystemMsg("A backup or an index is still being written; restore once it is done.")
+	default:
+		return false
+	}
+	return true
+}
+
+// confirmRestore checks the backup at path and replaces the database with it
+// once the user agrees.
+func (ui *TViewUI) confirmRestore(path string) {
+	bs, ok := ui.backupStore()
+	if !ok {
+		return
+	}
+	if ui.restoreBlocked() {
+		return
+	}
+	if err := storage.CheckBackup(path); err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Cannot restore %s: %v", path, err))
+		return
+	}
+	modal := tview.NewModal().
+		SetText(fmt.Sprintf("Replace all conversations with the backup %s?\n\nThe current database is backed up first.", filepath.Base(path))).
+		AddButtons([]string{"Restore", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			ui.Pages.RemovePage("confirm-restore")
+			if buttonLabel != "Restore" || ui.restoreBlocked() {
+				return
+			}
+			if err := bs.Restore(path, ui.backupDir()); err != nil {
+				ui.appendSystemMsg(fmt.Sprintf("Restore failed: %v", err))
+				return
+			}
+			ui.chunks.mu.Lock()
+			ui.chunks.id = ""
+			ui.chunks.mu.Unlock()
+			ui.resetTabs()
+			ui.LastBackupView.SetText(ui.lastBackupText())
+			ui.appendSystemMsg("Database restored from " + path)
+			if storage.Locked(ui.storage) {
+				ui.showUnlock(nil)
+			}
+		})
+	ui.Pages.AddPage("confirm-restore", modal, true, true)
+}
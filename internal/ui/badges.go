@@ -0,0 +1,87 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// spinnerFrames animate the badge of conversations waiting for an answer.
+var spinnerFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+const spinnerInterval = 120 * time.Millisecond
+
+// sidebarHistory is the index of the History item in the sidebar.
+const sidebarHistory = 1
+
+// badge marks a conversation in lists: a spinner while an answer is underway,
+// a dot when one arrived while it was not open.
+func (ui *TViewUI) badge(convID string) string {
+	switch {
+	case ui.replies[convID] != nil:
+		return fmt.Sprintf("[yellow]%c[-] ", spinnerFrames[ui.spinFrame%len(spinnerFrames)])
+	case ui.unread[convID]:
+		return "[aqua]●[-] "
+	}
+	return ""
+}
+
+// startSpinner animates the badges until no answer is underway.
+func (ui *TViewUI) startSpinner() {
+	ui.updateBadges()
+	if ui.spinning {
+		return
+	}
+	ui.spinning = true
+	go func() {
+		ticker := time.NewTicker(spinnerInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			var more bool
+			ui.App.QueueUpdateDraw(func() {
+				ui.spinFrame++
+				ui.spinning = len(ui.replies) > 0
+				more = ui.spinning
+				ui.updateBadges()
+			})
+			if !more {
+				return
+			}
+		}
+	}()
+}
+
+// updateBadges redraws the badges in the history list and the tab bar, and the
+// counts next to History in the sidebar.
+func (ui *TViewUI) updateBadges() {
+	if name, _ := ui.Pages.GetFrontPage(); name == "history" {
+		for i, c := range ui.historyConvs {
+			ui.HistoryList.SetItemText(i, ui.historyEntry(c), c.ID)
+		}
+	}
+	main, secondary := "History", "Load past chats"
+	if n := len(ui.replies); n > 0 {
+		main = fmt.Sprintf("History [yellow]%c[-]", spinnerFrames[ui.spinFrame%len(spinnerFrames)])
+		secondary = fmt.Sprintf("%d answering", n)
+	}
+	if n := len(ui.unread); n > 0 {
+		main += " [aqua]●[-]"
+		if len(ui.replies) > 0 {
+			secondary += fmt.Sprintf(", %d unread", n)
+		} else {
+			secondary = fmt.Sprintf("%d unread", n)
+		}
+	}
+	ui.Sidebar.SetItemText(sidebarHistory, main, secondary)
+	ui.drawTabBar()
+}
+
+// notify announces what became of the answer for a conversation that is not open.
+func (ui *TViewUI) notify(r *reply, what string) {
+	title := "a conversation"
+	if conv, err := ui.storage.GetConversation(r.convID); err == nil && conv.Title != "" {
+		title = "“" + conv.Title + "”"
+	}
+	ui.showNotice(fmt.Sprintf("Answer in %s %s · [yellow]Ctrl+H[-] to open it", tview.Escape(title), tview.Escape(what)))
+}
@@ -0,0 +1,42 @@
+package ui
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+)
+
+// copyToClipboard writes text to w as an OSC52 sequence, which sets the
+// terminal clipboard and also works over SSH. Inside tmux or screen the
+// sequence is wrapped so it reaches the outer terminal.
+func copyToClipboard(w io.Writer, text string) error {
+	seq := osc52.New(text)
+	if os.Getenv("TMUX") != "" {
+		seq = seq.Tmux()
+	} else if strings.HasPrefix(os.Getenv("TERM"), "screen") {
+		seq = seq.Screen()
+	}
+	_, err := seq.WriteTo(w)
+	return err
+}
+
+// copyText copies text to the clipboard through the terminal tcell draws on,
+// so it works when stderr is redirected. Without one it opens /dev/tty.
+func (ui *TViewUI) copyText(text string) error {
+	if ui.clipboard != nil {
+		return copyToClipboard(ui.clipboard, text)
+	}
+	if ui.screen != nil {
+		if tty, ok := ui.screen.Tty(); ok {
+			return copyToClipboard(tty, text)
+		}
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+	return copyToClipboard(tty, text)
+}
@@ -0,0 +1,374 @@
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rivo/tview"
+	"github.com/sashabaranov/go-openai"
+)
+
+// codeBlock is a fenced code block found in an assistant message.
+type codeBlock struct {
+	Lang string
+	Code string
+}
+
+// fenceExt maps fence language hints to file extensions for /write suggestions.
+var fenceExt = map[string]string{
+	"go": "go", "golang": "go",
+	"python": "py", "py": "py",
+	"javascript": "js", "js": "js", "jsx": "jsx",
+	"typescript": "ts", "ts": "ts", "tsx": "tsx",
+	"rust": "rs", "rs": "rs",
+	"bash": "sh", "sh": "sh", "shell": "sh", "zsh": "sh",
+	"json": "json", "yaml": "yaml", "yml": "yaml", "toml": "toml",
+	"html": "html", "css": "css", "sql": "sql",
+	"java": "java", "kotlin": "kt", "swift": "swift",
+	"c": "c", "cpp": "cpp", "c++": "cpp", "csharp": "cs", "cs": "cs",
+	"ruby": "rb", "rb": "rb", "php": "php", "lua": "lua",
+	"markdown": "md", "md": "md",
+	"diff": "patch", "patch": "patch",
+}
+
+// scanFences calls fn for every fenced block in markdown with the line index
+// and indentation of its opening fence. Fences follow CommonMark: at most
+// three spaces of indentation, and a closing fence of the same character at
+// least as long as the opening one. Unterminated blocks run to the end of the
+// text.
+func scanFences(markdown string, fn func(openLine int, indent string, b codeBlock)) {
+	lines := strings.Split(markdown, "\n")
+	for i := 0; i < len(lines); i++ {
+		indent, fence, info, ok := openingFence(lines[i])
+		if !ok {
+			continue
+		}
+		lang := ""
+		if f := strings.Fields(info); len(f) > 0 {
+			lang = strings.ToLower(f[0])
+		}
+		open := i
+		var body []string
+		for i++; i < len(lines); i++ {
+			if closingFence(lines[i], fence) {
+				break
+			}
+			// Content lines lose up to as much indentation as the fence had.
+			l := lines[i]
+			for k := 0; k < len(indent) && strings.HasPrefix(l, " "); k++ {
+				l = l[1:]
+			}
+			body = append(body, l)
+		}
+		fn(open, indent, codeBlock{Lang: lang, Code: strings.Join(body, "\n")})
+	}
+}
+
+// openingFence reports whether line opens a fenced block, returning its
+// indentation, the fence itself and the info string after it.
+func openingFence(line string) (indent, fence, info string, ok bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return "", "", "", false
+	}
+	fence = fenceMarker(trimmed)
+	if fence == "" {
+		return "", "", "", false
+	}
+	info = strings.TrimSpace(trimmed[len(fence):])
+	// A backtick in the info string makes the line inline code instead.
+	if fence[0] == '`' && strings.Contains(info, "`") {
+		return "", "", "", false
+	}
+	return line[:len(line)-len(trimmed)], fence, info, true
+}
+
+// closingFence reports whether line closes a block opened with fence.
+func closingFence(line, fence string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return false
+	}
+	marker := fenceMarker(trimmed)
+	return len(marker) >= len(fence) && marker[0] == fence[0] &&
+		strings.TrimSpace(trimmed[len(marker):]) == ""
+}
+
+func fenceMarker(line string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 {
+			return strings.Repeat(c, n)
+		}
+	}
+	return ""
+}
+
+func extractCodeBlocks(markdown string) []codeBlock {
+	var blocks []codeBlock
+	scanFences(markdown, func(_ int, _ string, b codeBlock) {
+		blocks = append(blocks, b)
+	})
+	return blocks
+}
+
+// numberCodeBlocks puts a "code #N" label above every fenced block, numbering
+// from next, and returns the annotated markdown and the next free number.
+// Labels are indented like their fence so blocks inside list items stay there.
+func numberCodeBlocks(markdown string, next int) (string, int) {
+	lines := strings.Split(markdown, "\n")
+	labels := make(map[int]string)
+	scanFences(markdown, func(open int, indent string, b codeBlock) {
+		label := fmt.Sprintf("*code #%d*", next)
+		if b.Lang != "" {
+			label = fmt.Sprintf("*code #%d · %s*", next, b.Lang)
+		}
+		labels[open] = indent + label
+		next++
+	})
+	if len(labels) == 0 {
+		return markdown, next
+	}
+	var sb strings.Builder
+	for i, l := range lines {
+		if label, ok := labels[i]; ok {
+			sb.WriteString("\n" + label + "\n\n")
+		}
+		sb.WriteString(l)
+		if i < len(lines)-1 {
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String(), next
+}
+
+// codeBlocks returns the code blocks of all assistant messages, in the order
+// they are numbered in the transcript.
+func (ui *TViewUI) codeBlocks() []codeBlock {
+	var blocks []codeBlock
+	for _, m := range ui.messages {
+		if m.Role == openai.ChatMessageRoleAssistant {
+			blocks = append(blocks, extractCodeBlocks(m.Content)...)
+		}
+	}
+	return blocks
+}
+
+func (ui *TViewUI) codeBlockArg(args []string, usage string) (codeBlock, int, bool) {
+	if len(args) == 0 {
+		ui.appendSystemMsg("Usage: " + usage)
+		return codeBlock{}, 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+	blocks := ui.codeBlocks()
+	if err != nil || n < 1 || n > len(blocks) {
+		ui.appendSystemMsg(fmt.Sprintf("No code block %s (this chat has %d).", args[0], len(blocks)))
+		return codeBlock{}, 0, false
+	}
+	return blocks[n-1], n, true
+}
+
+func (ui *TViewUI) copyCodeBlock(args []string) {
+	b, n, ok := ui.codeBlockArg(args, "/copy <N>")
+	if !ok {
+		return
+	}
+	if err := ui.copyText(b.Code + "\n"); err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Copy failed: %v", err))
+		return
+	}
+	ui.appendSystemMsg(fmt.Sprintf("Code block #%d copied to clipboard.", n))
+}
+
+// writeCodeBlock saves a block to a file. Without a path it pre-fills the
+// composer with a suggested name; existing files get a diff preview first.
+func (ui *TViewUI) writeCodeBlock(args []string) {
+	b, n, ok := ui.codeBlockArg(args, "/write <N> [path]")
+	if !ok {
+		return
+	}
+	if len(args) < 2 {
+		ext := fenceExt[b.Lang]
+		if ext == "" {
+			ext = "txt"
+		}
+		ui.InputField.SetText(fmt.Sprintf("/write %d snippet-%d.%s", n, n, ext))
+		return
+	}
+	path := args[1]
+	content := b.Code + "\n"
+	old, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			ui.appendSystemMsg(fmt.Sprintf("Error reading file: %v", err))
+			return
+		}
+		ui.saveCodeBlock(path, content)
+		return
+	}
+	if string(old) == content {
+		ui.appendSystemMsg(path + " already has this content.")
+		return
+	}
+	ui.showPreviewModal(fmt.Sprintf(" Overwrite %s? ", path), colorDiff(lineDiff(string(old), content)), "Overwrite", func() {
+		ui.saveCodeBlock(path, content)
+	})
+}
+
+func (ui *TViewUI) saveCodeBlock(path, content string) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Save failed: %v", err))
+			return
+		}
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Save failed: %v", err))
+		return
+	}
+	ui.appendSystemMsg("Code saved to " + path)
+}
+
+// applyCodeBlock applies a unified diff to the working tree after a
+// `git apply --check` dry run succeeds and the user confirms.
+func (ui *TViewUI) applyCodeBlock(args []string) {
+	b, n, ok := ui.codeBlockArg(args, "/apply <N>")
+	if !ok {
+		return
+	}
+	patch := b.Code + "\n"
+	if out, err := gitApply(patch, "--check"); err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Code block #%d does not apply cleanly: %v\n%s", n, err, out))
+		return
+	}
+	ui.showPreviewModal(fmt.Sprintf(" Apply patch #%d? ", n), colorDiff(strings.Split(b.Code, "\n")), "Apply", func() {
+		if out, err := gitApply(patch); err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Apply failed: %v\n%s", err, out))
+			return
+		}
+		ui.appendSystemMsg(fmt.Sprintf("Patch #%d applied.", n))
+	})
+}
+
+func gitApply(patch string, flags ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"apply"}, append(flags, "-")...)...)
+	cmd.Stdin = strings.NewReader(patch)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return strings.TrimSpace(out.String()), err
+}
+
+// showPreviewModal shows body in a scrollable box with a confirm and a cancel button.
+func (ui *TViewUI) showPreviewModal(title, body, confirm string, onConfirm func()) {
+	view := tview.NewTextView().
+		SetDynamicColors(true).
+		SetText(body)
+	view.SetBorder(true).SetTitle(title)
+
+	dismiss := func() {
+		ui.Pages.RemovePage("preview")
+		ui.App.SetFocus(ui.InputField)
+	}
+	buttons := tview.NewForm().
+		AddButton(confirm, func() {
+			dismiss()
+			onConfirm()
+		}).
+		AddButton("Cancel", dismiss)
+	buttons.SetButtonsAlign(tview.AlignCenter)
+	buttons.SetCancelFunc(dismiss)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(view, 0, 1, false).
+		AddItem(buttons, 3, 1, true)
+	ui.Pages.AddPage("preview", layout, true, true)
+}
+
+// lineDiff returns a line diff of a and b with " ", "-" and "+" prefixes,
+// keeping up to two lines of context around each change.
+func lineDiff(a, b string) []string {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+	if len(x)*len(y) > 4_000_000 {
+		return []string{fmt.Sprintf("@@ too large to preview: %d lines -> %d lines @@", len(x), len(y))}
+	}
+	// lcs[i][j] is the LCS length of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var full []string
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			full = append(full, " "+x[i])
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			full = append(full, "-"+x[i])
+			i++
+		default:
+			full = append(full, "+"+y[j])
+			j++
+		}
+	}
+
+	const context = 2
+	var out []string
+	last := -1
+	for k, l := range full {
+		if l[0] == ' ' {
+			continue
+		}
+		from := max(k-context, last+1)
+		if last >= 0 && from > last+1 {
+			out = append(out, "@@")
+		}
+		for c := from; c <= k; c++ {
+			out = append(out, full[c])
+		}
+		last = k
+		for c := k + 1; c < len(full) && c <= k+context && full[c][0] == ' '; c++ {
+			out = append(out, full[c])
+			last = c
+		}
+	}
+	return out
+}
+
+func colorDiff(lines []string) string {
+	var sb strings.Builder
+	for _, l := range lines {
+		color := ""
+		switch {
+		case strings.HasPrefix(l, "+"):
+			color = "green"
+		case strings.HasPrefix(l, "-"):
+			color = "red"
+		case strings.HasPrefix(l, "@@"):
+			color = "aqua"
+		}
+		if color != "" {
+			fmt.Fprintf(&sb, "[%s]%s[-]\n", color, tview.Escape(l))
+		} else {
+			sb.WriteString(tview.Escape(l) + "\n")
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,124 @@
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark"
+)
+
+func TestScanFences(t *testing.T) {
+	type fence struct {
+		open   int
+		indent string
+		block  codeBlock
+	}
+	tests := []struct {
+		name     string
+		markdown string
+		want     []fence
+	}{
+		{"plain", "Run:\n```go\nfmt.Println()\n```\ndone",
+			[]fence{{1, "", codeBlock{"go", "fmt.Println()"}}}},
+		{"first info word, lower case", "```Go title=main.go\nx\n```",
+			[]fence{{0, "", codeBlock{"go", "x"}}}},
+		{"tildes", "~~~\n```\n~~~",
+			[]fence{{0, "", codeBlock{"", "```"}}}},
+		{"shorter fence does not close", "````md\n```go\nx\n```\n````",
+			[]fence{{0, "", codeBlock{"md", "```go\nx\n```"}}}},
+		{"longer fence closes", "```\nx\n`````\ny",
+			[]fence{{0, "", codeBlock{"", "x"}}}},
+		{"closing fence indented four spaces", "```\na\n    ```\nb\n```",
+			[]fence{{0, "", codeBlock{"", "a\n    ```\nb"}}}},
+		{"closing fence indented three spaces", "```\na\n   ```\nb",
+			[]fence{{0, "", codeBlock{"", "a"}}}},
+		{"text after closing fence", "```\na\n``` b\n```",
+			[]fence{{0, "", codeBlock{"", "a\n``` b"}}}},
+		{"opening fence indented four spaces", "    ```go\n    x\n    ```", nil},
+		{"backticks in the info string", "```not a fence```\nx", nil},
+		{"list item", "1. Build:\n\n   ```sh\n   make\n     -j4\n   ```\n2. Test",
+			[]fence{{2, "   ", codeBlock{"sh", "make\n  -j4"}}}},
+		{"unterminated", "```py\nx = 1\n", []fence{{0, "", codeBlock{"py", "x = 1\n"}}}},
+		{"two blocks", "```\na\n```\n\n~~~js\nb\n~~~",
+			[]fence{{0, "", codeBlock{"", "a"}}, {4, "", codeBlock{"js", "b"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []fence
+			scanFences(tt.markdown, func(open int, indent string, b codeBlock) {
+				got = append(got, fence{open, indent, b})
+			})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumberCodeBlocks(t *testing.T) {
+	out, next := numberCodeBlocks("Intro\n```go\nx\n```\n```\ny\n```", 3)
+	if next != 5 {
+		t.Errorf("next = %d, want 5", next)
+	}
+	want := "Intro\n\n*code #3 · go*\n\n```go\nx\n```\n\n*code #4*\n\n```\ny\n```"
+	if out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+// A label inside a list item has to stay there, or the list ends at the label
+// and the block is rendered as an indented paragraph after it.
+func TestNumberCodeBlocksInList(t *testing.T) {
+	out, _ := numberCodeBlocks("1. Build:\n\n   ```sh\n   make\n   ```\n2. Test", 1)
+	var html bytes.Buffer
+	if err := goldmark.Convert([]byte(out), &html); err != nil {
+		t.Fatal(err)
+	}
+	got := html.String()
+	if strings.Count(got, "<ol>") != 1 || strings.Count(got, "<li>") != 2 {
+		t.Fatalf("list split up:\n%s", got)
+	}
+	item := got[strings.Index(got, "<li>"):strings.Index(got, "</li>")]
+	for _, want := range []string{"<em>code #1 · sh</em>", `<pre><code class="language-sh">make`} {
+		if !strings.Contains(item, want) {
+			t.Errorf("first item lacks %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	lines := func(from, to int) string {
+		var l []string
+		for i := from; i <= to; i++ {
+			l = append(l, fmt.Sprint(i))
+		}
+		return strings.Join(l, "\n")
+	}
+	tests := []struct {
+		name string
+		a, b string
+		want []string
+	}{
+		{"same", "a\nb", "a\nb", nil},
+		{"changed line with context", lines(1, 7), strings.Replace(lines(1, 7), "4", "four", 1),
+			[]string{" 2", " 3", "-4", "+four", " 5", " 6"}},
+		{"appended", "a\nb", "a\nb\nc", []string{" a", " b", "+c"}},
+		{"removed", "a\nb\nc", "a\nc", []string{" a", "-b", " c"}},
+		{"separate hunks", lines(1, 10), "one\n" + lines(2, 9) + "\nten",
+			[]string{"-1", "+one", " 2", " 3", "@@", " 8", " 9", "-10", "+ten"}},
+		{"adjacent hunks merge", lines(1, 6), "one\n" + lines(2, 4) + "\nfive\n6",
+			[]string{"-1", "+one", " 2", " 3", " 4", "-5", "+five", " 6"}},
+		{"too large", lines(1, 2001), lines(2, 2002),
+			[]string{"@@ too large to preview: 2001 lines -> 2001 lines @@"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lineDiff(tt.a, tt.b); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
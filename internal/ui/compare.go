@@ -0,0 +1,411 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/sashabaranov/go-openai"
+	"github.com/evallife/chat-tui/internal/api"
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/tokens"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// maxCompare is how many answers fit side by side.
+const maxCompare = 4
+
+// comparison sends each question asked in one tab to several models at once
+// and shows their answers in columns under the transcript. Only the answer
+// picked with /pick is saved, as the conversation's continuation.
+type comparison struct {
+	tab     *tab
+	columns []*compareColumn
+	flex    *tview.Flex
+	round   *reply // the question whose answers wait for a pick, nil when none do
+	cancel  context.CancelFunc
+}
+
+// compareColumn is one model of a comparison with its answer to the current
+// question. The answer fields are only touched on the UI goroutine.
+type compareColumn struct {
+	label  string
+	config types.Config
+	client *api.Client
+	view   *tview.TextView
+	stats  *tview.TextView
+
+	text         strings.Builder
+	done         bool
+	err          error
+	firstToken   time.Duration // 0 until the first token arrives
+	elapsed      time.Duration
+	promptTokens int
+	answerTokens int
+	usage        bool // the token counts come from the API, not from estimates
+}
+
+// compareConfig returns the settings for name: a profile from the config, or
+// else a model on the main endpoint.
+func compareConfig(cfg types.Config, name string) types.Config {
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		cfg.Model = name
+		return cfg
+	}
+	if p.BaseURL != "" {
+		cfg.BaseURL = p.BaseURL
+	}
+	if p.APIKey != "" {
+		cfg.APIKey = p.APIKey
+	}
+	if p.Model != "" {
+		cfg.Model = p.Model
+	}
+	return cfg
+}
+
+// comparing returns the comparison of the tab in front, if it has one.
+func (ui *TViewUI) comparing() *comparison {
+	if ui.compare != nil && ui.compare.tab == ui.tabs[ui.tab] {
+		return ui.compare
+	}
+	return nil
+}
+
+// layoutChatArea shows the comparison columns under the transcript while the
+// tab in front compares models.
+func (ui *TViewUI) layoutChatArea() {
+	ui.chatArea.Clear()
+	ui.chatArea.AddItem(ui.ChatView, 0, 1, false)
+	if c := ui.comparing(); c != nil {
+		ui.chatArea.AddItem(c.flex, 0, 3, false)
+	}
+}
+
+// handleCompareCommand implements /compare.
+func (ui *TViewUI) handleCompareCommand(args []string) {
+	if len(args) == 0 {
+		if c := ui.comparing(); c != nil {
+			labels := make([]string, len(c.columns))
+			for i, col := range c.columns {
+				labels[i] = col.label
+			}
+			ui.appendSystemMsg(fmt.Sprintf("Comparing %s. /pick N keeps an answer, /compare off stops.", strings.Join(labels, ", ")))
+			return
+		}
+		msg := fmt.Sprintf("Usage: /compare <model|profile> <model|profile>... (up to %d), /compare off", maxCompare)
+		if len(ui.config.Profiles) > 0 {
+			names := make([]string, 0, len(ui.config.Profiles))
+			for name := range ui.config.Profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			msg += "\nProfiles: " + strings.Join(names, ", ")
+		}
+		ui.appendSystemMsg(msg)
+		return
+	}
+	if args[0] == "off" {
+		if ui.comparing() == nil {
+			ui.appendSystemMsg("Not comparing.")
+			return
+		}
+		ui.endCompare()
+		ui.appendSystemMsg("Stopped comparing.")
+		return
+	}
+	if len(args) < 2 || len(args) > maxCompare {
+		ui.appendSystemMsg(fmt.Sprintf("Compare 2 to %d models or profiles.", maxCompare))
+		return
+	}
+	ui.endCompare()
+	c := &comparison{tab: ui.tabs[ui.tab], flex: tview.NewFlex().SetDirection(tview.FlexColumn)}
+	for i, name := range args {
+		col := ui.newCompareColumn(i, name)
+		c.columns = append(c.columns, col)
+		c.flex.AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(col.view, 0, 1, false).
+			AddItem(col.stats, 1, 0, false), 0, 1, false)
+	}
+	ui.compare = c
+	ui.layoutChatArea()
+	ui.appendSystemMsg(fmt.Sprintf("Comparing %d models. Each question goes to all of them; keep one answer with /pick N.", len(args)))
+}
+
+func (ui *TViewUI) newCompareColumn(i int, name string) *compareColumn {
+	cfg := compareConfig(ui.config, name)
+	col := &compareColumn{label: name, config: cfg, client: api.NewClient(cfg)}
+	if name != cfg.Model {
+		col.label = fmt.Sprintf("%s (%s)", name, cfg.Model)
+	}
+	col.view = tview.NewTextView().
+		SetDynamicColors(true).
+		SetWordWrap(true)
+	col.view.SetBorder(true).SetTitle(fmt.Sprintf(" %d %s ", i+1, col.label))
+	col.view.SetTitleColor(tcell.ColorLightSkyBlue)
+	col.stats = tview.NewTextView().SetDynamicColors(true)
+	return col
+}
+
+// endCompare stops comparing, dropping answers that were not picked.
+func (ui *TViewUI) endCompare() {
+	c := ui.compare
+	if c == nil {
+		return
+	}
+	if c.round != nil {
+		c.cancel()
+		ui.dropReply(c.round)
+	}
+	ui.compare = nil
+	ui.layoutChatArea()
+}
+
+// awaitingPick tells the user when the answers to the last question have to
+// be picked from before asking the next one.
+func (ui *TViewUI) awaitingPick() bool {
+	if c := ui.comparing(); c == nil || c.round == nil {
+		return false
+	}
+	ui.appendSystemMsg("Keep one of the answers with /pick N first, or stop comparing with /compare off.")
+	return true
+}
+
+// compareRound sends the question in r to every model of its comparison.
+// Turns that do not fit a model's context window are dropped, never summarized.
+func (ui *TViewUI) compareRound(r *reply) {
+	c := r.compare
+	if ui.compare != c {
+		// Stopped comparing while retrieval ran
+		ui.sendMessages(r)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.round, c.cancel = r, cancel
+	for _, col := range c.columns {
+		plan := planMessages(r.messages, r.systemPrompt, tokens.Limit(col.config.Model, col.config.ContextLimits), nil)
+		col.text.Reset()
+		col.done, col.err = false, nil
+		col.firstToken, col.elapsed = 0, 0
+		col.promptTokens, col.answerTokens, col.usage = plan.Tokens, 0, false
+		col.view.SetText("")
+		col.view.SetTitle(strings.TrimSuffix(col.view.GetTitle(), "· kept "))
+		ui.drawColumnStats(col)
+		go ui.streamColumn(ctx, c, r, col, requestMessages(r.messages, r.systemPrompt, isVisionModel(col.config), plan))
+	}
+}
+
+// streamColumn streams the answer of one model; updates for a round that has
+// been picked from or stopped are dropped.
+func (ui *TViewUI) streamColumn(ctx context.Context, c *comparison, r *reply, col *compareColumn, msgs []openai.ChatCompletionMessage) {
+	start := time.Now()
+	update := func(f func()) {
+		ui.App.QueueUpdateDraw(func() {
+			if c.round == r {
+				f()
+			}
+		})
+	}
+	stream, err := col.client.StreamChatWithUsage(ctx, msgs)
+	if err != nil {
+		elapsed := time.Since(start)
+		update(func() { ui.finishColumn(c, col, elapsed, err, nil) })
+		return
+	}
+	defer stream.Close()
+
+	var usage *openai.Usage
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			elapsed := time.Since(start)
+			update(func() { ui.finishColumn(c, col, elapsed, err, nil) })
+			return
+		}
+		if response.Usage != nil {
+			usage = response.Usage
+		}
+		if len(response.Choices) == 0 || response.Choices[0].Delta.Content == "" {
+			continue
+		}
+		content, at := response.Choices[0].Delta.Content, time.Since(start)
+		update(func() {
+			if col.firstToken == 0 {
+				col.firstToken = at
+			}
+			col.elapsed = at
+			col.text.WriteString(content)
+			fmt.Fprint(col.view, tview.Escape(content))
+			col.view.ScrollToEnd()
+			ui.drawColumnStats(col)
+		})
+	}
+	elapsed := time.Since(start)
+	update(func() { ui.finishColumn(c, col, elapsed, nil, usage) })
+}
+
+// finishColumn shows the complete answer of col rendered as Markdown. Once
+// every model is done the question no longer counts as busy.
+func (ui *TViewUI) finishColumn(c *comparison, col *compareColumn, elapsed time.Duration, err error, usage *openai.Usage) {
+	col.done, col.err, col.elapsed = true, err, elapsed
+	if usage != nil && usage.CompletionTokens > 0 {
+		col.promptTokens, col.answerTokens, col.usage = usage.PromptTokens, usage.CompletionTokens, true
+	} else {
+		col.answerTokens = tokens.Estimate(col.text.String())
+	}
+	_, _, width, _ := col.view.GetInnerRect()
+	if width <= 2 {
+		width = 40
+	}
+	var sb strings.Builder
+	if col.text.Len() > 0 {
+		sb.WriteString(ui.render.Render(col.text.String(), width-2))
+	}
+	if err != nil {
+		fmt.Fprintf(&sb, "\n[red]%s[-]", tview.Escape(err.Error()))
+	}
+	col.view.SetText(sb.String())
+	col.view.ScrollToBeginning()
+	ui.drawColumnStats(col)
+
+	for _, other := range c.columns {
+		if !other.done {
+			return
+		}
+	}
+	r := c.round
+	ui.dropReply(r)
+	if ui.current(r) {
+		ui.appendSystemMsg("All answers are in. Keep one with /pick N.")
+		return
+	}
+	ui.unread[r.convID] = true
+	ui.notify(r, "is ready to compare")
+}
+
+// drawColumnStats shows the latency and token counts under a column; counts
+// the API did not report are estimated and marked with ~.
+func (ui *TViewUI) drawColumnStats(col *compareColumn) {
+	var parts []string
+	switch {
+	case col.firstToken > 0:
+		parts = append(parts, fmt.Sprintf("first token %.1fs", col.firstToken.Seconds()))
+	case !col.done:
+		parts = append(parts, "waiting...")
+	}
+	if col.elapsed > 0 {
+		elapsed := fmt.Sprintf("%.1fs", col.elapsed.Seconds())
+		if !col.done {
+			elapsed += "..."
+		}
+		parts = append(parts, elapsed)
+	}
+	if col.done && col.err == nil {
+		approx := "~"
+		if col.usage {
+			approx = ""
+		}
+		parts = append(parts, fmt.Sprintf("%s%s in / %s%s out", approx, shortCount(col.promptTokens), approx, shortCount(col.answerTokens)))
+	}
+	color := "gray"
+	if col.err != nil {
+		color = "red"
+		parts = append(parts, "failed")
+	}
+	col.stats.SetText(fmt.Sprintf("[%s] %s[-]", color, strings.Join(parts, " · ")))
+}
+
+// conversationGone reports whether conversation id was deleted, to the trash
+// or for good.
+func (ui *TViewUI) conversationGone(id string) (bool, error) {
+	if exists, err := ui.storage.HasConversation(id); err != nil || !exists {
+		return true, err
+	}
+	trash, err := ui.storage.ListTrash()
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(trash, func(c storage.ConvSummary) bool { return c.ID == id }), nil
+}
+
+// pickAnswer implements /pick: answer N is saved to the conversation as its
+// continuation and the others are dropped.
+func (ui *TViewUI) pickAnswer(args []string) {
+	c := ui.comparing()
+	if c == nil {
+		ui.appendSystemMsg("Not comparing. Start with /compare <model> <model>.")
+		return
+	}
+	if c.round == nil {
+		ui.appendSystemMsg("There are no answers to pick from yet.")
+		return
+	}
+	if len(args) != 1 {
+		ui.appendSystemMsg("Usage: /pick <N>")
+		return
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > len(c.columns) {
+		ui.appendSystemMsg(fmt.Sprintf("Pick an answer from 1 to %d.", len(c.columns)))
+		return
+	}
+	col := c.columns[n-1]
+	switch {
+	case !col.done:
+		ui.appendSystemMsg(fmt.Sprintf("Answer %d is still arriving.", n))
+		return
+	case col.err != nil || col.text.Len() == 0:
+		ui.appendSystemMsg(fmt.Sprintf("Answer %d failed; pick another one.", n))
+		return
+	}
+
+	r := c.round
+	if gone, err := ui.conversationGone(r.convID); err != nil || gone {
+		c.cancel()
+		c.round = nil
+		ui.dropReply(r)
+		if err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Saving answer failed: %v", err))
+		} else {
+			ui.appendSystemMsg("The conversation was deleted; the answer was not saved.")
+		}
+		return
+	}
+	answer := col.text.String()
+	msgID, err := ui.storage.SaveMessage(r.convID, openai.ChatMessageRoleAssistant, answer)
+	if err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Saving answer failed: %v", err))
+		return
+	}
+	c.cancel()
+	c.round = nil
+	ui.dropReply(r)
+	col.view.SetTitle(col.view.GetTitle() + "· kept ")
+
+	msg := types.Message{
+		ID:      msgID,
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: answer,
+	}
+	r.messages = append(r.messages, msg)
+	if question, ok := firstExchange(r.messages); ok {
+		ui.startTitle(r, question, answer)
+	}
+	if ui.current(r) {
+		ui.messages = append(ui.messages, msg)
+		ui.refreshChat()
+	}
+	ui.appendSystemMsg(fmt.Sprintf("Kept the answer of %s.", col.label))
+}
@@ -0,0 +1,79 @@
+package ui
+
+import (
+	"testing"
+)
+
+// compareAnswers asks a question while comparing two models and waits until
+// both answers are in. Both must have started before either may finish.
+func compareAnswers(t *testing.T) (ui *TViewUI, convID string) {
+	t.Helper()
+	release := make(chan struct{})
+	ui, _ = startUI(t, fakeAPI(t, release).URL)
+	do(ui, func() {
+		ui.handleInput("/compare gpt-4o gpt-4o-mini")
+		ui.handleInput("Question")
+		convID = ui.convID
+	})
+	waitFor(t, ui, "both answers to start", func() bool {
+		c := ui.comparing()
+		return c != nil && c.columns[0].text.String() == "Hello " && c.columns[1].text.String() == "Hello "
+	})
+	close(release)
+	waitFor(t, ui, "both answers to arrive", func() bool {
+		c := ui.comparing()
+		return c.columns[0].done && c.columns[1].done
+	})
+	do(ui, func() {
+		for i, want := range []string{"Hello from gpt-4o", "Hello from gpt-4o-mini"} {
+			if col := ui.compare.columns[i]; col.err != nil || col.text.String() != want {
+				t.Errorf("column %d has %q, %v, want %q", i+1, col.text.String(), col.err, want)
+			}
+		}
+	})
+	return ui, convID
+}
+
+func TestComparePick(t *testing.T) {
+	ui, id := compareAnswers(t)
+	do(ui, func() { ui.handleInput("/pick 2") })
+
+	msgs, err := ui.storage.ListMessages(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[1].Content != "Hello from gpt-4o-mini" {
+		t.Fatalf("conversation holds %+v, want the question and the second answer", msgs)
+	}
+	do(ui, func() {
+		if ui.compare.round != nil || len(ui.replies) != 0 {
+			t.Error("the round is still open after the pick")
+		}
+		if n := len(ui.messages); n != 2 || ui.messages[1].Content != "Hello from gpt-4o-mini" {
+			t.Errorf("chat shows %d messages", n)
+		}
+	})
+}
+
+// TestComparePickTrashed picks an answer after the conversation went to the
+// trash: it must stay as it was.
+func TestComparePickTrashed(t *testing.T) {
+	ui, id := compareAnswers(t)
+	if err := ui.storage.DeleteConversation(id); err != nil {
+		t.Fatal(err)
+	}
+	do(ui, func() { ui.handleInput("/pick 1") })
+
+	msgs, err := ui.storage.ListMessages(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("trashed conversation holds %+v, want the question only", msgs)
+	}
+	do(ui, func() {
+		if ui.compare.round != nil || len(ui.replies) != 0 {
+			t.Error("the round is still open after the pick")
+		}
+	})
+}
@@ -0,0 +1,277 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rivo/tview"
+	"github.com/sashabaranov/go-openai"
+	"github.com/evallife/chat-tui/internal/tokens"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// maxReplyReserve caps the part of the context window kept free for the answer.
+const maxReplyReserve = 2048
+
+const summaryInstruction = "Summarize the following earlier part of a conversation so it can replace it as context. " +
+	"Keep facts, decisions, names, code identifiers and open questions. Reply with the summary only."
+
+// summaryPrefix starts the pinned system message a summary is saved as.
+const summaryPrefix = "Summary of earlier conversation:\n\n"
+
+// isSummary reports whether m is a summary that is still in use.
+func isSummary(m types.Message) bool {
+	return m.Role == openai.ChatMessageRoleSystem && m.Pinned && !m.Summarized && strings.HasPrefix(m.Content, summaryPrefix)
+}
+
+// contextPlan records which messages go into the next request.
+type contextPlan struct {
+	Included []bool // parallel to ui.messages
+	Dropped  []int  // indexes that do not fit, oldest first
+	Tokens   int    // estimated prompt size
+	Limit    int
+}
+
+func (p contextPlan) hasImages(msgs []types.Message) bool {
+	for i, m := range msgs {
+		if p.Included[i] && len(imageAttachments(m)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (ui *TViewUI) contextLimit() int {
+	return tokens.Limit(ui.config.Model, ui.config.ContextLimits)
+}
+
+// planContext plans the next request of the current conversation; see planMessages.
+func (ui *TViewUI) planContext(draft *types.Message) contextPlan {
+	return planMessages(ui.messages, ui.systemPrompt, ui.contextLimit(), draft)
+}
+
+// planMessages decides which of msgs fit into a window of limit tokens, leaving
+// room for the reply and for draft, the message that is about to be sent (if any).
+// The system prompt and the newest message are always sent. Pinned messages
+// come next, newest first, each as far as it fits; then the other messages,
+// newest first until the budget runs out. Summarized messages are never sent.
+func planMessages(msgs []types.Message, systemPrompt string, limit int, draft *types.Message) contextPlan {
+	plan := contextPlan{Included: make([]bool, len(msgs)), Limit: limit}
+	budget := limit - min(limit/4, maxReplyReserve)
+
+	if systemPrompt != "" {
+		plan.Tokens += tokens.EstimateMessage(systemPrompt)
+	}
+	if draft != nil {
+		plan.Tokens += messageTokens(*draft)
+	}
+	if n := len(msgs); draft == nil && n > 0 && !msgs[n-1].Summarized {
+		plan.Included[n-1] = true
+		plan.Tokens += messageTokens(msgs[n-1])
+	}
+	for i := len(msgs) - 1; i >= 0; i-- {
+		m := msgs[i]
+		if !m.Pinned || m.Summarized || plan.Included[i] {
+			continue
+		}
+		if cost := messageTokens(m); plan.Tokens+cost <= budget {
+			plan.Included[i] = true
+			plan.Tokens += cost
+		}
+	}
+	full := false
+	for i := len(msgs) - 1; i >= 0; i-- {
+		m := msgs[i]
+		if m.Summarized || plan.Included[i] {
+			continue
+		}
+		cost := messageTokens(m)
+		if m.Pinned || full || plan.Tokens+cost > budget {
+			full = true
+			plan.Dropped = append([]int{i}, plan.Dropped...)
+			continue
+		}
+		plan.Included[i] = true
+		plan.Tokens += cost
+	}
+	return plan
+}
+
+// requestMessages builds the API request for plan from msgs: the system
+// prompt, then summaries and other system messages, then the conversation in order.
+func requestMessages(msgs []types.Message, systemPrompt string, vision bool, plan contextPlan) []openai.ChatCompletionMessage {
+	var system, rest []types.Message
+	for i, m := range msgs {
+		if !plan.Included[i] {
+			continue
+		}
+		if m.Role == openai.ChatMessageRoleSystem {
+			system = append(system, m)
+		} else {
+			rest = append(rest, m)
+		}
+	}
+	var sendMsgs []openai.ChatCompletionMessage
+	if systemPrompt != "" {
+		sendMsgs = append(sendMsgs, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: systemPrompt,
+		})
+	}
+	sendMsgs = append(sendMsgs, chatMessages(system, vision)...)
+	return append(sendMsgs, chatMessages(rest, vision)...)
+}
+
+// sendMessages starts streaming r, first folding turns that no longer fit
+// into a summary when that strategy is configured.
+func (ui *TViewUI) sendMessages(r *reply) {
+	plan := r.plan()
+	if len(plan.Dropped) > 0 && r.config.ContextStrategy == types.ContextSummarize {
+		dropped := toSummarize(r.messages, plan)
+		ui.replyNotice(r, fmt.Sprintf("Summarizing %d older messages to fit the context window...", len(dropped)))
+		go ui.summarizeAndSend(r, dropped)
+		return
+	}
+	if !r.vision() && plan.hasImages(r.messages) {
+		ui.replyNotice(r, fmt.Sprintf("Images are not sent: %s is not listed in vision_models in the config.", r.config.Model))
+	}
+	if len(plan.Dropped) > 0 {
+		ui.replyNotice(r, fmt.Sprintf("%d older messages exceed the context window and are not sent. Use /context for details.", len(plan.Dropped)))
+	}
+	go ui.streamOpenAIResponse(r, r.request(plan))
+}
+
+// toSummarize returns the messages a new summary replaces: those plan drops
+// and the summaries made before, which it folds in, oldest first.
+func toSummarize(msgs []types.Message, plan contextPlan) []types.Message {
+	var out []types.Message
+	for i, m := range msgs {
+		if isSummary(m) || slices.Contains(plan.Dropped, i) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func (ui *TViewUI) summarizeAndSend(r *reply, dropped []types.Message) {
+	var transcript strings.Builder
+	for _, m := range dropped {
+		fmt.Fprintf(&transcript, "%s: %s\n\n", strings.ToUpper(m.Role), m.Content)
+	}
+	// The excerpt itself must fit; keep its most recent part.
+	text := transcript.String()
+	if maxRunes := (r.limit() - maxReplyReserve) * 2; maxRunes > 0 {
+		if r := []rune(text); len(r) > maxRunes {
+			text = string(r[len(r)-maxRunes:])
+		}
+	}
+	summary, err := r.client.Chat(context.Background(), []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: summaryInstruction},
+		{Role: openai.ChatMessageRoleUser, Content: text},
+	})
+
+	ui.App.QueueUpdateDraw(func() {
+		if err != nil {
+			ui.replyNotice(r, fmt.Sprintf("Summary failed, dropping older messages instead: %v", err))
+			go ui.streamOpenAIResponse(r, r.request(r.plan()))
+			return
+		}
+		summary = summaryPrefix + strings.TrimSpace(summary)
+		covered := make([]int64, 0, len(dropped))
+		for _, m := range dropped {
+			if m.ID != 0 {
+				covered = append(covered, m.ID)
+			}
+		}
+		id, err := ui.storage.SaveSummary(r.convID, summary, covered)
+		if err != nil {
+			ui.replyNotice(r, fmt.Sprintf("Saving the summary failed, dropping older messages instead: %v", err))
+			go ui.streamOpenAIResponse(r, r.request(r.plan()))
+			return
+		}
+		msg := types.Message{
+			ID:      id,
+			Role:    openai.ChatMessageRoleSystem,
+			Content: summary,
+			Pinned:  true,
+		}
+		r.messages = append(markSummarized(r.messages, dropped), msg)
+		if ui.convID == r.convID {
+			ui.messages = append(markSummarized(ui.messages, dropped), msg)
+			ui.refreshChat()
+		}
+		go ui.streamOpenAIResponse(r, r.request(r.plan()))
+	})
+}
+
+// markSummarized flags the messages of msgs that are among dropped.
+func markSummarized(msgs, dropped []types.Message) []types.Message {
+	for i := range msgs {
+		for _, m := range dropped {
+			if msgs[i].ID == m.ID && msgs[i].Content == m.Content {
+				msgs[i].Summarized = true
+			}
+		}
+	}
+	return msgs
+}
+
+// updateInputTitle shows the token meter for the next request in the composer title.
+func (ui *TViewUI) updateInputTitle() {
+	var draft *types.Message
+	if text := ui.InputField.GetText(); text != "" || len(ui.pendingAttachments) > 0 {
+		draft = &types.Message{Content: text, Attachments: ui.pendingAttachments}
+	}
+	plan := ui.planContext(draft)
+	meter := fmt.Sprintf("~%s/%s tokens", shortCount(plan.Tokens), shortCount(plan.Limit))
+	if len(plan.Dropped) > 0 {
+		meter += fmt.Sprintf(", %d not sent", len(plan.Dropped))
+	}
+	if ui.replies[ui.convID] != nil {
+		meter += " · answering..."
+	}
+	if ui.editingMsg >= 0 {
+		ui.InputField.SetTitle(fmt.Sprintf(" Editing message #%d · %s (Enter to resend, Esc to cancel) ", ui.editingMsg+1, meter))
+		return
+	}
+	ui.InputField.SetTitle(fmt.Sprintf(" Input · %s (Enter to send, Shift+Enter for new line) ", meter))
+}
+
+func shortCount(n int) string {
+	if n >= 1000 {
+		return fmt.Sprintf("%.1fk", float64(n)/1000)
+	}
+	return fmt.Sprint(n)
+}
+
+// showContext lists exactly which messages the next request will contain.
+func (ui *TViewUI) showContext() {
+	plan := ui.planContext(nil)
+	strategy := ui.config.ContextStrategy
+	if strategy == "" {
+		strategy = types.ContextDrop
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Model %s, window %d tokens, strategy %s.\n", ui.config.Model, plan.Limit, strategy)
+	fmt.Fprintf(&sb, "Next request: ~%d tokens.\n", plan.Tokens)
+	if ui.systemPrompt != "" {
+		fmt.Fprintf(&sb, "  sent       system prompt (~%d)\n", tokens.EstimateMessage(ui.systemPrompt))
+	}
+	for i, m := range ui.messages {
+		state := "sent      "
+		switch {
+		case m.Summarized:
+			state = "summarized"
+		case !plan.Included[i]:
+			state = "dropped   "
+		}
+		preview := strings.Join(strings.Fields(m.Content), " ")
+		if r := []rune(preview); len(r) > 50 {
+			preview = string(r[:47]) + "..."
+		}
+		fmt.Fprintf(&sb, "  %s #%d %s (~%d) %s\n", state, i+1, strings.ToUpper(m.Role), messageTokens(m), tview.Escape(preview))
+	}
+	ui.appendSystemMsg(strings.TrimRight(sb.String(), "\n"))
+}
@@ -0,0 +1,86 @@
+package ui
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// msg returns a message of about n tokens: four ASCII bytes each, less the
+// per-message overhead.
+func msg(role string, n int) types.Message {
+	return types.Message{Role: role, Content: strings.Repeat("word", n-4)}
+}
+
+func pinned(m types.Message) types.Message {
+	m.Pinned = true
+	return m
+}
+
+func TestPlanMessages(t *testing.T) {
+	summarized := msg("user", 10)
+	summarized.Summarized = true
+	draft := msg("user", 10)
+
+	// A window of 100 leaves a budget of 75 after the reply's quarter.
+	tests := []struct {
+		name     string
+		msgs     []types.Message
+		system   string
+		limit    int
+		draft    *types.Message
+		included []int
+		dropped  []int
+		tokens   int
+	}{
+		{"all fit", []types.Message{msg("user", 10), msg("assistant", 20), msg("user", 10)}, "", 100, nil,
+			[]int{0, 1, 2}, nil, 40},
+		{"drop oldest", []types.Message{msg("user", 30), msg("assistant", 30), msg("user", 30), msg("assistant", 30)}, "", 100, nil,
+			[]int{2, 3}, []int{0, 1}, 60},
+		{"stop at the first that does not fit", []types.Message{msg("user", 5), msg("assistant", 50), msg("user", 30)}, "", 100, nil,
+			[]int{2}, []int{0, 1}, 30},
+		{"pinned first", []types.Message{pinned(msg("user", 30)), msg("assistant", 30), msg("user", 30)}, "", 100, nil,
+			[]int{0, 2}, []int{1}, 60},
+		{"pinned over the budget", []types.Message{pinned(msg("user", 50)), pinned(msg("user", 30)), msg("assistant", 10), msg("user", 30)}, "", 100, nil,
+			[]int{1, 2, 3}, []int{0}, 70},
+		{"summarized never sent", []types.Message{summarized, msg("user", 10)}, "", 100, nil,
+			[]int{1}, nil, 10},
+		{"draft counts", []types.Message{msg("user", 30), msg("assistant", 60)}, "", 100, &draft,
+			[]int{1}, []int{0}, 70},
+		{"newest not forced with a draft", []types.Message{msg("user", 10), msg("assistant", 70)}, "", 100, &draft,
+			nil, []int{0, 1}, 10},
+		{"system prompt counts", []types.Message{msg("user", 30), msg("assistant", 30)}, strings.Repeat("word", 26), 100, nil,
+			[]int{1}, []int{0}, 60},
+		{"limit below the system prompt", []types.Message{msg("user", 10), msg("assistant", 10), msg("user", 10)}, strings.Repeat("word", 100), 50, nil,
+			[]int{2}, []int{0, 1}, 114},
+	}
+	for _, tt := range tests {
+		plan := planMessages(tt.msgs, tt.system, tt.limit, tt.draft)
+		var included []int
+		for i, ok := range plan.Included {
+			if ok {
+				included = append(included, i)
+			}
+		}
+		if !slices.Equal(included, tt.included) || !slices.Equal(plan.Dropped, tt.dropped) || plan.Tokens != tt.tokens {
+			t.Errorf("%s: included %v, dropped %v, %d tokens; want %v, %v, %d",
+				tt.name, included, plan.Dropped, plan.Tokens, tt.included, tt.dropped, tt.tokens)
+		}
+	}
+}
+
+// TestToSummarize checks that a new summary folds in the earlier one, so
+// summaries do not pile up.
+func TestToSummarize(t *testing.T) {
+	old := pinned(types.Message{ID: 1, Role: "system", Content: summaryPrefix + "Earlier."})
+	done := old
+	done.Summarized = true
+	msgs := []types.Message{done, old, msg("user", 30), msg("assistant", 30), msg("user", 30)}
+	plan := planMessages(msgs, "", 100, nil)
+	got := toSummarize(msgs, plan)
+	if len(got) != 2 || got[0].Content != old.Content || got[1].Role != "user" {
+		t.Errorf("summarizing %v: %+v", plan.Dropped, got)
+	}
+}
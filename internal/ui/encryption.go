@@ -0,0 +1,163 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rivo/tview"
+	"github.com/evallife/chat-tui/internal/config"
+	"github.com/evallife/chat-tui/internal/storage"
+)
+
+// showPassphraseDialog asks for a passphrase on page name, twice when confirm
+// is set. The dialog stays open with the error in its title while onSubmit
+// fails; onCancel runs when it is dismissed.
+func (ui *TViewUI) showPassphraseDialog(name, title string, confirm bool, onSubmit func(string) error, onCancel func()) {
+	form := tview.NewForm()
+	form.SetBorder(true).SetTitle(title).SetTitleAlign(tview.AlignLeft)
+	form.AddPasswordField("Passphrase:", "", 40, '*', nil)
+	if confirm {
+		form.AddPasswordField("Repeat:", "", 40, '*', nil)
+	}
+	back := ui.App.GetFocus()
+	dismiss := func() {
+		ui.Pages.RemovePage(name)
+		ui.App.SetFocus(back)
+	}
+	fail := func(err error) {
+		form.SetTitle(fmt.Sprintf(" %v ", err))
+		for i := 0; i < form.GetFormItemCount(); i++ {
+			form.GetFormItem(i).(*tview.InputField).SetText("")
+		}
+		form.SetFocus(0)
+		ui.App.SetFocus(form)
+	}
+	submit := func() {
+		passphrase := form.GetFormItem(0).(*tview.InputField).GetText()
+		if confirm && form.GetFormItem(1).(*tview.InputField).GetText() != passphrase {
+			fail(errors.New("the passphrases do not match"))
+			return
+		}
+		if err := onSubmit(passphrase); err != nil {
+			fail(err)
+			return
+		}
+		dismiss()
+	}
+	cancel := func() {
+		dismiss()
+		if onCancel != nil {
+			onCancel()
+		}
+	}
+	form.AddButton("OK", submit)
+	form.AddButton("Cancel", cancel)
+	form.SetCancelFunc(cancel)
+
+	height := 7
+	if confirm {
+		height = 9
+	}
+	modal := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
+			AddItem(nil, 0, 1, false).
+			AddItem(form, 60, 1, true).
+			AddItem(nil, 0, 1, false), height, 1, true).
+		AddItem(nil, 0, 1, false)
+	ui.Pages.AddPage(name, modal, true, true)
+	ui.App.SetFocus(form)
+}
+
+// showUnlock asks for the passphrase of an encrypted database before anything
+// else can be used; cancelling quits. then, if set, runs once it is unlocked.
+func (ui *TViewUI) showUnlock(then func()) {
+	if enc, ok := ui.storage.(storage.EncryptedStore); ok {
+		unlock := func(passphrase string) error {
+			if err := enc.Unlock(passphrase); err != nil {
+				return err
+			}
+			if then != nil {
+				then()
+			}
+			return nil
+		}
+		ui.showPassphraseDialog("unlock", " Conversations are encrypted ", false, unlock, ui.quit)
+	}
+}
+
+// encryptedStore returns the store for /encrypt and /decrypt, telling the user
+// when the storage cannot be encrypted.
+func (ui *TViewUI) encryptedStore() (storage.EncryptedStore, bool) {
+	enc, ok := ui.storage.(storage.EncryptedStore)
+	if !ok {
+		ui.appendSystemMsg("Encryption needs the SQLite storage.")
+	}
+	return enc, ok
+}
+
+// encryptDatabase implements /encrypt. The passphrase comes from key_command
+// when one is configured, so that it unlocks the database on the next start.
+func (ui *TViewUI) encryptDatabase() {
+	enc, ok := ui.encryptedStore()
+	if !ok {
+		return
+	}
+	if enc.Encrypted() {
+		ui.appendSystemMsg("Conversations are already encrypted. Use /decrypt to store them unencrypted.")
+		return
+	}
+	encrypt := func(passphrase string) error {
+		if passphrase == "" {
+			return errors.New("the passphrase is empty")
+		}
+		err := enc.EnableEncryption(passphrase)
+		if err != nil && !errors.Is(err, storage.ErrWALInUse) {
+			return err
+		}
+		ui.appendSystemMsg(fmt.Sprintf("Messages, attachments and indexes are now encrypted. Titles, tags, system prompts and the prompt library stay unencrypted. Backups made before now are not encrypted; delete them from %s if they hold secrets.", ui.backupDir()))
+		if err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Warning: %v.", err))
+		}
+		return nil
+	}
+	if ui.config.KeyCommand != "" {
+		passphrase, err := config.RunKeyCommand(ui.config.KeyCommand)
+		if err == nil {
+			err = encrypt(passphrase)
+		}
+		if err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Encryption failed: %v", err))
+		}
+		return
+	}
+	ui.showPassphraseDialog("encrypt", " Encrypt messages (titles, tags and prompts stay readable) ", true, encrypt, nil)
+}
+
+// decryptDatabase implements /decrypt after asking for confirmation.
+func (ui *TViewUI) decryptDatabase() {
+	enc, ok := ui.encryptedStore()
+	if !ok {
+		return
+	}
+	if !enc.Encrypted() {
+		ui.appendSystemMsg("Conversations are not encrypted. Use /encrypt to encrypt them.")
+		return
+	}
+	modal := tview.NewModal().
+		SetText("Store messages, attachments and indexes unencrypted again?").
+		AddButtons([]string{"Decrypt", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			ui.Pages.RemovePage("confirm-decrypt")
+			ui.App.SetFocus(ui.InputField)
+			if buttonLabel != "Decrypt" {
+				return
+			}
+			if err := enc.DisableEncryption(); err != nil {
+				ui.appendSystemMsg(fmt.Sprintf("Decryption failed: %v", err))
+				return
+			}
+			ui.appendSystemMsg("Conversations are stored unencrypted again.")
+		})
+	ui.Pages.AddPage("confirm-decrypt", modal, true, true)
+}
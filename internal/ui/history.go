@@ -0,0 +1,228 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rivo/tview"
+	"github.com/evallife/chat-tui/internal/storage"
+)
+
+// parseTags splits s on commas and spaces, dropping "#" prefixes and duplicates.
+func parseTags(s string) []string {
+	var tags []string
+	for _, t := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		t = strings.TrimPrefix(t, "#")
+		if t != "" && !slices.Contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// matchConversation reports whether c passes the history filter: "#tag" needs
+// that tag, "folder:name" that folder, and other words must occur in the title.
+func matchConversation(c storage.ConvSummary, filter string) bool {
+	for _, term := range strings.Fields(strings.ToLower(filter)) {
+		switch {
+		case strings.HasPrefix(term, "#"):
+			if !slices.ContainsFunc(c.Tags, func(t string) bool { return strings.EqualFold(t, term[1:]) }) {
+				return false
+			}
+		case strings.HasPrefix(term, "folder:"):
+			if !strings.EqualFold(c.Folder, strings.TrimPrefix(term, "folder:")) {
+				return false
+			}
+		default:
+			if !strings.Contains(strings.ToLower(c.Title), term) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func historyItemText(c storage.ConvSummary) string {
+	text := tview.Escape(c.Title)
+	if c.Pinned {
+		text = "[yellow]★[-] " + text
+	}
+	if c.Folder != "" {
+		text += " [gray]" + tview.Escape(c.Folder) + "/[-]"
+	}
+	for _, t := range c.Tags {
+		text += " [aqua]#" + tview.Escape(t) + "[-]"
+	}
+	return text
+}
+
+// reloadHistory fills the history list from storage, applying the filter.
+func (ui *TViewUI) reloadHistory() {
+	ui.HistoryList.Clear()
+	ui.HistoryPreview.Clear()
+	ui.lastClickedIdx = -1 // Reset click state
+	convs, err := ui.storage.ListConversations()
+	ui.reportListErr(err)
+	filter := ui.HistoryFilter.GetText()
+	ui.historyConvs = ui.historyConvs[:0]
+	for _, c := range convs {
+		if matchConversation(c, filter) {
+			ui.historyConvs = append(ui.historyConvs, c)
+		}
+	}
+	switch {
+	case len(convs) == 0:
+		ui.HistoryList.AddItem("No history yet", "", 0, nil)
+	case len(ui.historyConvs) == 0:
+		ui.HistoryList.AddItem("No conversations match the filter", "", 0, nil)
+	}
+	for _, c := range ui.historyConvs {
+		ui.HistoryList.AddItem(ui.historyEntry(c), c.ID, 0, nil)
+	}
+}
+
+// reportListErr tells the user once per distinct failure that some
+// conversations could not be listed; the others are listed all the same.
+func (ui *TViewUI) reportListErr(err error) {
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	if msg != "" && msg != ui.listErr {
+		ui.appendSystemMsg(fmt.Sprintf("Some conversations could not be listed: %v", err))
+	}
+	ui.listErr = msg
+}
+
+// historyEntry is historyItemText with a check mark for conversations marked
+// for a bulk delete and the badge of conversations with answers underway or unread.
+func (ui *TViewUI) historyEntry(c storage.ConvSummary) string {
+	text := ui.badge(c.ID) + historyItemText(c)
+	if ui.historyMarked[c.ID] {
+		return "[green]✓[-] " + text
+	}
+	return text
+}
+
+func (ui *TViewUI) selectedHistoryConv() (storage.ConvSummary, bool) {
+	idx := ui.HistoryList.GetCurrentItem()
+	if idx < 0 || idx >= len(ui.historyConvs) {
+		return storage.ConvSummary{}, false
+	}
+	return ui.historyConvs[idx], true
+}
+
+// showTextDialog asks for a single line of text on page name.
+func (ui *TViewUI) showTextDialog(name, title, label, value string, onSave func(string)) {
+	form := tview.NewForm()
+	form.SetBorder(true).SetTitle(title).SetTitleAlign(tview.AlignLeft)
+	form.AddInputField(label, value, 50, nil, nil)
+	back := ui.App.GetFocus()
+	dismiss := func() {
+		ui.Pages.RemovePage(name)
+		ui.App.SetFocus(back)
+	}
+	form.AddButton("Save", func() {
+		text := strings.TrimSpace(form.GetFormItem(0).(*tview.InputField).GetText())
+		dismiss()
+		onSave(text)
+	})
+	form.AddButton("Cancel", dismiss)
+	form.SetCancelFunc(dismiss)
+
+	modal := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
+			AddItem(nil, 0, 1, false).
+			AddItem(form, 64, 1, true).
+			AddItem(nil, 0, 1, false), 7, 1, true).
+		AddItem(nil, 0, 1, false)
+	ui.Pages.AddPage(name, modal, true, true)
+}
+
+func (ui *TViewUI) editTagsSelected() {
+	c, ok := ui.selectedHistoryConv()
+	if !ok {
+		return
+	}
+	ui.showTextDialog("tags-dialog", " Tags ", "Tags:", strings.Join(c.Tags, " "), func(text string) {
+		if err := ui.storage.SetConversationTags(c.ID, parseTags(text)); err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Saving tags failed: %v", err))
+			return
+		}
+		ui.refreshHistoryIfVisible()
+	})
+}
+
+func (ui *TViewUI) editFolderSelected() {
+	c, ok := ui.selectedHistoryConv()
+	if !ok {
+		return
+	}
+	ui.showTextDialog("folder-dialog", " Folder ", "Folder:", c.Folder, func(text string) {
+		if err := ui.storage.SetConversationFolder(c.ID, text); err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Saving folder failed: %v", err))
+			return
+		}
+		ui.refreshHistoryIfVisible()
+	})
+}
+
+func (ui *TViewUI) togglePinConversation() {
+	c, ok := ui.selectedHistoryConv()
+	if !ok {
+		return
+	}
+	if err := ui.storage.SetConversationPinned(c.ID, !c.Pinned); err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Pin failed: %v", err))
+		return
+	}
+	ui.showHistory()
+	// Keep the same conversation selected after it moves.
+	for i, h := range ui.historyConvs {
+		if h.ID == c.ID {
+			ui.HistoryList.SetCurrentItem(i)
+		}
+	}
+}
+
+// handleTagCommand implements /tag: list the tags of the current conversation,
+// add tags, or remove them when prefixed with "-".
+func (ui *TViewUI) handleTagCommand(args []string) {
+	if ui.convID == "" {
+		ui.appendSystemMsg("Send a message first; tags belong to a saved conversation.")
+		return
+	}
+	conv, err := ui.storage.GetConversation(ui.convID)
+	if err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Tag failed: %v", err))
+		return
+	}
+	tags := conv.Tags
+	for _, arg := range args {
+		if name, ok := strings.CutPrefix(arg, "-"); ok {
+			for _, t := range parseTags(name) {
+				tags = slices.DeleteFunc(tags, func(x string) bool { return x == t })
+			}
+			continue
+		}
+		for _, t := range parseTags(arg) {
+			if !slices.Contains(tags, t) {
+				tags = append(tags, t)
+			}
+		}
+	}
+	if len(args) > 0 {
+		if err := ui.storage.SetConversationTags(ui.convID, tags); err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Tag failed: %v", err))
+			return
+		}
+	}
+	if len(tags) == 0 {
+		ui.appendSystemMsg("This conversation has no tags. Use /tag <name>... to add, /tag -<name> to remove.")
+		return
+	}
+	slices.Sort(tags)
+	ui.appendSystemMsg("Tags: #" + tview.Escape(strings.Join(tags, " #")))
+}
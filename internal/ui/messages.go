@@ -0,0 +1,288 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/sashabaranov/go-openai"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+func msgRegion(i int) string {
+	return fmt.Sprintf("msg-%d", i)
+}
+
+// chatMessages converts stored messages into the API request form. Images are
+// only included for vision models, as multi-part content.
+func chatMessages(msgs []types.Message, vision bool) []openai.ChatCompletionMessage {
+	out := make([]openai.ChatCompletionMessage, 0, len(msgs))
+	for _, m := range msgs {
+		images := imageAttachments(m)
+		if !vision || len(images) == 0 {
+			out = append(out, openai.ChatCompletionMessage{Role: m.Role, Content: messageText(m)})
+			continue
+		}
+		var parts []openai.ChatMessagePart
+		if text := messageText(m); text != "" {
+			parts = append(parts, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: text})
+		}
+		for _, a := range images {
+			parts = append(parts, openai.ChatMessagePart{
+				Type:     openai.ChatMessagePartTypeImageURL,
+				ImageURL: &openai.ChatMessageImageURL{URL: dataURL(a), Detail: openai.ImageURLDetailAuto},
+			})
+		}
+		out = append(out, openai.ChatCompletionMessage{Role: m.Role, MultiContent: parts})
+	}
+	return out
+}
+
+// setupMessageSelection wires the message-focus mode into ChatView: Alt+Up/Down
+// (handled globally) or a click on a message selects it, and the keys below act on it.
+func (ui *TViewUI) setupMessageSelection() {
+	ui.ChatView.SetHighlightedFunc(func(added, removed, remaining []string) {
+		if len(added) == 0 {
+			if len(remaining) == 0 {
+				ui.selectedMsg = -1
+			}
+			return
+		}
+		idx, err := strconv.Atoi(strings.TrimPrefix(added[0], "msg-"))
+		if err != nil || idx >= len(ui.messages) {
+			return
+		}
+		ui.selectedMsg = idx
+		ui.App.SetFocus(ui.ChatView)
+	})
+
+	ui.ChatView.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if ui.selectedMsg < 0 {
+			return event
+		}
+		switch event.Key() {
+		case tcell.KeyEsc:
+			ui.clearSelection()
+			return nil
+		case tcell.KeyUp:
+			ui.moveSelection(-1)
+			return nil
+		case tcell.KeyDown:
+			ui.moveSelection(1)
+			return nil
+		case tcell.KeyEnter:
+			ui.showMessageActions()
+			return nil
+		}
+		switch event.Rune() {
+		case 'c':
+			ui.copySelected()
+		case 'q':
+			ui.quoteSelected()
+		case 'e':
+			ui.editSelected()
+		case 'd':
+			ui.deleteSelected()
+		case 'p':
+			ui.togglePinSelected()
+		case 'm':
+			ui.toggleMarkSelected()
+		default:
+			return event
+		}
+		return nil
+	})
+}
+
+// moveSelection moves the highlighted message by delta, starting from the
+// newest message when nothing is selected yet.
+func (ui *TViewUI) moveSelection(delta int) {
+	if len(ui.messages) == 0 {
+		return
+	}
+	idx := ui.selectedMsg
+	if idx < 0 {
+		idx = len(ui.messages) - 1
+	} else {
+		idx += delta
+	}
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(ui.messages) {
+		idx = len(ui.messages) - 1
+	}
+	ui.selectedMsg = idx
+	ui.ChatView.Highlight(msgRegion(idx)).ScrollToHighlight()
+	ui.ChatView.SetTitle(" Chat History (c copy, q quote, e edit, d delete, p pin, m mark for export, Enter menu, Esc done) ")
+	ui.App.SetFocus(ui.ChatView)
+}
+
+func (ui *TViewUI) clearSelection() {
+	ui.selectedMsg = -1
+	ui.ChatView.Highlight()
+	ui.ChatView.SetTitle(" Chat History ")
+	ui.App.SetFocus(ui.InputField)
+}
+
+func (ui *TViewUI) showMessageActions() {
+	if ui.selectedMsg < 0 || ui.selectedMsg >= len(ui.messages) {
+		return
+	}
+	pinLabel := "Pin"
+	if ui.messages[ui.selectedMsg].Pinned {
+		pinLabel = "Unpin"
+	}
+	modal := tview.NewModal().
+		SetText(fmt.Sprintf("%s message #%d", strings.ToUpper(ui.messages[ui.selectedMsg].Role), ui.selectedMsg+1)).
+		AddButtons([]string{"Copy", "Quote", "Edit", "Delete", pinLabel, "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			ui.Pages.RemovePage("message-actions")
+			switch buttonLabel {
+			case "Copy":
+				ui.copySelected()
+			case "Quote":
+				ui.quoteSelected()
+			case "Edit":
+				ui.editSelected()
+			case "Delete":
+				ui.deleteSelected()
+			case "Pin", "Unpin":
+				ui.togglePinSelected()
+			default:
+				ui.App.SetFocus(ui.ChatView)
+			}
+		})
+	ui.Pages.AddPage("message-actions", modal, true, true)
+}
+
+func (ui *TViewUI) copySelected() {
+	if ui.selectedMsg < 0 {
+		return
+	}
+	if err := ui.copyText(ui.messages[ui.selectedMsg].Content); err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Copy failed: %v", err))
+		return
+	}
+	ui.appendSystemMsg(fmt.Sprintf("Message #%d copied to clipboard.", ui.selectedMsg+1))
+}
+
+// quoteSelected inserts the selected message into the composer as a markdown quote.
+func (ui *TViewUI) quoteSelected() {
+	if ui.selectedMsg < 0 {
+		return
+	}
+	lines := strings.Split(strings.TrimSpace(ui.messages[ui.selectedMsg].Content), "\n")
+	for i, l := range lines {
+		lines[i] = "> " + l
+	}
+	ui.clearSelection()
+	ui.insertIntoComposer(strings.Join(lines, "\n") + "\n\n")
+}
+
+// editSelected loads a user message into the composer. Sending it replaces
+// that message and everything after it.
+func (ui *TViewUI) editSelected() {
+	if ui.selectedMsg < 0 {
+		return
+	}
+	m := ui.messages[ui.selectedMsg]
+	if m.Role != openai.ChatMessageRoleUser {
+		ui.appendSystemMsg("Only user messages can be edited and resent.")
+		return
+	}
+	idx := ui.selectedMsg
+	ui.isInsertingNewline = strings.Contains(m.Content, "\n")
+	ui.InputField.SetText(m.Content)
+	ui.pendingAttachments = nil
+	for _, a := range m.Attachments {
+		a.ID, a.MessageID = 0, 0
+		ui.pendingAttachments = append(ui.pendingAttachments, a)
+	}
+	ui.updateAttachmentBar()
+	ui.clearSelection()
+	ui.setEditing(idx)
+}
+
+func (ui *TViewUI) setEditing(idx int) {
+	ui.editingMsg = idx
+	ui.updateInputTitle()
+}
+
+// deleteSelected asks before deleting the selected message.
+func (ui *TViewUI) deleteSelected() {
+	idx := ui.selectedMsg
+	if idx < 0 {
+		return
+	}
+	modal := tview.NewModal().
+		SetText(fmt.Sprintf("Delete %s message #%d?", ui.messages[idx].Role, idx+1)).
+		AddButtons([]string{"Delete", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			ui.Pages.RemovePage("confirm-delete-message")
+			ui.App.SetFocus(ui.ChatView)
+			if buttonLabel == "Delete" {
+				ui.deleteMessage(idx)
+			}
+		})
+	ui.Pages.AddPage("confirm-delete-message", modal, true, true)
+}
+
+func (ui *TViewUI) deleteMessage(idx int) {
+	if idx >= len(ui.messages) {
+		return
+	}
+	if id := ui.messages[idx].ID; id != 0 {
+		if err := ui.storage.DeleteMessage(ui.convID, id); err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Delete failed: %v", err))
+			return
+		}
+	}
+	ui.messages = append(ui.messages[:idx], ui.messages[idx+1:]...)
+	if ui.editingMsg >= idx {
+		ui.setEditing(-1)
+	}
+	if len(ui.messages) == 0 {
+		ui.clearSelection()
+	} else if idx >= len(ui.messages) {
+		ui.selectedMsg = len(ui.messages) - 1
+	}
+	ui.refreshChat()
+}
+
+func (ui *TViewUI) togglePinSelected() {
+	idx := ui.selectedMsg
+	if idx < 0 {
+		return
+	}
+	pinned := !ui.messages[idx].Pinned
+	if id := ui.messages[idx].ID; id != 0 {
+		if err := ui.storage.SetMessagePinned(ui.convID, id, pinned); err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Pin failed: %v", err))
+			return
+		}
+	}
+	ui.messages[idx].Pinned = pinned
+	ui.refreshChat()
+}
+
+// dropMessagesFrom removes messages[idx:] from the database and then from
+// memory. It reports false, leaving both as they were, when the delete fails.
+func (ui *TViewUI) dropMessagesFrom(idx int) bool {
+	if idx < 0 || idx >= len(ui.messages) {
+		return true
+	}
+	for _, m := range ui.messages[idx:] {
+		if m.ID != 0 {
+			if err := ui.storage.DeleteMessagesFrom(ui.convID, m.ID); err != nil {
+				ui.appendSystemMsg(fmt.Sprintf("Removing the edited messages failed: %v", err))
+				return false
+			}
+			break
+		}
+	}
+	ui.messages = ui.messages[:idx]
+	return true
+}
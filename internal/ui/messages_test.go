@@ -0,0 +1,135 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/base64"
+	"slices"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/sashabaranov/go-openai"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// openChat opens a conversation holding a question, its answer and a
+// follow-up question.
+func openChat(t *testing.T, ui *TViewUI) string {
+	t.Helper()
+	id, err := ui.storage.CreateConversation("Chat", "gpt-4o", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []types.Message{
+		{Role: openai.ChatMessageRoleUser, Content: "First question"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "First answer"},
+		{Role: openai.ChatMessageRoleUser, Content: "Second question"},
+	} {
+		if _, err := ui.storage.AddMessage(id, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	do(ui, func() { ui.openConversation(id) })
+	return id
+}
+
+func contents(msgs []types.Message) []string {
+	var out []string
+	for _, m := range msgs {
+		out = append(out, m.Content)
+	}
+	return out
+}
+
+func TestCopyMessage(t *testing.T) {
+	t.Setenv("TMUX", "")
+	t.Setenv("TERM", "xterm")
+	ui, _ := startUI(t, "http://127.0.0.1:0")
+	openChat(t, ui)
+	var clip bytes.Buffer
+	do(ui, func() {
+		ui.clipboard = &clip
+		ui.moveSelection(-1)
+		ui.moveSelection(-1)
+		ui.copySelected()
+	})
+	want := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte("First answer")) + "\x07"
+	if clip.String() != want {
+		t.Errorf("clipboard got %q, want %q", clip.String(), want)
+	}
+}
+
+// TestDeleteMessage deletes a message only once the user confirms.
+func TestDeleteMessage(t *testing.T) {
+	ui, _ := startUI(t, "http://127.0.0.1:0")
+	id := openChat(t, ui)
+	asked := func() bool { return ui.Pages.HasPage("confirm-delete-message") }
+	deleteAnswer := func() {
+		do(ui, func() {
+			ui.clearSelection()
+			ui.moveSelection(-1)
+			ui.moveSelection(-1)
+			ui.deleteSelected()
+		})
+		waitFor(t, ui, "the confirmation", asked)
+	}
+
+	deleteAnswer()
+	press(ui, tcell.KeyRight, tcell.KeyEnter) // Cancel
+	waitFor(t, ui, "the confirmation to close", func() bool { return !asked() })
+	if got := contents(ui.messages); len(got) != 3 {
+		t.Fatalf("Cancel left %q", got)
+	}
+
+	deleteAnswer()
+	press(ui, tcell.KeyEnter) // Delete
+	waitFor(t, ui, "the confirmation to close", func() bool { return !asked() })
+	want := []string{"First question", "Second question"}
+	if got := contents(ui.messages); !slices.Equal(got, want) {
+		t.Errorf("shown %q, want %q", got, want)
+	}
+	stored, err := ui.storage.ListMessages(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(stored); !slices.Equal(got, want) {
+		t.Errorf("stored %q, want %q", got, want)
+	}
+}
+
+// TestEditMessage edits the first question: sending it replaces that
+// question and everything after it.
+func TestEditMessage(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	ui, _ := startUI(t, fakeAPI(t, release).URL)
+	id := openChat(t, ui)
+	do(ui, func() {
+		ui.selectedMsg = 1
+		ui.editSelected()
+		if ui.editingMsg != -1 {
+			t.Error("editing an answer")
+		}
+		ui.selectedMsg = 0
+		ui.editSelected()
+		if got := ui.InputField.GetText(); got != "First question" {
+			t.Errorf("composer holds %q", got)
+		}
+		ui.InputField.SetText("")
+		ui.handleInput("Better question")
+	})
+	waitFor(t, ui, "the answer to be saved", func() bool { return len(ui.replies) == 0 })
+
+	want := []string{"Better question", "Hello from gpt-4o"}
+	stored, err := ui.storage.ListMessages(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(stored); !slices.Equal(got, want) {
+		t.Errorf("stored %q, want %q", got, want)
+	}
+	do(ui, func() {
+		if ui.editingMsg != -1 {
+			t.Errorf("still editing message %d", ui.editingMsg)
+		}
+	})
+}
@@ -54,7 +54,7 @@ type Model struct {
 	focusIndex    int               // Which input is focused in settings
 	messages      []openai.ChatCompletionMessage
 	apiClient     *api.Client
-	storage       *storage.Manager
+	storage       storage.Store
 	convID        string
 	renderer      *glamour.TermRenderer
 	err           error
@@ -66,7 +66,7 @@ type Model struct {
 	zoneManager   *zone.Manager
 }
 
-func NewModel(cfg types.Config, store *storage.Manager) Model {
+func NewModel(cfg types.Config, store storage.Store) Model {
 	ta := textarea.New()
 	ta.Placeholder = "Type a message, /read <file>, or use Ctrl+N for new..."
 	ta.Focus()
@@ -0,0 +1,370 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/evallife/chat-tui/internal/promptfile"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+const defaultPromptDir = "./prompts"
+
+// showSystemPrompts opens the prompt manager page.
+func (ui *TViewUI) showSystemPrompts() {
+	ui.PromptList = tview.NewList()
+	ui.PromptList.ShowSecondaryText(false)
+	ui.PromptList.SetBorder(true).SetTitle(" System Prompts (Enter to use) ")
+	ui.PromptList.SetChangedFunc(func(index int, mainText, secondaryText string, shortcut rune) {
+		ui.showPromptPreview(index)
+	})
+	ui.PromptList.SetSelectedFunc(func(index int, mainText, secondaryText string, shortcut rune) {
+		if p, ok := ui.selectedPrompt(); ok {
+			ui.usePrompt(p)
+		}
+	})
+	ui.PromptList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEsc {
+			ui.Pages.SwitchToPage("chat")
+			return nil
+		}
+		if event.Key() == tcell.KeyDelete {
+			ui.confirmDeletePrompt()
+			return nil
+		}
+		switch event.Rune() {
+		case 'n':
+			ui.editPrompt(types.SystemPrompt{}, true)
+		case 'e':
+			ui.editSelectedPrompt()
+		case 'c':
+			ui.duplicatePrompt()
+		case 'd':
+			ui.confirmDeletePrompt()
+		case 's':
+			ui.toggleDefaultPrompt()
+		case 'i':
+			ui.importPrompts()
+		case 'x':
+			ui.exportPrompts()
+		default:
+			return event
+		}
+		return nil
+	})
+
+	ui.PromptPreview = tview.NewTextView().
+		SetDynamicColors(true).
+		SetWordWrap(true)
+	ui.PromptPreview.SetBorder(true).SetTitle(" Content ")
+
+	bar := tview.NewFlex().SetDirection(tview.FlexColumn)
+	bar.SetBorder(true).SetTitle(" Prompt Actions ")
+	bar.AddItem(ui.makeButton("Use", func() {
+		if p, ok := ui.selectedPrompt(); ok {
+			ui.usePrompt(p)
+		}
+	}), 0, 1, false)
+	bar.AddItem(ui.makeButton("New", func() { ui.editPrompt(types.SystemPrompt{}, true) }), 0, 1, false)
+	bar.AddItem(ui.makeButton("Edit", ui.editSelectedPrompt), 0, 1, false)
+	bar.AddItem(ui.makeButton("Duplicate", ui.duplicatePrompt), 0, 1, false)
+	bar.AddItem(ui.makeButton("Delete", ui.confirmDeletePrompt), 0, 1, false)
+	bar.AddItem(ui.makeButton("Default", ui.toggleDefaultPrompt), 0, 1, false)
+	bar.AddItem(ui.makeButton("Import", ui.importPrompts), 0, 1, false)
+	bar.AddItem(ui.makeButton("Export", ui.exportPrompts), 0, 1, false)
+	bar.AddItem(ui.makeButton("Back", func() { ui.Pages.SwitchToPage("chat") }), 0, 1, false)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
+			AddItem(ui.PromptList, 35, 1, true).
+			AddItem(ui.PromptPreview, 0, 2, false), 0, 1, true).
+		AddItem(tview.NewTextView().SetText(" n new  e edit  c duplicate  d delete  s default  i import  x export  Esc back"), 1, 1, false).
+		AddItem(bar, 3, 1, false)
+
+	ui.reloadPrompts(0)
+	ui.Pages.AddPage("system_prompts", layout, true, true)
+	ui.Pages.SwitchToPage("system_prompts")
+}
+
+func (ui *TViewUI) reloadPrompts(selected int) {
+	ui.prompts, _ = ui.storage.ListSystemPrompts()
+	ui.PromptList.Clear()
+	for _, p := range ui.prompts {
+		name := tview.Escape(p.Name)
+		if p.Kind == types.PromptKindTemplate {
+			name += " [aqua](template)[-]"
+		}
+		if p.IsDefault {
+			name += " [yellow]★[-]"
+		}
+		ui.PromptList.AddItem(name, p.ID, 0, nil)
+	}
+	if selected >= len(ui.prompts) {
+		selected = len(ui.prompts) - 1
+	}
+	if selected >= 0 {
+		ui.PromptList.SetCurrentItem(selected)
+		ui.showPromptPreview(selected)
+	}
+}
+
+func (ui *TViewUI) selectedPrompt() (types.SystemPrompt, bool) {
+	idx := ui.PromptList.GetCurrentItem()
+	if idx < 0 || idx >= len(ui.prompts) {
+		return types.SystemPrompt{}, false
+	}
+	return ui.prompts[idx], true
+}
+
+func (ui *TViewUI) showPromptPreview(index int) {
+	ui.PromptPreview.Clear()
+	if index < 0 || index >= len(ui.prompts) {
+		return
+	}
+	p := ui.prompts[index]
+	if p.IsDefault {
+		fmt.Fprint(ui.PromptPreview, "[yellow]Default for new chats[-]\n\n")
+	}
+	if p.Kind == types.PromptKindTemplate {
+		fmt.Fprintf(ui.PromptPreview, "[aqua]Template, insert with /t %s[-]\n\n", tview.Escape(p.ID))
+	}
+	if p.Content == "" {
+		fmt.Fprint(ui.PromptPreview, "[gray](empty: plain chat without a system prompt)[-]")
+		return
+	}
+	fmt.Fprint(ui.PromptPreview, tview.Escape(p.Content))
+}
+
+// usePrompt switches to prompt p. Mid-conversation the user decides whether it
+// applies to the current chat (persisted with it) or starts a new one.
+func (ui *TViewUI) usePrompt(p types.SystemPrompt) {
+	if p.Kind == types.PromptKindTemplate {
+		ui.useTemplate(p)
+		return
+	}
+	if ui.convID == "" {
+		ui.systemPrompt = p.Content
+		ui.Pages.SwitchToPage("chat")
+		ui.refreshChat()
+		ui.appendSystemMsg(fmt.Sprintf("System prompt set to: %s", p.Name))
+		return
+	}
+	modal := tview.NewModal().
+		SetText(fmt.Sprintf("Use \"%s\" for the current chat?", p.Name)).
+		AddButtons([]string{"Apply to this chat", "Start new chat", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			ui.Pages.RemovePage("confirm-prompt")
+			switch buttonLabel {
+			case "Apply to this chat":
+				if err := ui.storage.SetConversationSystemPrompt(ui.convID, p.Content); err != nil {
+					ui.appendSystemMsg(fmt.Sprintf("Saving system prompt failed: %v", err))
+				}
+				ui.systemPrompt = p.Content
+				ui.Pages.SwitchToPage("chat")
+				ui.refreshChat()
+				ui.appendSystemMsg(fmt.Sprintf("System prompt set to: %s", p.Name))
+			case "Start new chat":
+				ui.openNewChat()
+				ui.systemPrompt = p.Content
+				ui.refreshChat()
+				ui.appendSystemMsg(fmt.Sprintf("New conversation started. (Prompt: %s)", p.Name))
+			}
+		})
+	ui.Pages.AddPage("confirm-prompt", modal, true, true)
+}
+
+func (ui *TViewUI) editSelectedPrompt() {
+	if p, ok := ui.selectedPrompt(); ok {
+		ui.editPrompt(p, false)
+	}
+}
+
+func (ui *TViewUI) duplicatePrompt() {
+	p, ok := ui.selectedPrompt()
+	if !ok {
+		return
+	}
+	p.ID = ""
+	p.Name += " (copy)"
+	p.IsDefault = false
+	ui.editPrompt(p, true)
+}
+
+// editPrompt opens the create/edit form. The content field is multi-line.
+func (ui *TViewUI) editPrompt(p types.SystemPrompt, isNew bool) {
+	title := " Edit Prompt "
+	if isNew {
+		title = " New Prompt "
+	}
+	form := tview.NewForm()
+	form.SetBorder(true).SetTitle(title).SetTitleAlign(tview.AlignLeft)
+	kinds := []string{types.PromptKindSystem, types.PromptKindTemplate}
+	kindIdx := 0
+	if p.Kind == types.PromptKindTemplate {
+		kindIdx = 1
+	}
+	form.AddInputField("Name", p.Name, 50, nil, nil)
+	form.AddDropDown("Kind", kinds, kindIdx, nil)
+	form.AddTextArea("Content", p.Content, 0, 12, 0, nil)
+	form.AddCheckbox("Default for new chats", p.IsDefault, nil)
+
+	dismiss := func() {
+		ui.Pages.RemovePage("prompt-editor")
+		ui.App.SetFocus(ui.PromptList)
+	}
+	form.AddButton("Save", func() {
+		p.Name = strings.TrimSpace(form.GetFormItemByLabel("Name").(*tview.InputField).GetText())
+		_, p.Kind = form.GetFormItemByLabel("Kind").(*tview.DropDown).GetCurrentOption()
+		p.Content = form.GetFormItemByLabel("Content").(*tview.TextArea).GetText()
+		p.IsDefault = form.GetFormItemByLabel("Default for new chats").(*tview.Checkbox).IsChecked()
+		if p.Name == "" {
+			p.Name = "Untitled"
+		}
+		saved, err := ui.storage.SaveSystemPrompt(p)
+		dismiss()
+		if err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Saving prompt failed: %v", err))
+			return
+		}
+		ui.reloadPrompts(ui.promptIndex(saved.ID))
+	})
+	form.AddButton("Cancel", dismiss)
+	form.SetCancelFunc(dismiss)
+
+	modal := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
+			AddItem(nil, 0, 1, false).
+			AddItem(form, 80, 1, true).
+			AddItem(nil, 0, 1, false), 24, 1, true).
+		AddItem(nil, 0, 1, false)
+	ui.Pages.AddPage("prompt-editor", modal, true, true)
+}
+
+func (ui *TViewUI) promptIndex(id string) int {
+	for i, p := range ui.prompts {
+		if p.ID == id {
+			return i
+		}
+	}
+	// Not loaded yet: new prompts are appended at the end.
+	return len(ui.prompts)
+}
+
+func (ui *TViewUI) confirmDeletePrompt() {
+	p, ok := ui.selectedPrompt()
+	if !ok {
+		return
+	}
+	idx := ui.PromptList.GetCurrentItem()
+	modal := tview.NewModal().
+		SetText(fmt.Sprintf("Delete prompt \"%s\"?", p.Name)).
+		AddButtons([]string{"Delete", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			ui.Pages.RemovePage("confirm-delete-prompt")
+			ui.App.SetFocus(ui.PromptList)
+			if buttonLabel != "Delete" {
+				return
+			}
+			if err := ui.storage.DeleteSystemPrompt(p.ID); err != nil {
+				ui.appendSystemMsg(fmt.Sprintf("Delete failed: %v", err))
+				return
+			}
+			ui.reloadPrompts(idx)
+		})
+	ui.Pages.AddPage("confirm-delete-prompt", modal, true, true)
+}
+
+func (ui *TViewUI) toggleDefaultPrompt() {
+	p, ok := ui.selectedPrompt()
+	if !ok || p.Kind == types.PromptKindTemplate {
+		return
+	}
+	id := p.ID
+	if p.IsDefault {
+		id = ""
+	}
+	if err := ui.storage.SetDefaultSystemPrompt(id); err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Setting default failed: %v", err))
+		return
+	}
+	ui.reloadPrompts(ui.PromptList.GetCurrentItem())
+}
+
+func (ui *TViewUI) importPrompts() {
+	ui.promptDirDialog(" Import Prompts ", "Import", func(dir string) {
+		prompts, err := promptfile.ImportDir(dir)
+		if err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Import failed: %v", err))
+			return
+		}
+		for _, p := range prompts {
+			if _, err := ui.storage.SaveSystemPrompt(p); err != nil {
+				ui.appendSystemMsg(fmt.Sprintf("Import failed: %v", err))
+				return
+			}
+		}
+		ui.reloadPrompts(ui.PromptList.GetCurrentItem())
+		ui.appendSystemMsg(fmt.Sprintf("Imported %d prompts from %s", len(prompts), dir))
+	})
+}
+
+func (ui *TViewUI) exportPrompts() {
+	ui.promptDirDialog(" Export Prompts ", "Export", func(dir string) {
+		prompts := ui.prompts
+		write := func() {
+			if err := promptfile.ExportDir(dir, prompts); err != nil {
+				ui.appendSystemMsg(fmt.Sprintf("Export failed: %v", err))
+				return
+			}
+			ui.appendSystemMsg(fmt.Sprintf("Exported %d prompts to %s", len(prompts), dir))
+		}
+
+		existing := promptfile.Existing(dir, prompts)
+		if len(existing) == 0 {
+			write()
+			return
+		}
+		modal := tview.NewModal().
+			SetText(fmt.Sprintf("%d prompt file(s) already exist in %s.", len(existing), dir)).
+			AddButtons([]string{"Overwrite", "Cancel"}).
+			SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+				ui.Pages.RemovePage("confirm-overwrite")
+				ui.App.SetFocus(ui.PromptList)
+				if buttonLabel == "Overwrite" {
+					write()
+				}
+			})
+		ui.Pages.AddPage("confirm-overwrite", modal, true, true)
+	})
+}
+
+func (ui *TViewUI) promptDirDialog(title, action string, run func(dir string)) {
+	form := tview.NewForm()
+	form.SetBorder(true).SetTitle(title).SetTitleAlign(tview.AlignLeft)
+	form.AddInputField("Directory:", defaultPromptDir, 50, nil, nil)
+	dismiss := func() {
+		ui.Pages.RemovePage("prompt-dir-dialog")
+		ui.App.SetFocus(ui.PromptList)
+	}
+	form.AddButton(action, func() {
+		dir := strings.TrimSpace(form.GetFormItem(0).(*tview.InputField).GetText())
+		dismiss()
+		if dir != "" {
+			run(dir)
+		}
+	})
+	form.AddButton("Cancel", dismiss)
+	form.SetCancelFunc(dismiss)
+
+	modal := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
+			AddItem(nil, 0, 1, false).
+			AddItem(form, 64, 1, true).
+			AddItem(nil, 0, 1, false), 7, 1, true).
+		AddItem(nil, 0, 1, false)
+	ui.Pages.AddPage("prompt-dir-dialog", modal, true, true)
+}
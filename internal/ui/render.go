@@ -0,0 +1,138 @@
+package ui
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/styles"
+	"github.com/muesli/termenv"
+	"github.com/rivo/tview"
+)
+
+// renderWindow is how many screens of transcript, counted up from the bottom,
+// are rendered synchronously by refreshChat. Older messages that are not in
+// the cache yet are shown as plain text until the background pass fills them in.
+const renderWindow = 3
+
+// minRenderWidth keeps glamour usable when the chat pane is very narrow.
+const minRenderWidth = 20
+
+type renderKey struct {
+	sum   uint64
+	width int
+}
+
+// renderCache memoises glamour output per message content and wrap width.
+// It is shared between the UI goroutine and background render passes; the
+// lock only guards the maps, renders run outside it.
+type renderCache struct {
+	mu        sync.Mutex
+	style     string
+	width     int
+	renderers map[int][]*glamour.TermRenderer // idle renderers per width; one is never used by two renders at once
+	entries   map[renderKey]string
+}
+
+func newRenderCache(width int) *renderCache {
+	// Resolve the auto style once, before tview owns the terminal; querying the
+	// background colour again later would write escape codes into the UI.
+	style := styles.LightStyle
+	if termenv.HasDarkBackground() {
+		style = styles.DarkStyle
+	}
+	return &renderCache{
+		style:     style,
+		width:     width,
+		renderers: make(map[int][]*glamour.TermRenderer),
+		entries:   make(map[renderKey]string),
+	}
+}
+
+func contentSum(content string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(content))
+	return h.Sum64()
+}
+
+// Width returns the wrap width new renders are produced for.
+func (c *renderCache) Width() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.width
+}
+
+// SetWidth switches the wrap width and reports whether it changed. Entries for
+// other widths are dropped so the cache does not grow with every resize.
+func (c *renderCache) SetWidth(width int) bool {
+	if width < minRenderWidth {
+		width = minRenderWidth
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if width == c.width {
+		return false
+	}
+	c.width = width
+	for k := range c.entries {
+		if k.width != width {
+			delete(c.entries, k)
+		}
+	}
+	for w := range c.renderers {
+		if w != width {
+			delete(c.renderers, w)
+		}
+	}
+	return true
+}
+
+// Lookup returns the cached tview-ready rendering of content at the current width.
+func (c *renderCache) Lookup(content string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out, ok := c.entries[renderKey{contentSum(content), c.width}]
+	return out, ok
+}
+
+// Render returns the rendering of content at width, rendering and caching it
+// if needed. Failed renders fall back to the escaped raw text.
+func (c *renderCache) Render(content string, width int) string {
+	key := renderKey{contentSum(content), width}
+	c.mu.Lock()
+	if out, ok := c.entries[key]; ok {
+		c.mu.Unlock()
+		return out
+	}
+	var r *glamour.TermRenderer
+	if idle := c.renderers[width]; len(idle) > 0 {
+		r = idle[len(idle)-1]
+		c.renderers[width] = idle[:len(idle)-1]
+	}
+	style := c.style
+	c.mu.Unlock()
+
+	if r == nil {
+		var err error
+		r, err = glamour.NewTermRenderer(
+			glamour.WithStandardStyle(style),
+			glamour.WithWordWrap(width),
+		)
+		if err != nil {
+			return tview.Escape(content)
+		}
+	}
+	rendered, err := r.Render(content)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.renderers[width] = append(c.renderers[width], r)
+	if err != nil {
+		return tview.Escape(content)
+	}
+	out := tview.TranslateANSI(rendered)
+	if width == c.width {
+		c.entries[key] = out
+	}
+	return out
+}
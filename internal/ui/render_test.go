@@ -0,0 +1,75 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// transcript returns n messages of the kind a long coding chat collects.
+func transcript(n int) []types.Message {
+	msgs := make([]types.Message, n)
+	for i := range msgs {
+		role, content := "user", fmt.Sprintf("How do I handle error %d when the *connection* drops?", i)
+		if i%2 == 1 {
+			role = "assistant"
+			content = fmt.Sprintf("## Option %d\n\nWrap the call and retry:\n\n```go\nfor attempt := 0; attempt < 3; attempt++ {\n\tif err := dial(); err == nil {\n\t\tbreak\n\t}\n}\n```\n\n- keep the backoff short\n- log every `attempt`\n\n%s", i, strings.Repeat("Plain prose to wrap across several lines of the chat pane. ", 8))
+		}
+		msgs[i] = types.Message{ID: int64(i + 1), Role: role, Content: content}
+	}
+	return msgs
+}
+
+func BenchmarkRender(b *testing.B) {
+	msgs := transcript(1000)
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			c := newRenderCache(80)
+			for _, m := range msgs {
+				c.Render(m.Content, 80)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		c := newRenderCache(80)
+		for _, m := range msgs {
+			c.Render(m.Content, 80)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, m := range msgs {
+				c.Render(m.Content, 80)
+			}
+		}
+	})
+}
+
+// BenchmarkRefreshChat measures redrawing a long transcript with a cold
+// cache, the case the lazy rendering is for: only the last screens are
+// rendered before the redraw returns.
+func BenchmarkRefreshChat(b *testing.B) {
+	home := b.TempDir()
+	b.Setenv("HOME", home)
+	store, err := storage.NewManager()
+	if err != nil {
+		b.Fatal(err)
+	}
+	ui := NewTViewUI(types.Config{Model: "gpt-4o"}, store)
+	ui.messages = transcript(1000)
+	ui.ChatView.SetRect(0, 0, 100, 40)
+	// A new generation stops the background pass of the previous redraw.
+	b.Cleanup(func() { ui.renderGen.Add(1) })
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		ui.renderGen.Add(1)
+		ui.render.mu.Lock()
+		clear(ui.render.entries)
+		ui.render.mu.Unlock()
+		b.StartTimer()
+		ui.redrawChat(true)
+	}
+}
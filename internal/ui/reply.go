@@ -0,0 +1,237 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/rivo/tview"
+	"github.com/sashabaranov/go-openai"
+	"github.com/evallife/chat-tui/internal/api"
+	"github.com/evallife/chat-tui/internal/tokens"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// reply is an answer being produced for one conversation, from the moment the
+// question is sent until the answer is saved. Everything the request is built
+// from is captured on the UI goroutine when it starts, so the user can switch
+// conversations, ask elsewhere or change settings meanwhile; the answer is
+// saved to the conversation that asked, whichever one is open by then.
+type reply struct {
+	convID       string
+	client       *api.Client
+	config       types.Config
+	systemPrompt string
+	messages     []types.Message // the conversation as sent, question last
+	compare      *comparison     // set when the question goes to several models
+
+	// Only touched on the UI goroutine.
+	streaming bool            // the answer has started to arrive
+	text      strings.Builder // the answer so far
+}
+
+// newReply captures the current conversation's settings for an answer.
+func (ui *TViewUI) newReply() *reply {
+	return &reply{
+		convID:       ui.convID,
+		client:       ui.apiClient,
+		config:       ui.config,
+		systemPrompt: ui.systemPrompt,
+		compare:      ui.comparing(),
+	}
+}
+
+func (r *reply) limit() int {
+	return tokens.Limit(r.config.Model, r.config.ContextLimits)
+}
+
+func (r *reply) vision() bool {
+	return isVisionModel(r.config)
+}
+
+func (r *reply) plan() contextPlan {
+	return planMessages(r.messages, r.systemPrompt, r.limit(), nil)
+}
+
+func (r *reply) request(plan contextPlan) []openai.ChatCompletionMessage {
+	return requestMessages(r.messages, r.systemPrompt, r.vision(), plan)
+}
+
+// current reports whether r belongs to the conversation on screen.
+func (ui *TViewUI) current(r *reply) bool {
+	return r.convID == ui.convID
+}
+
+// replyNotice shows a system message about r if its conversation is open.
+func (ui *TViewUI) replyNotice(r *reply, msg string) {
+	if ui.current(r) {
+		ui.appendSystemMsg(msg)
+	}
+}
+
+// busy tells the user when the current conversation is still waiting for an
+// answer; each conversation gets one at a time.
+func (ui *TViewUI) busy() bool {
+	if ui.replies[ui.convID] == nil {
+		return ui.awaitingPick()
+	}
+	ui.appendSystemMsg("An answer is still arriving; try again once it is done.")
+	return true
+}
+
+// addReply registers r as the answer underway for its conversation.
+func (ui *TViewUI) addReply(r *reply) {
+	ui.replies[r.convID] = r
+	ui.updateInputTitle()
+	ui.startSpinner()
+}
+
+// dropReply forgets r once it is saved or has failed.
+func (ui *TViewUI) dropReply(r *reply) {
+	if ui.replies[r.convID] == r {
+		delete(ui.replies, r.convID)
+	}
+	ui.updateBadges()
+}
+
+// startReply asks for the answer to the conversation as it is now.
+func (ui *TViewUI) startReply(r *reply) {
+	if ui.current(r) {
+		r.messages = slices.Clone(ui.messages)
+	} else {
+		msgs, err := ui.storage.ListMessages(r.convID)
+		if err != nil {
+			ui.dropReply(r)
+			ui.notify(r, fmt.Sprintf("failed: %v", err))
+			return
+		}
+		r.messages = msgs
+	}
+	if r.compare != nil {
+		ui.compareRound(r)
+		return
+	}
+	ui.sendMessages(r)
+}
+
+// streamedText is the part of r shown at the end of the transcript while it streams.
+func (r *reply) streamedText() string {
+	return "\n[green][b]ASSISTANT[-][/b]\n" + tview.Escape(r.text.String())
+}
+
+func (ui *TViewUI) streamOpenAIResponse(r *reply, sendMsgs []openai.ChatCompletionMessage) {
+	ctx := context.Background()
+	stream, err := r.client.StreamChat(ctx, sendMsgs)
+	if err != nil {
+		ui.App.QueueUpdateDraw(func() {
+			ui.dropReply(r)
+			if ui.current(r) {
+				ui.appendSystemMsg(fmt.Sprintf("API Error: %v", err))
+				ui.updateInputTitle()
+				return
+			}
+			ui.notify(r, fmt.Sprintf("failed: %v", err))
+		})
+		return
+	}
+	defer stream.Close()
+
+	ui.App.QueueUpdateDraw(func() {
+		r.streaming = true
+		if ui.current(r) {
+			fmt.Fprint(ui.ChatView, r.streamedText())
+		}
+	})
+
+	var streamErr error
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			streamErr = err
+			break
+		}
+		// Keep-alive and usage chunks carry no choices
+		if len(response.Choices) == 0 {
+			continue
+		}
+		content := response.Choices[0].Delta.Content
+		if content != "" {
+			ui.App.QueueUpdateDraw(func() {
+				r.text.WriteString(content)
+				if ui.current(r) {
+					fmt.Fprint(ui.ChatView, tview.Escape(content))
+				}
+			})
+		}
+	}
+
+	ui.App.QueueUpdateDraw(func() { ui.finishReply(r, streamErr) })
+}
+
+// finishReply saves the answer of r to its conversation. An answer to a
+// conversation that is not open marks it unread and is announced. An answer
+// to a conversation deleted for good meanwhile is dropped, as saving it
+// would leave messages that belong to nothing. When the stream broke off
+// with streamErr, what arrived is saved with a note that it is incomplete.
+func (ui *TViewUI) finishReply(r *reply, streamErr error) {
+	answer := r.text.String()
+	if streamErr != nil && answer == "" {
+		ui.dropReply(r)
+		if ui.current(r) {
+			ui.appendSystemMsg(fmt.Sprintf("API Error: %v", streamErr))
+			ui.updateInputTitle()
+			return
+		}
+		ui.notify(r, fmt.Sprintf("failed: %v", streamErr))
+		return
+	}
+	if streamErr != nil {
+		answer += fmt.Sprintf("\n\n*(The answer was interrupted: %v)*", streamErr)
+	}
+	if exists, err := ui.storage.HasConversation(r.convID); err != nil || !exists {
+		ui.dropReply(r)
+		if err != nil {
+			ui.replyNotice(r, fmt.Sprintf("Saving the answer failed: %v", err))
+		} else {
+			ui.replyNotice(r, "The conversation was deleted while the answer arrived; the answer was not saved.")
+		}
+		return
+	}
+	msgID, saveErr := ui.storage.SaveMessage(r.convID, openai.ChatMessageRoleAssistant, answer)
+	msg := types.Message{
+		ID:      msgID,
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: answer,
+	}
+	r.messages = append(r.messages, msg)
+	if question, ok := firstExchange(r.messages); ok && answer != "" {
+		ui.startTitle(r, question, answer)
+	}
+	if ui.current(r) {
+		ui.dropReply(r)
+		ui.messages = append(ui.messages, msg)
+		ui.refreshChat()
+		if saveErr != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Saving the answer failed: %v", saveErr))
+		} else if streamErr != nil {
+			ui.appendSystemMsg(fmt.Sprintf("The answer was interrupted: %v", streamErr))
+		}
+		return
+	}
+	ui.unread[r.convID] = true
+	ui.dropReply(r)
+	switch {
+	case saveErr != nil:
+		ui.notify(r, fmt.Sprintf("could not be saved: %v", saveErr))
+	case streamErr != nil:
+		ui.notify(r, fmt.Sprintf("was interrupted: %v", streamErr))
+	default:
+		ui.notify(r, "is ready")
+	}
+}
@@ -0,0 +1,167 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/evallife/chat-tui/internal/storage"
+)
+
+// TestReplyToBackgroundTab streams an answer into conversation A while B is
+// in front: the answer must land in A only. Run it with -race.
+func TestReplyToBackgroundTab(t *testing.T) {
+	release := make(chan struct{})
+	ui, _ := startUI(t, fakeAPI(t, release).URL)
+
+	var a string
+	do(ui, func() {
+		ui.handleInput("Question for A")
+		a = ui.convID
+	})
+	if a == "" {
+		t.Fatal("no conversation created for the question")
+	}
+	waitFor(t, ui, "the answer to start", func() bool { return ui.replies[a] != nil && ui.replies[a].streaming })
+
+	do(ui, func() {
+		ui.openNewChat()
+		ui.InputField.SetText("draft in B")
+	})
+	close(release)
+	waitFor(t, ui, "the answer to be saved", func() bool { return len(ui.replies) == 0 })
+
+	do(ui, func() {
+		if ui.convID != "" || len(ui.messages) != 0 {
+			t.Errorf("B shows conversation %q with %d messages, want a new chat", ui.convID, len(ui.messages))
+		}
+		if text := ui.ChatView.GetText(true); strings.Contains(text, "Hello") {
+			t.Errorf("A's answer shown in B: %q", text)
+		}
+		if got := ui.InputField.GetText(); got != "draft in B" {
+			t.Errorf("B's draft = %q", got)
+		}
+		if !ui.unread[a] {
+			t.Error("A not marked unread")
+		}
+	})
+
+	msgs, err := ui.storage.ListMessages(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[1].Role != openai.ChatMessageRoleAssistant || msgs[1].Content != "Hello from gpt-4o" {
+		t.Fatalf("A holds %+v, want the question and its answer", msgs)
+	}
+
+	do(ui, func() {
+		ui.showTab(0)
+		if ui.convID != a || len(ui.messages) != 2 || ui.messages[1].Content != "Hello from gpt-4o" {
+			t.Errorf("switching back shows %q with %+v", ui.convID, ui.messages)
+		}
+		if ui.unread[a] {
+			t.Error("A still unread after switching to it")
+		}
+	})
+}
+
+// TestReplyToPurgedConversation deletes a conversation for good while its
+// answer arrives: the answer must not be saved without it.
+func TestReplyToPurgedConversation(t *testing.T) {
+	release := make(chan struct{})
+	store, err := storage.OpenManager(filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ui, _ := startUIWith(t, fakeAPI(t, release).URL, store)
+
+	var a string
+	do(ui, func() {
+		ui.handleInput("Question for A")
+		a = ui.convID
+		ui.openNewChat()
+	})
+	waitFor(t, ui, "the answer to start", func() bool { return ui.replies[a] != nil && ui.replies[a].streaming })
+	if err := store.PurgeConversations([]string{a}); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	waitFor(t, ui, "the answer to arrive", func() bool { return len(ui.replies) == 0 })
+
+	if msgs, err := store.ListMessages(a); err != nil || len(msgs) != 0 {
+		t.Errorf("purged conversation holds %+v, %v", msgs, err)
+	}
+}
+
+// TestReplyInterrupted breaks the connection in the middle of an answer,
+// after a chunk without choices: what arrived is saved marked as incomplete.
+func TestReplyInterrupted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello \"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[]}\n\n")
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	ui, _ := startUI(t, srv.URL)
+
+	var id string
+	do(ui, func() {
+		ui.handleInput("Question")
+		id = ui.convID
+	})
+	waitFor(t, ui, "the answer to end", func() bool { return len(ui.replies) == 0 })
+
+	msgs, err := ui.storage.ListMessages(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || !strings.HasPrefix(msgs[1].Content, "Hello \n\n*(The answer was interrupted: ") {
+		t.Fatalf("conversation holds %+v, want the partial answer marked as interrupted", msgs)
+	}
+	do(ui, func() {
+		if text := ui.ChatView.GetText(true); !strings.Contains(text, "The answer was interrupted") {
+			t.Errorf("interruption not shown: %q", text)
+		}
+	})
+}
+
+// failingStore cannot create conversations.
+type failingStore struct {
+	storage.Store
+}
+
+func (failingStore) CreateConversation(title, modelName, systemPrompt string) (string, error) {
+	return "", errors.New("disk full")
+}
+
+// TestReplyWithoutConversation sends the first message when no conversation
+// can be created: nothing is asked and the message stays in the composer.
+func TestReplyWithoutConversation(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ui, _ := startUIWith(t, fakeAPI(t, nil).URL, failingStore{store})
+	do(ui, func() {
+		ui.handleInput("Question")
+		if len(ui.replies) != 0 || ui.convID != "" {
+			t.Errorf("reply started for %q", ui.convID)
+		}
+		if got := ui.InputField.GetText(); got != "Question" {
+			t.Errorf("composer holds %q", got)
+		}
+		if text := ui.ChatView.GetText(true); !strings.Contains(text, "Creating the conversation failed: disk full") {
+			t.Errorf("failure not shown: %q", text)
+		}
+	})
+}
@@ -0,0 +1,365 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/evallife/chat-tui/internal/api"
+	"github.com/evallife/chat-tui/internal/rag"
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/types"
+	"github.com/evallife/chat-tui/internal/workspace"
+)
+
+const (
+	defaultTopK = 5
+	// embedBatch is the number of chunks sent per /embeddings request.
+	embedBatch = 64
+	// maxIndexFiles bounds how many files one /index reads.
+	maxIndexFiles = 5000
+)
+
+// apiEmbedder embeds through the configured endpoint.
+type apiEmbedder struct {
+	client *api.Client
+	model  string
+}
+
+func (e apiEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return e.client.Embed(ctx, e.model, texts)
+}
+
+func (ui *TViewUI) embedder(model string) rag.Embedder {
+	if model == "" {
+		return rag.HashEmbedder{}
+	}
+	return apiEmbedder{client: ui.apiClient, model: model}
+}
+
+func (ui *TViewUI) retrievalTopK() int {
+	if ui.config.RetrievalTopK <= 0 {
+		return defaultTopK
+	}
+	return ui.config.RetrievalTopK
+}
+
+// chunkCache keeps the chunks of the collection last searched in memory.
+type chunkCache struct {
+	mu      sync.Mutex
+	id      string
+	updated time.Time
+	chunks  []types.Chunk
+}
+
+func (c *chunkCache) get(store storage.Store, col types.Collection) ([]types.Chunk, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.id != col.ID || !c.updated.Equal(col.UpdatedAt) {
+		chunks, err := store.CollectionChunks(col.ID)
+		if err != nil {
+			return nil, err
+		}
+		c.id, c.updated, c.chunks = col.ID, col.UpdatedAt, chunks
+	}
+	return c.chunks, nil
+}
+
+func (ui *TViewUI) findCollection(nameOrID string) (types.Collection, bool) {
+	cols, _ := ui.storage.ListCollections()
+	for _, c := range cols {
+		if c.ID == nameOrID || strings.EqualFold(c.Name, nameOrID) {
+			return c, true
+		}
+	}
+	return types.Collection{}, false
+}
+
+// indexDir chunks and embeds the text files of dir in the background. A
+// directory that was indexed before is re-indexed into the same collection.
+func (ui *TViewUI) indexDir(dir string) {
+	root, err := filepath.Abs(dir)
+	if err == nil {
+		var info os.FileInfo
+		if info, err = os.Stat(root); err == nil && !info.IsDir() {
+			err = fmt.Errorf("%s is not a directory", dir)
+		}
+	}
+	if err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Index failed: %v", err))
+		return
+	}
+	col := types.Collection{Name: filepath.Base(root), Root: root, Model: ui.config.EmbeddingModel}
+	cols, _ := ui.storage.ListCollections()
+	for _, c := range cols {
+		if c.Root == root {
+			col.ID, col.Name = c.ID, c.Name
+		}
+	}
+	ui.appendSystemMsg(fmt.Sprintf("Indexing %s ...", tview.Escape(root)))
+	emb := ui.embedder(col.Model)
+	ui.jobs++
+	go func() {
+		col, skipped, err := ui.buildIndex(emb, col)
+		ui.App.QueueUpdateDraw(func() {
+			ui.jobs--
+			if err != nil {
+				ui.appendSystemMsg(fmt.Sprintf("Index failed: %v", err))
+				return
+			}
+			msg := fmt.Sprintf("Indexed %s: %d files, %d chunks.", tview.Escape(col.Name), col.Files, col.Chunks)
+			if skipped > 0 {
+				msg += fmt.Sprintf(" %d binary, large or unreadable files were skipped.", skipped)
+			}
+			ui.appendSystemMsg(msg + fmt.Sprintf(" Use /rag %s to retrieve from it in this chat.", tview.Escape(col.Name)))
+			ui.refreshCollectionsIfVisible()
+		})
+	}()
+}
+
+func (ui *TViewUI) buildIndex(emb rag.Embedder, col types.Collection) (types.Collection, int, error) {
+	listing, err := workspace.List(col.Root)
+	if err != nil {
+		return col, 0, err
+	}
+	var chunks []types.Chunk
+	skipped := 0
+	col.Files = 0
+	for _, rel := range listing {
+		if strings.HasSuffix(rel, "/") {
+			continue
+		}
+		if col.Files >= maxIndexFiles || workspace.IsImage(rel) {
+			skipped++
+			continue
+		}
+		content, err := workspace.ReadText(filepath.Join(col.Root, filepath.FromSlash(rel)))
+		if err != nil {
+			skipped++
+			continue
+		}
+		col.Files++
+		chunks = append(chunks, rag.Split(rel, content)...)
+	}
+	if len(chunks) == 0 {
+		return col, skipped, fmt.Errorf("no text files in %s", col.Root)
+	}
+
+	for start := 0; start < len(chunks); start += embedBatch {
+		batch := chunks[start:min(start+embedBatch, len(chunks))]
+		texts := make([]string, len(batch))
+		for i, c := range batch {
+			texts[i] = fmt.Sprintf("%s\n%s", c.Path, c.Content)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		vecs, err := emb.Embed(ctx, texts)
+		cancel()
+		if err != nil {
+			return col, skipped, fmt.Errorf("embeddings: %w", err)
+		}
+		for i := range batch {
+			batch[i].Vector = vecs[i]
+		}
+	}
+	col, err = ui.storage.SaveCollection(col, chunks)
+	return col, skipped, err
+}
+
+// retrieve embeds question and formats the closest chunks of the collection
+// as a numbered context attachment the model can cite.
+func (ui *TViewUI) retrieve(emb rag.Embedder, k int, col types.Collection, question string) (*types.Attachment, error) {
+	chunks, err := ui.chunks.get(ui.storage, col)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	vecs, err := emb.Embed(ctx, []string{question})
+	if err != nil {
+		return nil, err
+	}
+	hits := rag.Search(chunks, vecs[0], k)
+	if len(hits) == 0 {
+		return nil, nil
+	}
+
+	var sb strings.Builder
+	var cites []string
+	fmt.Fprintf(&sb, "Excerpts from the indexed project %s that may help. Cite them as [n] where you use them.", col.Name)
+	for i, h := range hits {
+		cite := fmt.Sprintf("[%d] %s:%d-%d", i+1, h.Path, h.StartLine, h.EndLine)
+		cites = append(cites, cite)
+		fmt.Fprintf(&sb, "\n\n%s\n%s", cite, fenced(strings.TrimPrefix(filepath.Ext(h.Path), "."), h.Content))
+	}
+	content := sb.String()
+	return &types.Attachment{
+		Kind:    types.AttachmentContext,
+		Name:    col.Name + " " + strings.Join(cites, " "),
+		Content: content,
+		Size:    int64(len(content)),
+	}, nil
+}
+
+// handleRagCommand implements /rag: show, set or turn off the collection the
+// current conversation retrieves from.
+func (ui *TViewUI) handleRagCommand(args []string) {
+	if len(args) == 0 {
+		if ui.collection == "" {
+			ui.appendSystemMsg("Retrieval is off for this chat. Use /rag <collection> to turn it on, /index <dir> to create one.")
+			return
+		}
+		name := ui.collection
+		if c, ok := ui.findCollection(ui.collection); ok {
+			name = c.Name
+		}
+		ui.appendSystemMsg(fmt.Sprintf("Retrieving from %s. Use /rag off to stop.", tview.Escape(name)))
+		return
+	}
+	if args[0] == "off" {
+		ui.setCollection("")
+		ui.appendSystemMsg("Retrieval turned off for this chat.")
+		return
+	}
+	c, ok := ui.findCollection(strings.Join(args, " "))
+	if !ok {
+		ui.appendSystemMsg(fmt.Sprintf("Unknown collection: %s. Use /index to list them.", tview.Escape(strings.Join(args, " "))))
+		return
+	}
+	ui.setCollection(c.ID)
+	ui.appendSystemMsg(fmt.Sprintf("Retrieving the top chunks of %s for each message in this chat.", tview.Escape(c.Name)))
+}
+
+// setCollection switches retrieval for the current conversation, saving it once the conversation exists.
+func (ui *TViewUI) setCollection(id string) {
+	ui.collection = id
+	if ui.convID != "" {
+		if err := ui.storage.SetConversationCollection(ui.convID, id); err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Saving retrieval setting failed: %v", err))
+		}
+	}
+}
+
+// showCollections opens the page listing indexed collections.
+func (ui *TViewUI) showCollections() {
+	list := tview.NewList()
+	list.SetBorder(true).SetTitle(" Indexed Collections (Enter to use in this chat) ")
+	ui.CollectionList = list
+
+	selected := func() (types.Collection, bool) {
+		idx := list.GetCurrentItem()
+		if idx < 0 || idx >= len(ui.collections) {
+			return types.Collection{}, false
+		}
+		return ui.collections[idx], true
+	}
+	use := func() {
+		if c, ok := selected(); ok {
+			ui.Pages.SwitchToPage("chat")
+			ui.handleRagCommand([]string{c.ID})
+		}
+	}
+	reindex := func() {
+		if c, ok := selected(); ok {
+			ui.indexDir(c.Root)
+		}
+	}
+	remove := func() {
+		c, ok := selected()
+		if !ok {
+			return
+		}
+		modal := tview.NewModal().
+			SetText(fmt.Sprintf("Delete the index of \"%s\"?", c.Name)).
+			AddButtons([]string{"Delete", "Cancel"}).
+			SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+				ui.Pages.RemovePage("confirm-delete-collection")
+				ui.App.SetFocus(list)
+				if buttonLabel != "Delete" {
+					return
+				}
+				if err := ui.storage.DeleteCollection(c.ID); err != nil {
+					ui.appendSystemMsg(fmt.Sprintf("Delete failed: %v", err))
+					return
+				}
+				if ui.collection == c.ID {
+					ui.collection = ""
+				}
+				ui.reloadCollections()
+			})
+		ui.Pages.AddPage("confirm-delete-collection", modal, true, true)
+	}
+
+	list.SetSelectedFunc(func(int, string, string, rune) { use() })
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEsc {
+			ui.Pages.SwitchToPage("chat")
+			return nil
+		}
+		if event.Key() == tcell.KeyDelete {
+			remove()
+			return nil
+		}
+		switch event.Rune() {
+		case 'r':
+			reindex()
+		case 'd':
+			remove()
+		default:
+			return event
+		}
+		return nil
+	})
+
+	bar := tview.NewFlex().SetDirection(tview.FlexColumn)
+	bar.SetBorder(true).SetTitle(" Collection Actions ")
+	bar.AddItem(ui.makeButton("Use", use), 0, 1, false)
+	bar.AddItem(ui.makeButton("Re-index", reindex), 0, 1, false)
+	bar.AddItem(ui.makeButton("Delete", remove), 0, 1, false)
+	bar.AddItem(ui.makeButton("Back", func() { ui.Pages.SwitchToPage("chat") }), 0, 1, false)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(list, 0, 1, true).
+		AddItem(tview.NewTextView().SetText(" Enter use  r re-index  d delete  Esc back  (/index <dir> adds a collection)"), 1, 1, false).
+		AddItem(bar, 3, 1, false)
+
+	ui.reloadCollections()
+	ui.Pages.AddPage("collections", layout, true, true)
+	ui.Pages.SwitchToPage("collections")
+}
+
+func (ui *TViewUI) reloadCollections() {
+	current := ui.CollectionList.GetCurrentItem()
+	ui.collections, _ = ui.storage.ListCollections()
+	ui.CollectionList.Clear()
+	if len(ui.collections) == 0 {
+		ui.CollectionList.AddItem("No collections yet", "Use /index <dir> to index a directory", 0, nil)
+		return
+	}
+	for _, c := range ui.collections {
+		name := tview.Escape(c.Name)
+		if c.ID == ui.collection {
+			name += " [green](in use)[-]"
+		}
+		model := c.Model
+		if model == "" {
+			model = "local"
+		}
+		ui.CollectionList.AddItem(name, fmt.Sprintf("%s · %d files, %d chunks · %s · %s",
+			tview.Escape(c.Root), c.Files, c.Chunks, model, c.UpdatedAt.Local().Format("2006-01-02 15:04")), 0, nil)
+	}
+	if current < len(ui.collections) {
+		ui.CollectionList.SetCurrentItem(current)
+	}
+}
+
+func (ui *TViewUI) refreshCollectionsIfVisible() {
+	if name, _ := ui.Pages.GetFrontPage(); name == "collections" {
+		ui.reloadCollections()
+	}
+}
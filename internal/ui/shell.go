@@ -0,0 +1,141 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rivo/tview"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+const (
+	// shellTimeout bounds how long a !command may run.
+	shellTimeout = 60 * time.Second
+	// shellOutputLimit caps the attached output; the start and the end are kept.
+	shellOutputLimit = 32 << 10
+)
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// headTail keeps the first and last limit/2 bytes written to it and counts
+// the rest, so a command that prints without end cannot use up memory.
+type headTail struct {
+	limit      int
+	head, tail []byte
+	dropped    int
+}
+
+func (w *headTail) Write(p []byte) (int, error) {
+	n, half := len(p), w.limit/2
+	if room := half - len(w.head); room > 0 {
+		k := min(room, len(p))
+		w.head = append(w.head, p[:k]...)
+		p = p[k:]
+	}
+	if len(p) >= half {
+		w.dropped += len(w.tail) + len(p) - half
+		w.tail = append(w.tail[:0], p[len(p)-half:]...)
+		return n, nil
+	}
+	w.tail = append(w.tail, p...)
+	if over := len(w.tail) - half; over > 0 {
+		w.dropped += over
+		w.tail = append(w.tail[:0], w.tail[over:]...)
+	}
+	return n, nil
+}
+
+// String returns what was kept without terminal escape codes, marking where
+// output was left out.
+func (w *headTail) String() string {
+	head, tail := string(w.head), string(w.tail)
+	if w.dropped == 0 {
+		return ansiEscape.ReplaceAllString(head+tail, "")
+	}
+	// Cut between runes, even where a line is too long to cut at its end.
+	for len(head) > 0 {
+		if r, size := utf8.DecodeLastRuneInString(head); r != utf8.RuneError || size > 1 {
+			break
+		}
+		head = head[:len(head)-1]
+	}
+	for len(tail) > 0 && !utf8.RuneStart(tail[0]) {
+		tail = tail[1:]
+	}
+	// Cut at line breaks so no line is split in the middle.
+	if i := strings.LastIndexByte(head, '\n'); i > 0 {
+		head = head[:i+1]
+	}
+	if i := strings.IndexByte(tail, '\n'); i >= 0 {
+		tail = tail[i+1:]
+	}
+	omitted := w.dropped + len(w.head) - len(head) + len(w.tail) - len(tail)
+	return fmt.Sprintf("%s[... %d bytes omitted ...]\n%s", ansiEscape.ReplaceAllString(head, ""), omitted, ansiEscape.ReplaceAllString(tail, ""))
+}
+
+// runShell runs command with sh -c (cmd /C on Windows) in the working
+// directory and returns its combined output, capped, and a note on how it
+// ended.
+func runShell(command string) (output, status string) {
+	ctx, cancel := context.WithTimeout(context.Background(), shellTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.WaitDelay = time.Second
+	out := &headTail{limit: shellOutputLimit}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err := cmd.Run()
+
+	output = out.String()
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		status = fmt.Sprintf("killed after %s", shellTimeout)
+	case errors.As(err, &exitErr):
+		status = fmt.Sprintf("exit status %d", exitErr.ExitCode())
+	case err != nil:
+		status = err.Error()
+	default:
+		status = "exit status 0"
+	}
+	return output, status
+}
+
+// runCommand implements !command and /sh: the command runs in the background
+// and its output is previewed before it is attached to the next message.
+func (ui *TViewUI) runCommand(command string) {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		ui.appendSystemMsg("Usage: !<command> or /sh <command>")
+		return
+	}
+	ui.appendSystemMsg(fmt.Sprintf("Running $ %s ...", tview.Escape(command)))
+	go func() {
+		output, status := runShell(command)
+		ui.App.QueueUpdateDraw(func() {
+			a := types.Attachment{
+				Kind:    types.AttachmentCommand,
+				Name:    command,
+				Content: fmt.Sprintf("%s\n(%s)", strings.TrimRight(output, "\n"), status),
+				Size:    int64(len(output)),
+			}
+			body := fmt.Sprintf("[yellow]$ %s[-]\n%s\n[gray](%s)[-]", tview.Escape(command), tview.Escape(output), tview.Escape(status))
+			ui.showPreviewModal(fmt.Sprintf(" $ %s ", tview.Escape(truncateRunes(command, 60))), body, "Attach", func() {
+				ui.attach(a)
+			})
+		})
+	}()
+}
@@ -0,0 +1,61 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// capped writes out to a headTail in pieces of n bytes.
+func capped(out string, limit, n int) string {
+	w := &headTail{limit: limit}
+	for len(out) > 0 {
+		k := min(n, len(out))
+		w.Write([]byte(out[:k]))
+		out = out[k:]
+	}
+	return w.String()
+}
+
+func TestHeadTail(t *testing.T) {
+	if got := capped("short\n\x1b[31mred\x1b[0m\n", 100, 3); got != "short\nred\n" {
+		t.Errorf("short output changed to %q", got)
+	}
+
+	lines := strings.Repeat("0123456789\n", 100)
+	for _, n := range []int{1, 7, 64, len(lines)} {
+		got := capped(lines, 100, n)
+		if !strings.Contains(got, "bytes omitted") {
+			t.Fatalf("pieces of %d: long output not cut: %q", n, got)
+		}
+		head, tail, _ := strings.Cut(got, "[...")
+		if !strings.HasSuffix(head, "\n") || !strings.HasPrefix(tail[strings.Index(tail, "\n")+1:], "0") {
+			t.Errorf("pieces of %d: cut inside a line: %q", n, got)
+		}
+		if !strings.Contains(got, "[... 1012 bytes omitted ...]") {
+			t.Errorf("pieces of %d: wrong count: %q", n, got)
+		}
+	}
+
+	// One long line of multi-byte runes has no line break to cut at.
+	wide := strings.Repeat("日本語", 100)
+	for limit := 10; limit < 20; limit++ {
+		if got := capped(wide, limit, 5); !utf8.ValidString(got) {
+			t.Errorf("limit %d: cut inside a rune: %q", limit, got)
+		}
+	}
+}
+
+func TestHeadTailBounded(t *testing.T) {
+	w := &headTail{limit: 64}
+	chunk := []byte(strings.Repeat("y\n", 4096))
+	for i := 0; i < 100; i++ {
+		w.Write(chunk)
+	}
+	if len(w.head) != 32 || len(w.tail) != 32 {
+		t.Errorf("kept %d and %d bytes, want 32 each", len(w.head), len(w.tail))
+	}
+	if w.dropped != 100*len(chunk)-64 {
+		t.Errorf("dropped %d bytes, want %d", w.dropped, 100*len(chunk)-64)
+	}
+}
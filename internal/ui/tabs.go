@@ -0,0 +1,363 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/evallife/chat-tui/internal/config"
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// tab is an open conversation that is not in front. The one in front lives in
+// the UI's own fields (convID, messages, systemPrompt, ...) and is copied back
+// into its tab when another one is shown.
+type tab struct {
+	convID       string // "" for a new chat that has no messages yet
+	title        string
+	titleOf      string // the conversation title was read for
+	systemPrompt string
+	collection   string
+	draft        string // the composer text
+	attachments  []types.Attachment
+	row, col     int // scroll offset of the chat view
+	scrolled     bool
+}
+
+// maxTabTitle is how many characters of a title fit on a tab.
+const maxTabTitle = 24
+
+func (ui *TViewUI) setupTabBar() {
+	ui.tabs = []*tab{{}}
+	ui.TabBar = tview.NewTextView().
+		SetDynamicColors(true).
+		SetRegions(true).
+		SetWrap(false)
+	ui.TabBar.SetHighlightedFunc(func(added, removed, remaining []string) {
+		if len(added) == 0 {
+			return
+		}
+		i, err := strconv.Atoi(strings.TrimPrefix(added[0], "tab-"))
+		if err != nil {
+			return
+		}
+		// Clicking selects the tab; the bar draws the active one itself
+		ui.TabBar.Highlight()
+		ui.showTab(i)
+		ui.App.SetFocus(ui.InputField)
+	})
+}
+
+// handleTabKey switches tabs with Alt+1..9 and Ctrl+PgDn/PgUp, or
+// Ctrl+Tab and Ctrl+Shift+Tab in the few terminals that report those, and
+// closes the current one with Alt+W.
+func (ui *TViewUI) handleTabKey(event *tcell.EventKey) bool {
+	switch {
+	case event.Key() == tcell.KeyPgDn && event.Modifiers()&tcell.ModCtrl != 0:
+		ui.showTab((ui.tab + 1) % len(ui.tabs))
+	case event.Key() == tcell.KeyPgUp && event.Modifiers()&tcell.ModCtrl != 0:
+		ui.showTab((ui.tab + len(ui.tabs) - 1) % len(ui.tabs))
+	case event.Key() == tcell.KeyTab && event.Modifiers()&tcell.ModCtrl != 0:
+		ui.showTab((ui.tab + 1) % len(ui.tabs))
+	case event.Key() == tcell.KeyBacktab && event.Modifiers()&tcell.ModCtrl != 0:
+		ui.showTab((ui.tab + len(ui.tabs) - 1) % len(ui.tabs))
+	case event.Key() == tcell.KeyRune && event.Modifiers()&tcell.ModAlt != 0 && event.Rune() >= '1' && event.Rune() <= '9':
+		ui.showTab(int(event.Rune() - '1'))
+	case event.Key() == tcell.KeyRune && event.Modifiers()&tcell.ModAlt != 0 && event.Rune() == 'w':
+		ui.closeTab()
+	default:
+		return false
+	}
+	return true
+}
+
+// tabConvID returns the conversation of tab i, looking at the UI for the
+// active one.
+func (ui *TViewUI) tabConvID(i int) string {
+	if i == ui.tab {
+		return ui.convID
+	}
+	return ui.tabs[i].convID
+}
+
+// blankTab reports whether the active tab is a new chat nothing was sent in.
+func (ui *TViewUI) blankTab() bool {
+	return ui.convID == "" && len(ui.messages) == 0
+}
+
+// stashTab copies the state of the chat in front into its tab.
+func (ui *TViewUI) stashTab() {
+	t := ui.tabs[ui.tab]
+	t.convID = ui.convID
+	t.systemPrompt = ui.systemPrompt
+	t.collection = ui.collection
+	t.draft = ui.InputField.GetText()
+	t.attachments = ui.pendingAttachments
+	t.row, t.col = ui.ChatView.GetScrollOffset()
+	t.scrolled = true
+}
+
+// showTab brings tab i to the front.
+func (ui *TViewUI) showTab(i int) {
+	if i < 0 || i >= len(ui.tabs) {
+		return
+	}
+	if i == ui.tab {
+		ui.Pages.SwitchToPage("chat")
+		return
+	}
+	ui.stashTab()
+	ui.tab = i
+	ui.restoreTab()
+}
+
+// restoreTab fills the UI from the active tab: its conversation as stored now,
+// its draft and where it was scrolled to.
+func (ui *TViewUI) restoreTab() {
+	t := ui.tabs[ui.tab]
+	ui.convID = t.convID
+	ui.systemPrompt = t.systemPrompt
+	ui.collection = t.collection
+	ui.messages = []types.Message{}
+	var loadErr error
+	if t.convID != "" {
+		if msgs, err := ui.storage.ListMessages(t.convID); err == nil {
+			ui.messages = msgs
+		} else {
+			loadErr = err
+		}
+		if ui.unread[t.convID] {
+			delete(ui.unread, t.convID)
+			ui.updateBadges()
+		}
+	}
+	ui.selectedMsg = -1
+	clear(ui.markedMsgs)
+	ui.setEditing(-1)
+	// Put the draft back as typed, without the paste and "@" handling
+	ui.isProcessingInput = true
+	ui.InputField.SetText(t.draft)
+	ui.isProcessingInput = false
+	ui.pendingAttachments = t.attachments
+	ui.updateAttachmentBar()
+	ui.refreshChat()
+	ui.layoutChatArea()
+	if loadErr != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Loading messages failed: %v", loadErr))
+	} else if t.scrolled {
+		ui.ChatView.ScrollTo(t.row, t.col)
+	}
+	ui.refreshTabs()
+	ui.Pages.SwitchToPage("chat")
+}
+
+// addTab opens an empty tab after the others and brings it to the front; the
+// caller fills it.
+func (ui *TViewUI) addTab() {
+	ui.stashTab()
+	ui.tabs = append(ui.tabs, &tab{})
+	ui.tab = len(ui.tabs) - 1
+	ui.InputField.SetText("")
+	ui.pendingAttachments = nil
+	ui.updateAttachmentBar()
+	ui.layoutChatArea()
+}
+
+// openNewChat starts a new chat in a new tab, or in the current one when
+// nothing was sent there yet.
+func (ui *TViewUI) openNewChat() {
+	if !ui.blankTab() {
+		ui.addTab()
+	}
+	ui.newConversation()
+}
+
+// openConversation shows conversation id: in the tab that holds it, in the
+// current tab when that is an empty new chat, otherwise in a new tab.
+func (ui *TViewUI) openConversation(id string) {
+	if id == "" {
+		return
+	}
+	for i := range ui.tabs {
+		if ui.tabConvID(i) == id {
+			if i == ui.tab {
+				ui.loadConversation(id)
+			} else {
+				ui.showTab(i)
+			}
+			return
+		}
+	}
+	if !ui.blankTab() {
+		ui.addTab()
+	}
+	ui.loadConversation(id)
+}
+
+// closeTab closes the active tab. Closing the last one leaves a new chat.
+func (ui *TViewUI) closeTab() {
+	if ui.comparing() != nil {
+		ui.endCompare()
+	}
+	if len(ui.tabs) == 1 {
+		ui.InputField.SetText("")
+		ui.pendingAttachments = nil
+		ui.updateAttachmentBar()
+		ui.newConversation()
+		return
+	}
+	ui.tabs = append(ui.tabs[:ui.tab], ui.tabs[ui.tab+1:]...)
+	if ui.tab == len(ui.tabs) {
+		ui.tab--
+	}
+	ui.restoreTab()
+}
+
+// closeTabsOf closes the tabs in the background that hold one of ids.
+func (ui *TViewUI) closeTabsOf(ids []string) {
+	closing := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		closing[id] = true
+	}
+	stop := false
+	kept := ui.tabs[:0]
+	active := 0
+	for i, t := range ui.tabs {
+		if i == ui.tab {
+			active = len(kept)
+		} else if closing[t.convID] {
+			stop = stop || ui.compare != nil && ui.compare.tab == t
+			continue
+		}
+		kept = append(kept, t)
+	}
+	ui.tabs, ui.tab = kept, active
+	if stop {
+		ui.endCompare()
+	}
+	ui.refreshTabs()
+}
+
+// resetTabs closes every tab and starts over with a new chat, as after
+// restoring a backup.
+func (ui *TViewUI) resetTabs() {
+	ui.endCompare()
+	ui.tabs = []*tab{{}}
+	ui.tab = 0
+	ui.InputField.SetText("")
+	ui.pendingAttachments = nil
+	ui.updateAttachmentBar()
+	ui.newConversation()
+}
+
+// refreshTabs redraws the tab bar, reading the titles of tabs whose
+// conversation changed.
+func (ui *TViewUI) refreshTabs() {
+	for i, t := range ui.tabs {
+		id := ui.tabConvID(i)
+		if id == t.titleOf {
+			continue
+		}
+		t.title, t.titleOf = "", id
+		if id != "" {
+			if conv, err := ui.storage.GetConversation(id); err == nil {
+				t.title = conv.Title
+			}
+		}
+	}
+	ui.drawTabBar()
+}
+
+// reloadTabTitles redraws the tab bar after titles may have changed.
+func (ui *TViewUI) reloadTabTitles() {
+	for _, t := range ui.tabs {
+		t.titleOf = ""
+	}
+	ui.refreshTabs()
+}
+
+// drawTabBar renders the tabs with their number for Alt+1..9 and the same
+// badges as the history list.
+func (ui *TViewUI) drawTabBar() {
+	var b strings.Builder
+	for i, t := range ui.tabs {
+		title := t.title
+		if title == "" {
+			title = "New chat"
+		}
+		label := tview.Escape(truncateRunes(title, maxTabTitle))
+		if id := ui.tabConvID(i); id != "" {
+			label = ui.badge(id) + label
+		}
+		style := "[lightgray:darkslategray]"
+		if i == ui.tab {
+			style = "[black:lightskyblue]"
+		}
+		fmt.Fprintf(&b, `["tab-%d"]%s %d %s [-:-][""] `, i, style, i+1, label)
+	}
+	ui.TabBar.SetText(b.String())
+}
+
+// openSavedTabs reopens the tabs that were open when chat-tui last quit,
+// skipping conversations that have been deleted since.
+func (ui *TViewUI) openSavedTabs() {
+	state, err := config.LoadState()
+	if err != nil || len(state.Tabs) == 0 {
+		return
+	}
+	// Tabs of conversations that cannot be read are left out like deleted ones.
+	convs, err := ui.storage.ListConversations()
+	if err != nil && convs == nil {
+		return
+	}
+	known := make(map[string]bool, len(convs))
+	for _, c := range convs {
+		known[c.ID] = true
+	}
+	var tabs []*tab
+	active := 0
+	for i, s := range state.Tabs {
+		if s.ConvID != "" && !known[s.ConvID] {
+			continue
+		}
+		t := &tab{convID: s.ConvID, systemPrompt: ui.systemPrompt, draft: s.Draft, attachments: s.Attachments,
+			row: s.Row, col: s.Col, scrolled: s.Row != 0 || s.Col != 0}
+		if s.ConvID != "" {
+			conv, err := ui.storage.GetConversation(s.ConvID)
+			if err != nil {
+				continue
+			}
+			t.systemPrompt, t.collection = conv.SystemPrompt, conv.Collection
+		}
+		// The active tab, or the last one before it when it is gone
+		if i <= state.ActiveTab {
+			active = len(tabs)
+		}
+		tabs = append(tabs, t)
+	}
+	if len(tabs) == 0 {
+		return
+	}
+	ui.tabs = tabs
+	ui.tab = active
+	ui.restoreTab()
+}
+
+// saveTabs remembers the open tabs for the next start: their conversation,
+// scroll position and, unless the store is encrypted, draft and attachments.
+func (ui *TViewUI) saveTabs() error {
+	ui.stashTab()
+	state := types.State{ActiveTab: ui.tab}
+	plain := !storage.Encrypted(ui.storage)
+	for _, t := range ui.tabs {
+		s := types.TabState{ConvID: t.convID, Row: t.row, Col: t.col}
+		if plain {
+			s.Draft, s.Attachments = t.draft, t.attachments
+		}
+		state.Tabs = append(state.Tabs, s)
+	}
+	return config.SaveState(state)
+}
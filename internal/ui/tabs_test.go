@@ -0,0 +1,59 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// TestSavedTabs reopens three tabs after the first one's conversation was
+// deleted: the drafts come back and the same tab is in front.
+func TestSavedTabs(t *testing.T) {
+	ui, _ := startUI(t, "http://127.0.0.1:0")
+	var ids []string
+	for _, title := range []string{"One", "Two", "Three"} {
+		id, err := ui.storage.CreateConversation(title, "gpt-4o", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	do(ui, func() {
+		for _, id := range ids {
+			ui.openConversation(id)
+			ui.InputField.SetText("Draft for " + id)
+		}
+		ui.showTab(1)
+		ui.pendingAttachments = []types.Attachment{{Kind: "file", Name: "notes.txt", Content: "notes"}}
+		ui.showTab(2)
+		if err := ui.saveTabs(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err := ui.storage.PurgeConversations(ids[:1]); err != nil {
+		t.Fatal(err)
+	}
+	do(ui, func() {
+		ui.resetTabs()
+		ui.openSavedTabs()
+	})
+
+	if len(ui.tabs) != 2 || ui.tab != 1 || ui.convID != ids[2] {
+		t.Fatalf("got %d tabs with %d (%s) in front, want 2 with 1 (%s)", len(ui.tabs), ui.tab, ui.convID, ids[2])
+	}
+	if got := ui.InputField.GetText(); got != "Draft for "+ids[2] {
+		t.Errorf("draft of the active tab is %q", got)
+	}
+	if got := ui.tabs[0]; got.draft != "Draft for "+ids[1] || len(got.attachments) != 1 {
+		t.Errorf("first tab has draft %q and %d attachments", got.draft, len(got.attachments))
+	}
+	if got := ui.tabs[1].title; got != "Three" {
+		t.Errorf("tab title is %q", got)
+	}
+
+	do(ui, func() { ui.handleTabKey(tcell.NewEventKey(tcell.KeyPgDn, 0, tcell.ModCtrl)) })
+	if ui.tab != 0 || ui.convID != ids[1] {
+		t.Errorf("Ctrl+PgDn left tab %d (%s) in front", ui.tab, ui.convID)
+	}
+}
@@ -0,0 +1,176 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rivo/tview"
+	"github.com/evallife/chat-tui/internal/promptfile"
+	"github.com/evallife/chat-tui/internal/templates"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// listTemplates returns the stored templates followed by those in the shared
+// template directory; a directory template shadows a stored one with the same ID.
+func (ui *TViewUI) listTemplates() []types.SystemPrompt {
+	var shared []types.SystemPrompt
+	if ui.config.TemplateDir != "" {
+		shared, _ = promptfile.ImportDir(ui.config.TemplateDir)
+	}
+	shadowed := make(map[string]bool)
+	for _, t := range shared {
+		shadowed[t.ID] = true
+	}
+	var out []types.SystemPrompt
+	prompts, _ := ui.storage.ListSystemPrompts()
+	for _, p := range prompts {
+		if p.Kind == types.PromptKindTemplate && !shadowed[p.ID] {
+			out = append(out, p)
+		}
+	}
+	for _, t := range shared {
+		if t.Kind == "" || t.Kind == types.PromptKindTemplate {
+			t.Kind = types.PromptKindTemplate
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func findTemplate(list []types.SystemPrompt, name string) (types.SystemPrompt, bool) {
+	for _, t := range list {
+		if strings.EqualFold(t.ID, name) || strings.EqualFold(t.Name, name) {
+			return t, true
+		}
+	}
+	return types.SystemPrompt{}, false
+}
+
+// handleTemplateCommand implements /t: list templates, import a directory of
+// them, or expand one into the composer.
+func (ui *TViewUI) handleTemplateCommand(args []string) {
+	if len(args) == 0 {
+		list := ui.listTemplates()
+		if len(list) == 0 {
+			ui.appendSystemMsg("No templates yet. Create one on the System Prompts page or set template_dir in the config.")
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("Templates (use /t <name>):")
+		for _, t := range list {
+			fmt.Fprintf(&sb, "\n- %s (%s)", tview.Escape(t.ID), tview.Escape(t.Name))
+		}
+		ui.appendSystemMsg(sb.String())
+		return
+	}
+	if args[0] == "import" {
+		dir := ui.config.TemplateDir
+		if len(args) > 1 {
+			dir = args[1]
+		}
+		if dir == "" {
+			ui.appendSystemMsg("Usage: /t import <dir> (or set template_dir in the config)")
+			return
+		}
+		ui.importTemplates(dir)
+		return
+	}
+	name := strings.Join(args, " ")
+	t, ok := findTemplate(ui.listTemplates(), name)
+	if !ok {
+		ui.appendSystemMsg(fmt.Sprintf("Unknown template: %s. Type /t for the list.", name))
+		return
+	}
+	ui.useTemplate(t)
+}
+
+func (ui *TViewUI) importTemplates(dir string) {
+	list, err := promptfile.ImportDir(dir)
+	if err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Import failed: %v", err))
+		return
+	}
+	n := 0
+	for _, t := range list {
+		if t.Kind != "" && t.Kind != types.PromptKindTemplate {
+			continue
+		}
+		t.Kind = types.PromptKindTemplate
+		if _, err := ui.storage.SaveSystemPrompt(t); err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Import failed: %v", err))
+			return
+		}
+		n++
+	}
+	ui.appendSystemMsg(fmt.Sprintf("Imported %d templates from %s", n, dir))
+}
+
+// useTemplate resolves the built-in variables of t and asks for the rest in a
+// form before putting the expanded text into the composer.
+func (ui *TViewUI) useTemplate(t types.SystemPrompt) {
+	values := make(map[string]string)
+	var ask []string
+	for _, name := range templates.Vars(t.Content) {
+		if !templates.IsBuiltin(name) {
+			ask = append(ask, name)
+			continue
+		}
+		v, err := templates.Builtin(name)
+		if err != nil {
+			if name == "clipboard" {
+				// No clipboard access (e.g. over SSH): let the user paste it.
+				ask = append(ask, name)
+				continue
+			}
+			ui.Pages.SwitchToPage("chat")
+			ui.appendSystemMsg(fmt.Sprintf("Template %s: {{%s}}: %v", t.Name, name, err))
+			return
+		}
+		values[name] = v
+	}
+	if len(ask) == 0 {
+		ui.Pages.SwitchToPage("chat")
+		ui.insertIntoComposer(templates.Expand(t.Content, values))
+		return
+	}
+
+	form := tview.NewForm()
+	form.SetBorder(true).SetTitle(fmt.Sprintf(" Template: %s ", t.Name)).SetTitleAlign(tview.AlignLeft)
+	for _, name := range ask {
+		form.AddTextArea(name, "", 0, 3, 0, nil)
+	}
+	dismiss := func() {
+		ui.Pages.RemovePage("template-form")
+	}
+	form.AddButton("Insert", func() {
+		for _, name := range ask {
+			values[name] = form.GetFormItemByLabel(name).(*tview.TextArea).GetText()
+		}
+		dismiss()
+		ui.Pages.SwitchToPage("chat")
+		ui.insertIntoComposer(templates.Expand(t.Content, values))
+	})
+	form.AddButton("Cancel", dismiss)
+	form.SetCancelFunc(dismiss)
+
+	height := min(4*len(ask)+5, 30)
+	modal := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
+			AddItem(nil, 0, 1, false).
+			AddItem(form, 80, 1, true).
+			AddItem(nil, 0, 1, false), height, 1, true).
+		AddItem(nil, 0, 1, false)
+	ui.Pages.AddPage("template-form", modal, true, true)
+}
+
+// insertIntoComposer appends text to the input field, keeping its newlines.
+func (ui *TViewUI) insertIntoComposer(text string) {
+	current := ui.InputField.GetText()
+	if current != "" && !strings.HasSuffix(current, "\n") {
+		current += "\n"
+	}
+	ui.isInsertingNewline = strings.Contains(current+text, "\n")
+	ui.InputField.SetText(current + text)
+	ui.App.SetFocus(ui.InputField)
+}
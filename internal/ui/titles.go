@@ -0,0 +1,141 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+const titleInstruction = "Write a short title of at most six words for the conversation below, " +
+	"in the language the user writes in. Reply with the title only, without quotes or trailing punctuation."
+
+// truncateRunes shortens s to at most n runes, ending in "..." when cut.
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n <= 3 {
+		return string(r[:n])
+	}
+	return string(r[:n-3]) + "..."
+}
+
+// fallbackTitle is the title used until (or instead of) a generated one.
+func fallbackTitle(input string) string {
+	return truncateRunes(strings.Join(strings.Fields(input), " "), 30)
+}
+
+// encryptedTitle names new conversations while the store is encrypted:
+// titles are stored in the clear, so they are not taken from the messages.
+const encryptedTitle = "Encrypted chat"
+
+// newTitle returns the title a new conversation that starts with input gets.
+func (ui *TViewUI) newTitle(input string) string {
+	if storage.Encrypted(ui.storage) {
+		return encryptedTitle
+	}
+	return fallbackTitle(input)
+}
+
+// firstExchange reports whether msgs hold exactly one answered question,
+// returning that question.
+func firstExchange(msgs []types.Message) (string, bool) {
+	var question string
+	users, answers := 0, 0
+	for _, m := range msgs {
+		switch m.Role {
+		case openai.ChatMessageRoleUser:
+			if users == 0 {
+				question = m.Content
+			}
+			users++
+		case openai.ChatMessageRoleAssistant:
+			answers++
+		}
+	}
+	return question, users == 1 && answers == 1
+}
+
+// startTitle names the conversation of r after its first exchange, in the
+// background, unless it is renamed meanwhile.
+func (ui *TViewUI) startTitle(r *reply, question, answer string) {
+	if storage.Encrypted(ui.storage) {
+		return
+	}
+	conv, err := ui.storage.GetConversation(r.convID)
+	if err != nil {
+		return
+	}
+	go ui.generateTitle(r, conv.Title, question, answer)
+}
+
+// generateTitle asks the title model to name the conversation of r, replacing
+// the title was. On failure, or when the title is no longer was by the time
+// the answer arrives, the title simply stays.
+func (ui *TViewUI) generateTitle(r *reply, was, question, answer string) {
+	model := r.config.TitleModel
+	if model == "" {
+		model = r.config.Model
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	title, err := r.client.ChatWithModel(ctx, model, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: titleInstruction},
+		{Role: openai.ChatMessageRoleUser, Content: fmt.Sprintf("User: %s\n\nAssistant: %s", truncateRunes(question, 1000), truncateRunes(answer, 1000))},
+	})
+	if err != nil {
+		return
+	}
+	title = strings.TrimSpace(title)
+	if i := strings.IndexByte(title, '\n'); i > 0 {
+		title = title[:i]
+	}
+	title = truncateRunes(strings.Trim(title, "\"'`*#。. "), 60)
+	if title == "" {
+		return
+	}
+	ui.App.QueueUpdateDraw(func() {
+		if conv, err := ui.storage.GetConversation(r.convID); err != nil || conv.Title != was {
+			return
+		}
+		if err := ui.storage.RenameConversation(r.convID, title); err == nil {
+			ui.refreshHistoryIfVisible()
+			ui.reloadTabTitles()
+		}
+	})
+}
+
+func (ui *TViewUI) refreshHistoryIfVisible() {
+	if name, _ := ui.Pages.GetFrontPage(); name == "history" {
+		current := ui.HistoryList.GetCurrentItem()
+		ui.showHistory()
+		if current < ui.HistoryList.GetItemCount() {
+			ui.HistoryList.SetCurrentItem(current)
+		}
+	}
+}
+
+// renameSelected lets the user retitle the conversation selected in the history list.
+func (ui *TViewUI) renameSelected() {
+	c, ok := ui.selectedHistoryConv()
+	if !ok {
+		return
+	}
+	ui.showTextDialog("rename-dialog", " Rename Conversation ", "Title:", c.Title, func(newTitle string) {
+		if newTitle == "" {
+			return
+		}
+		if err := ui.storage.RenameConversation(c.ID, newTitle); err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Rename failed: %v", err))
+			return
+		}
+		ui.refreshHistoryIfVisible()
+		ui.reloadTabTitles()
+	})
+}
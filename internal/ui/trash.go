@@ -0,0 +1,246 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// noticeTimeout is how long a notice, such as the undo notice after a delete, stays.
+const noticeTimeout = 10 * time.Second
+
+func (ui *TViewUI) setupToast() {
+	ui.Toast = tview.NewTextView().SetDynamicColors(true)
+	ui.Toast.SetBackgroundColor(tcell.ColorDarkSlateGray)
+}
+
+// showUndo shows text with an undo hint for noticeTimeout; Ctrl+Z or /undo runs undo meanwhile.
+func (ui *TViewUI) showUndo(text string, undo func()) {
+	ui.showNotice(fmt.Sprintf("%s · [yellow]Ctrl+Z[-] or /undo to undo", text))
+	ui.undo = undo
+}
+
+// showNotice shows text for noticeTimeout. It takes the place of an undo
+// notice, whose delete can then no longer be undone.
+func (ui *TViewUI) showNotice(text string) {
+	ui.undo = nil
+	ui.undoSeq++
+	seq := ui.undoSeq
+	ui.Toast.SetText(" " + text)
+	ui.Root.ResizeItem(ui.Toast, 1, 0)
+	go func() {
+		time.Sleep(noticeTimeout)
+		ui.App.QueueUpdateDraw(func() {
+			if ui.undoSeq == seq {
+				ui.hideUndo()
+			}
+		})
+	}()
+}
+
+func (ui *TViewUI) hideUndo() {
+	ui.undo = nil
+	ui.Toast.SetText("")
+	ui.Root.ResizeItem(ui.Toast, 0, 0)
+}
+
+// runUndo reverts the last delete while its notice is showing.
+func (ui *TViewUI) runUndo() bool {
+	if ui.undo == nil {
+		return false
+	}
+	undo := ui.undo
+	ui.hideUndo()
+	undo()
+	return true
+}
+
+// trashConversations moves conversations to the trash and offers to undo it.
+// The history list's delete and bulk delete both end up here.
+func (ui *TViewUI) trashConversations(ids []string) {
+	if err := ui.storage.DeleteConversations(ids); err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Delete failed: %v", err))
+		return
+	}
+	for _, id := range ids {
+		delete(ui.historyMarked, id)
+		if ui.convID == id {
+			ui.convID = ""
+			ui.messages = []types.Message{}
+			ui.selectedMsg = -1
+			ui.ChatView.Clear()
+		}
+	}
+	ui.closeTabsOf(ids)
+	ui.refreshHistoryIfVisible()
+
+	text := "Moved 1 conversation to the trash"
+	if len(ids) > 1 {
+		text = fmt.Sprintf("Moved %d conversations to the trash", len(ids))
+	}
+	ui.showUndo(text, func() {
+		if err := ui.storage.RestoreConversations(ids); err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Undo failed: %v", err))
+			return
+		}
+		ui.refreshHistoryIfVisible()
+		ui.refreshTrashIfVisible()
+	})
+}
+
+// toggleHistoryMark marks the selected conversation for a bulk delete.
+func (ui *TViewUI) toggleHistoryMark() {
+	c, ok := ui.selectedHistoryConv()
+	if !ok {
+		return
+	}
+	if ui.historyMarked[c.ID] {
+		delete(ui.historyMarked, c.ID)
+	} else {
+		ui.historyMarked[c.ID] = true
+	}
+	idx := ui.HistoryList.GetCurrentItem()
+	ui.HistoryList.SetItemText(idx, ui.historyEntry(c), c.ID)
+	if idx+1 < ui.HistoryList.GetItemCount() {
+		ui.HistoryList.SetCurrentItem(idx + 1)
+	}
+}
+
+// showTrash opens the page listing deleted conversations.
+func (ui *TViewUI) showTrash() {
+	list := tview.NewList()
+	list.SetBorder(true)
+	ui.TrashList = list
+
+	selected := func() (storage.ConvSummary, bool) {
+		idx := list.GetCurrentItem()
+		if idx < 0 || idx >= len(ui.trash) {
+			return storage.ConvSummary{}, false
+		}
+		return ui.trash[idx], true
+	}
+	restore := func() {
+		c, ok := selected()
+		if !ok {
+			return
+		}
+		if err := ui.storage.RestoreConversations([]string{c.ID}); err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Restore failed: %v", err))
+			return
+		}
+		ui.reloadTrash()
+	}
+	purge := func(ids []string, text string) {
+		if len(ids) == 0 {
+			return
+		}
+		modal := tview.NewModal().
+			SetText(text).
+			AddButtons([]string{"Delete Forever", "Cancel"}).
+			SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+				ui.Pages.RemovePage("confirm-purge")
+				ui.App.SetFocus(list)
+				if buttonLabel != "Delete Forever" {
+					return
+				}
+				if err := ui.storage.PurgeConversations(ids); err != nil {
+					ui.appendSystemMsg(fmt.Sprintf("Delete failed: %v", err))
+					return
+				}
+				ui.reloadTrash()
+			})
+		ui.Pages.AddPage("confirm-purge", modal, true, true)
+	}
+	purgeSelected := func() {
+		if c, ok := selected(); ok {
+			purge([]string{c.ID}, fmt.Sprintf("Permanently delete \"%s\"? This cannot be undone.", c.Title))
+		}
+	}
+	emptyTrash := func() {
+		ids := make([]string, len(ui.trash))
+		for i, c := range ui.trash {
+			ids[i] = c.ID
+		}
+		purge(ids, fmt.Sprintf("Permanently delete all %d conversations in the trash? This cannot be undone.", len(ids)))
+	}
+	back := func() { ui.showHistory() }
+
+	list.SetSelectedFunc(func(int, string, string, rune) { restore() })
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEsc:
+			back()
+			return nil
+		case tcell.KeyDelete:
+			purgeSelected()
+			return nil
+		}
+		switch event.Rune() {
+		case 'r':
+			restore()
+		case 'd':
+			purgeSelected()
+		case 'E':
+			emptyTrash()
+		default:
+			return event
+		}
+		return nil
+	})
+
+	bar := tview.NewFlex().SetDirection(tview.FlexColumn)
+	bar.SetBorder(true).SetTitle(" Trash Actions ")
+	bar.AddItem(ui.makeButton("Restore", restore), 0, 1, false)
+	bar.AddItem(ui.makeButton("Delete Forever", purgeSelected), 0, 1, false)
+	bar.AddItem(ui.makeButton("Empty Trash", emptyTrash), 0, 1, false)
+	bar.AddItem(ui.makeButton("Back", back), 0, 1, false)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(list, 0, 1, true).
+		AddItem(tview.NewTextView().SetText(" Enter/r restore  d delete forever  E empty trash  Esc back"), 1, 1, false).
+		AddItem(bar, 3, 1, false)
+
+	ui.reloadTrash()
+	ui.Pages.AddPage("trash", layout, true, true)
+	ui.Pages.SwitchToPage("trash")
+}
+
+func (ui *TViewUI) reloadTrash() {
+	current := ui.TrashList.GetCurrentItem()
+	var err error
+	ui.trash, err = ui.storage.ListTrash()
+	ui.reportListErr(err)
+	ui.TrashList.Clear()
+	title := " Trash "
+	if days := ui.trashRetentionDays(); days > 0 {
+		title = fmt.Sprintf(" Trash (deleted for good after %d days) ", days)
+	}
+	ui.TrashList.SetTitle(title)
+	if len(ui.trash) == 0 {
+		ui.TrashList.AddItem("The trash is empty", "", 0, nil)
+		return
+	}
+	for _, c := range ui.trash {
+		ui.TrashList.AddItem(tview.Escape(c.Title), "deleted "+c.DeletedAt.Local().Format("2006-01-02 15:04"), 0, nil)
+	}
+	if current < len(ui.trash) {
+		ui.TrashList.SetCurrentItem(current)
+	}
+}
+
+func (ui *TViewUI) refreshTrashIfVisible() {
+	if name, _ := ui.Pages.GetFrontPage(); name == "trash" {
+		ui.reloadTrash()
+	}
+}
+
+func (ui *TViewUI) trashRetentionDays() int {
+	if ui.config.TrashRetentionDays == 0 {
+		return types.DefaultTrashRetentionDays
+	}
+	return ui.config.TrashRetentionDays
+}
@@ -1,13 +1,14 @@
 package ui
 
 import (
-	"context"
 	"fmt"
-	"os"
+	"io"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/charmbracelet/glamour"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/sashabaranov/go-openai"
@@ -22,21 +23,54 @@ type TViewUI struct {
 	Pages          *tview.Pages
 	ChatView       *tview.TextView
 	InputField     *tview.InputField
+	AttachmentBar  *tview.TextView
 	HistoryList    *tview.List
 	HistoryPreview *tview.TextView
+	HistoryFilter  *tview.InputField
 	SettingsForm   *tview.Form
+	LastBackupView *tview.TextView
+	PromptList     *tview.List
+	PromptPreview  *tview.TextView
+	CollectionList *tview.List
+	TrashList      *tview.List
+	Toast          *tview.TextView // one-line notice under every page, e.g. to undo a delete
+	TabBar         *tview.TextView // open conversations, above the chat view
+	Root           *tview.Flex
 	
 	// Sidebar components
 	Sidebar      *tview.List
 	MainFlex     *tview.Flex
+	chatFlex     *tview.Flex
+	chatArea     *tview.Flex // the chat view, with comparison columns under it while comparing
 
 	config       types.Config
-	storage      *storage.Manager
+	storage      storage.Store
 	apiClient    *api.Client
-	messages     []openai.ChatCompletionMessage
+	messages     []types.Message
 	convID       string
 	systemPrompt string
-	renderer     *glamour.TermRenderer
+	prompts      []types.SystemPrompt // as listed on the prompt manager page
+	collections  []types.Collection   // as listed on the collections page
+	historyConvs []storage.ConvSummary // as listed on the history page, after filtering
+	historyMarked map[string]bool      // conversations marked for a bulk delete
+	trash        []storage.ConvSummary // as listed on the trash page
+	listErr      string               // last failure to list conversations, reported once
+	collection   string               // ID of the collection this conversation retrieves from, "" when off
+	replies      map[string]*reply    // answers underway, by conversation ID
+	unread       map[string]bool      // conversations with an answer that arrived in the background
+	jobs         int                  // /backup and /index runs using the store in the background
+	spinning     bool                 // the busy spinner is running
+	spinFrame    int
+	tabs         []*tab // open conversations, in tab bar order
+	tab          int    // index of the tab in front
+	compare      *comparison // models answering side by side in one tab, nil when off
+	chunks       chunkCache
+	render       *renderCache
+	renderGen    atomic.Uint64 // bumped on every transcript redraw; stale background passes compare against it
+	screen       tcell.Screen // the screen last drawn on, whose terminal copies go to
+	clipboard    io.Writer    // receives copies instead of the terminal when set, as in tests
+	watchDone    chan struct{} // closed by quit to stop the store watcher; nil when none runs
+	watchStopped chan struct{} // closed once the store watcher has returned
 
 	// Selection state
 	lastClickedIdx int
@@ -46,13 +80,30 @@ type TViewUI struct {
 	isProcessingInput bool
 	isInsertingNewline bool  // Flag to prevent SetChangedFunc from cleaning manual newlines
 
+	// Message selection state: index into messages, -1 when nothing is selected
+	selectedMsg int
+	editingMsg  int // index of the user message being edited and resent, -1 otherwise
+
+	// Messages marked with m in selection mode, by ID, for exporting a selection
+	markedMsgs map[int64]bool
+
+	// Attachments picked for the next message, shown as chips above the composer
+	pendingAttachments []types.Attachment
+
+	// Templates offered while completing "/t ", read once when completion opens
+	completing []types.SystemPrompt
+
+	// Undo for the last delete while its notice is showing; undoSeq tells notices apart
+	undo    func()
+	undoSeq int
+
 	// Input history state
 	inputHistory []string
 	historyIndex int
 	draftInput   string
 }
 
-func NewTViewUI(cfg types.Config, store *storage.Manager) *TViewUI {
+func NewTViewUI(cfg types.Config, store storage.Store) *TViewUI {
 	ui := &TViewUI{
 		App:     tview.NewApplication(),
 		Pages:   tview.NewPages(),
@@ -61,6 +112,12 @@ func NewTViewUI(cfg types.Config, store *storage.Manager) *TViewUI {
 		apiClient: api.NewClient(cfg),
 		lastClickedIdx: -1,
 		historyIndex: -1,
+		selectedMsg: -1,
+		editingMsg: -1,
+		historyMarked: make(map[string]bool),
+		markedMsgs: make(map[int64]bool),
+		replies: make(map[string]*reply),
+		unread: make(map[string]bool),
 	}
 
 	// Theme / styling
@@ -72,32 +129,80 @@ func NewTViewUI(cfg types.Config, store *storage.Manager) *TViewUI {
 	tview.Styles.SecondaryTextColor = tcell.ColorGray
 	tview.Styles.TertiaryTextColor = tcell.ColorLightGray
 
-	ui.renderer, _ = glamour.NewTermRenderer(
-		glamour.WithAutoStyle(),
-		glamour.WithWordWrap(80),
-	)
+	ui.render = newRenderCache(80)
+	if prompt, ok, _ := store.DefaultSystemPrompt(); ok {
+		ui.systemPrompt = prompt
+	}
 
 	ui.setupSidebar()
+	ui.setupTabBar()
 	ui.setupChatView()
+	ui.setupAttachmentBar()
+	ui.setupMessageSelection()
 	ui.setupHistoryView()
 	ui.setupSettingsView()
+	ui.setupToast()
 
 	// Layout main chat with sidebar
 	footer := ui.buildFooterBar()
-	chatFlex := tview.NewFlex().SetDirection(tview.FlexRow).
-		AddItem(ui.ChatView, 0, 1, false).
+	ui.chatArea = tview.NewFlex().SetDirection(tview.FlexRow)
+	ui.layoutChatArea()
+	ui.chatFlex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(ui.TabBar, 1, 0, false).
+		AddItem(ui.chatArea, 0, 1, false).
+		AddItem(ui.AttachmentBar, 0, 0, false).
 		AddItem(ui.InputField, 3, 1, true).
 		AddItem(footer, 3, 1, false)
 
 	ui.MainFlex = tview.NewFlex().SetDirection(tview.FlexColumn).
 		AddItem(ui.Sidebar, 20, 1, false).
-		AddItem(chatFlex, 0, 4, true)
+		AddItem(ui.chatFlex, 0, 4, true)
 
 	ui.Pages.AddPage("chat", ui.MainFlex, true, true)
-	ui.App.SetRoot(ui.Pages, true).EnableMouse(true)
+	ui.Root = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(ui.Pages, 0, 1, true).
+		AddItem(ui.Toast, 0, 0, false)
+	ui.App.SetRoot(ui.Root, true).EnableMouse(true)
+
+	// Re-render the transcript off the UI goroutine when the chat pane is resized.
+	ui.App.SetAfterDrawFunc(func(screen tcell.Screen) {
+		ui.screen = screen
+		_, _, width, _ := ui.ChatView.GetInnerRect()
+		if width > 0 && ui.render.SetWidth(width-2) {
+			go ui.renderInBackground(ui.renderGen.Load(), ui.render.Width(), ui.messageContents())
+		}
+	})
 
 	// Global key handlers
 	ui.App.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Ctrl+C would stop the application without stopping the store watcher
+		if event.Key() == tcell.KeyCtrlC {
+			ui.quit()
+			return nil
+		}
+
+		// Nothing else is reachable until an encrypted database is unlocked
+		if name, _ := ui.Pages.GetFrontPage(); name == "unlock" {
+			return event
+		}
+
+		// Alt+Up/Down enters message selection mode from anywhere on the chat page
+		if event.Modifiers()&tcell.ModAlt != 0 && (event.Key() == tcell.KeyUp || event.Key() == tcell.KeyDown) {
+			if name, _ := ui.Pages.GetFrontPage(); name == "chat" {
+				if event.Key() == tcell.KeyUp {
+					ui.moveSelection(-1)
+				} else {
+					ui.moveSelection(1)
+				}
+				return nil
+			}
+		}
+
+		// Tabs switch and close from anywhere on the chat page
+		if name, _ := ui.Pages.GetFrontPage(); name == "chat" && ui.handleTabKey(event) {
+			return nil
+		}
+
 		// Check if the input field is focused
 		if ui.App.GetFocus() == ui.InputField {
 			if event.Modifiers() == 0 {
@@ -130,11 +235,15 @@ func NewTViewUI(cfg types.Config, store *storage.Manager) *TViewUI {
 		
 		switch event.Key() {
 		case tcell.KeyCtrlN:
-			ui.newConversation()
+			ui.openNewChat()
 			return nil
 		case tcell.KeyCtrlH:
 			ui.showHistory()
 			return nil
+		case tcell.KeyCtrlZ:
+			if ui.runUndo() {
+				return nil
+			}
 		case tcell.KeyCtrlS:
 			ui.showSettings()
 			return nil
@@ -163,16 +272,25 @@ func NewTViewUI(cfg types.Config, store *storage.Manager) *TViewUI {
 		return event
 	})
 
+	// The tabs from last time can only be read once the database is unlocked
+	if storage.Locked(store) {
+		ui.showUnlock(ui.openSavedTabs)
+	} else {
+		ui.openSavedTabs()
+	}
+	ui.refreshTabs()
+
 	return ui
 }
 
 func (ui *TViewUI) setupSidebar() {
 	ui.Sidebar = tview.NewList().
-		AddItem("New Chat", "Start fresh", 'n', ui.newConversation).
+		AddItem("New Chat", "Start fresh", 'n', ui.openNewChat).
 		AddItem("History", "Load past chats", 'h', ui.showHistory).
 		AddItem("Settings", "Config API", 's', ui.showSettings).
 		AddItem("System Prompts", "Change AI role", 'p', ui.showSystemPrompts).
-		AddItem("Quit", "Exit app", 'q', func() { ui.App.Stop() })
+		AddItem("Collections", "Indexed projects", 'c', ui.showCollections).
+		AddItem("Quit", "Exit app", 'q', ui.quit)
 	
 	ui.Sidebar.SetBorder(true).SetTitle(" Menu ")
 	ui.Sidebar.SetTitleColor(tcell.ColorYellow)
@@ -201,11 +319,24 @@ func (ui *TViewUI) setupChatView() {
 			case tcell.KeyDown:
 				ui.navigateHistory(1)
 				return nil
+			case tcell.KeyEsc:
+				if ui.editingMsg >= 0 {
+					ui.setEditing(-1)
+					ui.InputField.SetText("")
+					ui.detach(nil)
+					return nil
+				}
+			case tcell.KeyBackspace, tcell.KeyBackspace2:
+				if ui.InputField.GetText() == "" && len(ui.pendingAttachments) > 0 {
+					ui.detach([]string{fmt.Sprint(len(ui.pendingAttachments))})
+					return nil
+				}
 			}
 		}
 		return event
 	})
-	ui.InputField.SetBorder(true).SetTitle(" Input (Enter to send, Shift+Enter for new line) ")
+	ui.InputField.SetBorder(true)
+	ui.updateInputTitle()
 	ui.InputField.SetTitleColor(tcell.ColorLightSkyBlue)
 	ui.InputField.SetFieldBackgroundColor(tcell.ColorBlack)
 	ui.InputField.SetFieldTextColor(tcell.ColorWhite)
@@ -216,6 +347,7 @@ func (ui *TViewUI) setupChatView() {
 		// If we're manually inserting a newline via Shift+Enter, skip cleaning
 		if ui.isInsertingNewline {
 			ui.isInsertingNewline = false
+			ui.updateInputTitle()
 			return
 		}
 		
@@ -227,15 +359,39 @@ func (ui *TViewUI) setupChatView() {
 			cleanText = strings.ReplaceAll(cleanText, "\r", " ")
 			// Update the field with cleaned text
 			ui.InputField.SetText(cleanText)
+			return
+		}
+		// A "@" starting a word opens the file picker
+		if strings.HasSuffix(text, "@") && !ui.isProcessingInput {
+			if before := strings.TrimSuffix(text, "@"); before == "" || strings.HasSuffix(before, " ") || strings.HasSuffix(before, "\n") {
+				ui.showFilePicker()
+			}
 		}
+		ui.updateInputTitle()
 	})
 
 	// Autocomplete for slash commands
-	commands := []string{"/read", "/clear", "/config", "/save", "/help"}
+	commands := []string{"/read", "/image", "/sh", "/index", "/rag", "/tag", "/trash", "/undo", "/clear", "/config", "/save", "/export", "/import", "/backup", "/restore", "/encrypt", "/decrypt", "/copy", "/write", "/apply", "/context", "/t", "/detach", "/compare", "/pick", "/help"}
 	ui.InputField.SetAutocompleteFunc(func(currentText string) (entries []string) {
+		name, ok := strings.CutPrefix(currentText, "/t ")
+		if !ok {
+			ui.completing = nil
+		}
 		if len(currentText) == 0 || !strings.HasPrefix(currentText, "/") {
 			return nil
 		}
+		if ok {
+			if ui.completing == nil {
+				// Non-nil even when there are none, so they are not read again
+				ui.completing = append([]types.SystemPrompt{}, ui.listTemplates()...)
+			}
+			for _, t := range ui.completing {
+				if strings.HasPrefix(strings.ToLower(t.ID), strings.ToLower(name)) {
+					entries = append(entries, "/t "+t.ID)
+				}
+			}
+			return
+		}
 		for _, cmd := range commands {
 			if strings.HasPrefix(cmd, strings.ToLower(currentText)) {
 				entries = append(entries, cmd)
@@ -258,7 +414,7 @@ func (ui *TViewUI) setupChatView() {
 			}
 			
 			text := ui.InputField.GetText()
-			if text == "" {
+			if text == "" && len(ui.pendingAttachments) == 0 {
 				return
 			}
 			
@@ -282,23 +438,85 @@ func (ui *TViewUI) handleInput(input string) {
 		ui.handleCommand(input)
 		return
 	}
+	if command, ok := strings.CutPrefix(input, "!"); ok {
+		ui.addInputHistory(input)
+		ui.runCommand(command)
+		return
+	}
+	if ui.busy() {
+		ui.InputField.SetText(input)
+		return
+	}
+	attachments := ui.pendingAttachments
+	title := input
+	if title == "" {
+		title = attachments[0].Name
+	}
 
 	ui.addInputHistory(input)
-	ui.messages = append(ui.messages, openai.ChatCompletionMessage{
-		Role:    openai.ChatMessageRoleUser,
-		Content: input,
-	})
+	if ui.editingMsg >= 0 {
+		if !ui.dropMessagesFrom(ui.editingMsg) {
+			ui.InputField.SetText(input)
+			return
+		}
+		ui.setEditing(-1)
+	}
 
 	if ui.convID == "" {
-		title := input
-		if len(title) > 30 { title = title[:27] + "..." }
-		id, _ := ui.storage.CreateConversation(title, ui.config.Model, ui.systemPrompt)
+		id, err := ui.storage.CreateConversation(ui.newTitle(title), ui.config.Model, ui.systemPrompt)
+		if err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Creating the conversation failed: %v", err))
+			ui.InputField.SetText(input)
+			return
+		}
 		ui.convID = id
+		if ui.collection != "" {
+			if err := ui.storage.SetConversationCollection(id, ui.collection); err != nil {
+				ui.appendSystemMsg(fmt.Sprintf("Saving retrieval setting failed: %v", err))
+			}
+		}
+		ui.refreshTabs()
 	}
-	ui.storage.SaveMessage(ui.convID, openai.ChatMessageRoleUser, input)
+	ui.pendingAttachments = nil
+	ui.updateAttachmentBar()
+
+	r := ui.newReply()
+	ui.addReply(r)
+	col, ok := ui.findCollection(ui.collection)
+	if !ok || input == "" {
+		ui.postUserMessage(r, input, attachments)
+		return
+	}
+	// Retrieval may need the embeddings endpoint, so it runs off the UI goroutine.
+	emb, k := ui.embedder(col.Model), ui.retrievalTopK()
+	go func() {
+		excerpts, err := ui.retrieve(emb, k, col, input)
+		ui.App.QueueUpdateDraw(func() {
+			if err != nil {
+				ui.replyNotice(r, fmt.Sprintf("Retrieval failed, sending without context: %v", err))
+			} else if excerpts != nil {
+				attachments = append(attachments, *excerpts)
+			}
+			ui.postUserMessage(r, input, attachments)
+		})
+	}()
+}
 
-	ui.refreshChat()
-	go ui.streamOpenAIResponse()
+// postUserMessage saves a user message to the conversation of r and asks for the reply.
+func (ui *TViewUI) postUserMessage(r *reply, input string, attachments []types.Attachment) {
+	msg, err := ui.storage.AddMessage(r.convID, types.Message{
+		Role:        openai.ChatMessageRoleUser,
+		Content:     input,
+		Attachments: attachments,
+	})
+	if err != nil {
+		ui.replyNotice(r, fmt.Sprintf("Saving message failed: %v", err))
+	}
+	if ui.current(r) {
+		ui.messages = append(ui.messages, msg)
+		ui.refreshChat()
+	}
+	ui.startReply(r)
 }
 
 func (ui *TViewUI) addInputHistory(input string) {
@@ -351,24 +569,45 @@ func (ui *TViewUI) handleCommand(input string) {
 
 	switch cmd {
 	case "/read":
+		ui.readFile(args)
+
+	case "/sh":
+		ui.runCommand(strings.TrimSpace(strings.TrimPrefix(input, "/sh")))
+
+	case "/index":
 		if len(args) == 0 {
-			ui.appendSystemMsg("Usage: /read <path>")
+			ui.showCollections()
 			return
 		}
-		filePath := args[0]
-		content, err := os.ReadFile(filePath)
-		if err != nil {
-			ui.appendSystemMsg(fmt.Sprintf("Error reading file: %v", err))
+		ui.indexDir(strings.Join(args, " "))
+
+	case "/rag":
+		ui.handleRagCommand(args)
+
+	case "/tag":
+		ui.handleTagCommand(args)
+
+	case "/trash":
+		ui.showTrash()
+
+	case "/undo":
+		if !ui.runUndo() {
+			ui.appendSystemMsg("Nothing to undo.")
+		}
+
+	case "/image":
+		if len(args) == 0 {
+			ui.appendSystemMsg("Usage: /image <path>")
 			return
 		}
-		ui.messages = append(ui.messages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
-			Content: fmt.Sprintf("Content of file %s:\n\n%s", filePath, string(content)),
-		})
-		ui.refreshChat()
+		name := strings.Join(args, " ")
+		if err := ui.attachImage(name, filepath.Base(name)); err != nil {
+			ui.appendSystemMsg(fmt.Sprintf("Error reading image: %v", err))
+		}
 
 	case "/clear":
-		ui.messages = []openai.ChatCompletionMessage{}
+		ui.messages = []types.Message{}
+		ui.selectedMsg = -1
 		ui.ChatView.Clear()
 		ui.refreshChat()
 		ui.appendSystemMsg("Chat display cleared.")
@@ -382,108 +621,189 @@ func (ui *TViewUI) handleCommand(input string) {
 		if len(args) > 0 {
 			filename = args[0]
 		}
-		ui.exportToFile(filename)
+		ui.exportCurrent(filename)
 
 	case "/export":
+		if len(args) > 0 && args[0] == "all" {
+			ui.exportAll(strings.Join(args[1:], " "))
+			return
+		}
 		filename := fmt.Sprintf("qa_export_%d.md", time.Now().Unix())
 		if len(args) > 0 {
 			filename = args[0]
 		}
-		ui.exportToFile(filename)
+		ui.exportCurrent(filename)
+
+	case "/import":
+		ui.importConversations(args)
+
+	case "/backup":
+		ui.backupNow()
+
+	case "/restore":
+		ui.handleRestoreCommand(args)
+
+	case "/encrypt":
+		ui.encryptDatabase()
+
+	case "/decrypt":
+		ui.decryptDatabase()
+
+	case "/copy":
+		ui.copyCodeBlock(args)
+
+	case "/write":
+		ui.writeCodeBlock(args)
+
+	case "/apply":
+		ui.applyCodeBlock(args)
+
+	case "/context":
+		ui.showContext()
+
+	case "/t":
+		ui.handleTemplateCommand(args)
+
+	case "/detach":
+		ui.detach(args)
+
+	case "/compare":
+		ui.handleCompareCommand(args)
+
+	case "/pick":
+		ui.pickAnswer(args)
 
 	case "/help":
-		ui.appendSystemMsg("Commands:\n/read <path> - Import file\n/clear - Clear screen\n/config - Show current config\n/save [path] - Save to file\n/export [path] - Export Q&A to file\n/help - Show this help")
+		ui.appendSystemMsg("Commands:\n/read <path>[:from-to] - Attach a file or some of its lines\n/image <path> - Attach an image (PNG, JPEG, GIF) for vision models\n!<command>, /sh <command> - Run a command and attach its output\n/index [dir] - Index a directory for retrieval, or list collections\n/rag [name|off] - Retrieve from a collection in this chat\n/tag [name|-name]... - Show, add or remove tags of this chat\n/trash - Restore or permanently delete deleted chats\n/undo - Undo the last delete (also Ctrl+Z)\n/clear - Clear screen\n/config - Show current config\n/save [path] - Save to file\n/export [path] - Export Q&A to file, or JSON/HTML/text for a .json/.jsonl/.html/.txt path\n/export all [path] - Export all chats, as JSON unless the extension says otherwise\n/import <path> [skip|duplicate|overwrite] - Import chats from JSON, JSONL or ChatGPT's conversations.json\n/backup - Back up the database now\n/restore [path] - Restore the database from a backup\n/encrypt - Encrypt messages, attachments and indexes with a passphrase (titles, tags and prompts stay readable)\n/decrypt - Store them unencrypted again\n/copy <N> - Copy code block N\n/write <N> [path] - Save code block N to a file\n/apply <N> - Apply code block N as a patch\n/context - Show which messages the next request sends\n/t [name] - List or insert a prompt template\n/t import [dir] - Import templates from a directory\n@ - Attach a file or directory\n/detach [N] - Remove pending attachment N, or all\n/compare <model|profile>... - Send each question to several models side by side\n/compare off - Stop comparing\n/pick <N> - Keep answer N of a comparison\n/help - Show this help")
 
 	default:
 		ui.appendSystemMsg(fmt.Sprintf("Unknown command: %s. Type /help for list.", cmd))
 	}
 }
 
-func (ui *TViewUI) exportToFile(filename string) {
+func (ui *TViewUI) refreshChat() {
+	ui.redrawChat(true)
+}
+
+// redrawChat rebuilds the transcript. Messages near the bottom are rendered
+// right away; older ones come from the render cache or are shown as plain text
+// and handed to a background pass, which redraws again once it is done.
+func (ui *TViewUI) redrawChat(scrollToEnd bool) {
+	gen := ui.renderGen.Add(1)
+	width := ui.render.Width()
+	_, _, _, height := ui.ChatView.GetInnerRect()
+
+	contents := ui.messageContents()
+	plan := ui.planContext(nil)
+
+	// Find the first message that falls within renderWindow screens of the end.
+	near, lines := len(contents), 0
+	for near > 0 && lines < height*renderWindow {
+		near--
+		lines += estimateLines(contents[near], width)
+	}
+
 	var sb strings.Builder
+	var pending []string
 	if ui.systemPrompt != "" {
-		sb.WriteString(fmt.Sprintf("> System Prompt: %s\n\n", ui.systemPrompt))
+		fmt.Fprintf(&sb, "[gray][i]System Prompt: %s[-][/i]\n\n", tview.Escape(ui.systemPrompt))
 	}
-	for _, msg := range ui.messages {
-		roleLabel := strings.ToUpper(msg.Role)
-		if msg.Role == "user" {
-			roleLabel = "Q"
-		} else if msg.Role == "assistant" {
-			roleLabel = "A"
-		}
-		sb.WriteString(fmt.Sprintf("## %s: %s\n\n---\n\n", roleLabel, msg.Content))
+	for i, m := range ui.messages {
+		roleColor := "purple"
+		if m.Role == openai.ChatMessageRoleAssistant { roleColor = "green" }
+		if m.Role == openai.ChatMessageRoleSystem { roleColor = "yellow" }
+
+		fmt.Fprintf(&sb, "[\"%s\"][%s][b]%s[-][/b]", msgRegion(i), roleColor, strings.ToUpper(m.Role))
+		if m.Pinned {
+			sb.WriteString(" [yellow](pinned)[-]")
+		}
+		if m.ID != 0 && ui.markedMsgs[m.ID] {
+			sb.WriteString(" [green](marked)[-]")
+		}
+		if m.Summarized {
+			sb.WriteString(" [gray](summarized, not sent)[-]")
+		} else if !plan.Included[i] {
+			sb.WriteString(" [gray](not sent)[-]")
+		}
+		sb.WriteString("\n")
+		if len(m.Attachments) > 0 {
+			sb.WriteString(attachmentChips(m.Attachments) + "\n")
+		}
+		rendered, ok := ui.render.Lookup(contents[i])
+		if !ok {
+			if i >= near || i == ui.selectedMsg {
+				rendered = ui.render.Render(contents[i], width)
+			} else {
+				rendered = tview.Escape(contents[i])
+				pending = append(pending, contents[i])
+			}
+		}
+		fmt.Fprintf(&sb, "%s[\"\"]\n\n", rendered)
 	}
-	err := os.WriteFile(filename, []byte(sb.String()), 0644)
-	if err != nil {
-		ui.appendSystemMsg(fmt.Sprintf("Save failed: %v", err))
-	} else {
-		ui.appendSystemMsg("History saved to " + filename)
+	if r := ui.replies[ui.convID]; r != nil && r.streaming {
+		sb.WriteString(r.streamedText())
 	}
-}
 
-func (ui *TViewUI) streamOpenAIResponse() {
-	ctx := context.Background()
-	var sendMsgs []openai.ChatCompletionMessage
-	if ui.systemPrompt != "" {
-		sendMsgs = append(sendMsgs, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleSystem,
-			Content: ui.systemPrompt,
-		})
+	row, col := ui.ChatView.GetScrollOffset()
+	ui.ChatView.SetText(sb.String())
+	if ui.selectedMsg >= 0 {
+		ui.ChatView.Highlight(msgRegion(ui.selectedMsg))
+		if scrollToEnd {
+			ui.ChatView.ScrollToHighlight()
+		} else {
+			ui.ChatView.ScrollTo(row, col)
+		}
+	} else if scrollToEnd {
+		ui.ChatView.ScrollToEnd()
+	} else {
+		ui.ChatView.ScrollTo(row, col)
 	}
-	sendMsgs = append(sendMsgs, ui.messages...)
-
-	stream, err := ui.apiClient.StreamChat(ctx, sendMsgs)
-	if err != nil {
-		ui.App.QueueUpdateDraw(func() {
-			ui.appendSystemMsg(fmt.Sprintf("API Error: %v", err))
-		})
-		return
+	if len(pending) > 0 {
+		go ui.renderInBackground(gen, width, pending)
 	}
-	defer stream.Close()
+	ui.updateInputTitle()
+}
 
-	var fullResponse strings.Builder
+// renderInBackground fills the render cache for contents and redraws the
+// transcript, unless another redraw has happened in the meantime.
+func (ui *TViewUI) renderInBackground(gen uint64, width int, contents []string) {
+	for _, c := range contents {
+		if ui.renderGen.Load() != gen {
+			return
+		}
+		ui.render.Render(c, width)
+	}
 	ui.App.QueueUpdateDraw(func() {
-		fmt.Fprintf(ui.ChatView, "\n[green][b]ASSISTANT[-][/b]\n")
+		if ui.renderGen.Load() == gen && ui.render.Width() == width {
+			ui.redrawChat(false)
+		}
 	})
+}
 
-	for {
-		response, err := stream.Recv()
-		if err != nil {
-			break
-		}
-		content := response.Choices[0].Delta.Content
-		if content != "" {
-			fullResponse.WriteString(content)
-			ui.App.QueueUpdateDraw(func() {
-				fmt.Fprint(ui.ChatView, content)
-			})
+// messageContents returns the markdown displayed for each message, with the
+// code blocks of assistant replies numbered for /copy, /write and /apply.
+func (ui *TViewUI) messageContents() []string {
+	contents := make([]string, len(ui.messages))
+	next := 1
+	for i, m := range ui.messages {
+		contents[i] = m.Content
+		if m.Role == openai.ChatMessageRoleAssistant {
+			contents[i], next = numberCodeBlocks(m.Content, next)
 		}
 	}
-
-	ui.App.QueueUpdateDraw(func() {
-		ui.messages = append(ui.messages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleAssistant,
-			Content: fullResponse.String(),
-		})
-		ui.storage.SaveMessage(ui.convID, openai.ChatMessageRoleAssistant, fullResponse.String())
-		ui.refreshChat()
-	})
+	return contents
 }
 
-func (ui *TViewUI) refreshChat() {
-	ui.ChatView.Clear()
-	if ui.systemPrompt != "" {
-		fmt.Fprintf(ui.ChatView, "[gray][i]System Prompt: %s[-][/i]\n\n", ui.systemPrompt)
+// estimateLines guesses how many screen lines content takes once wrapped.
+func estimateLines(content string, width int) int {
+	if width <= 0 {
+		width = 80
 	}
-	for _, m := range ui.messages {
-		roleColor := "purple"
-		if m.Role == openai.ChatMessageRoleAssistant { roleColor = "green" }
-		
-		fmt.Fprintf(ui.ChatView, "[%s][b]%s[-][/b]\n", roleColor, strings.ToUpper(m.Role))
-		rendered, _ := ui.renderer.Render(m.Content)
-		fmt.Fprintf(ui.ChatView, "%s\n\n", tview.TranslateANSI(rendered))
+	lines := 0
+	for _, l := range strings.Split(content, "\n") {
+		lines += len(l)/width + 1
 	}
-	ui.ChatView.ScrollToEnd()
+	return lines + 2
 }
 
 func (ui *TViewUI) appendSystemMsg(msg string) {
@@ -499,18 +819,42 @@ func (ui *TViewUI) setupHistoryView() {
 	// Custom Mouse Handling to distinguish Click from Double-Click
 	ui.HistoryList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyEsc {
+			clear(ui.historyMarked)
 			ui.Pages.SwitchToPage("chat")
 			return nil
 		}
 		if event.Key() == tcell.KeyDelete || event.Rune() == 'd' {
-			ui.confirmDeleteSelected()
+			ui.deleteSelectedConversations()
+			return nil
+		}
+		switch event.Rune() {
+		case ' ':
+			ui.toggleHistoryMark()
+			return nil
+		case 'T':
+			ui.showTrash()
+			return nil
+		case 'r':
+			ui.renameSelected()
+			return nil
+		case 't':
+			ui.editTagsSelected()
+			return nil
+		case 'f':
+			ui.editFolderSelected()
+			return nil
+		case 'p':
+			ui.togglePinConversation()
+			return nil
+		case '/':
+			ui.App.SetFocus(ui.HistoryFilter)
 			return nil
 		}
 		if event.Key() == tcell.KeyEnter {
 			// Keyboard Enter always activates
 			idx := ui.HistoryList.GetCurrentItem()
 			_, secondary := ui.HistoryList.GetItemText(idx)
-			ui.loadConversation(secondary)
+			ui.openConversation(secondary)
 			return nil
 		}
 		return event
@@ -526,7 +870,7 @@ func (ui *TViewUI) setupHistoryView() {
 
 		if index == ui.lastClickedIdx && now.Sub(ui.lastClickedTime) < 800*time.Millisecond {
 			// Double click detected
-			ui.loadConversation(id)
+			ui.openConversation(id)
 			ui.lastClickedIdx = -1 // Reset
 		} else {
 			ui.lastClickedIdx = index
@@ -537,6 +881,9 @@ func (ui *TViewUI) setupHistoryView() {
 	ui.HistoryList.SetChangedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
 		ui.HistoryPreview.Clear()
 		if secondaryText == "" { return }
+		if c, ok := ui.selectedHistoryConv(); ok && !c.UpdatedAt.IsZero() {
+			fmt.Fprintf(ui.HistoryPreview, "[gray]Last active %s[-]\n\n", c.UpdatedAt.Local().Format("2006-01-02 15:04"))
+		}
 		msgs, _ := ui.storage.GetMessages(secondaryText)
 		if len(msgs) == 0 {
 			fmt.Fprintf(ui.HistoryPreview, "[gray]No messages in this conversation.[-]")
@@ -547,8 +894,7 @@ func (ui *TViewUI) setupHistoryView() {
 			roleColor := "purple"
 			if m.Role == openai.ChatMessageRoleAssistant { roleColor = "green" }
 			fmt.Fprintf(ui.HistoryPreview, "[%s][b]%s[-][/b]\n", roleColor, strings.ToUpper(m.Role))
-			summary := m.Content
-			if len(summary) > 200 { summary = summary[:197] + "..." }
+			summary := truncateRunes(m.Content, 200)
 			fmt.Fprintf(ui.HistoryPreview, "%s\n\n", summary)
 		}
 	})
@@ -558,8 +904,22 @@ func (ui *TViewUI) setupHistoryView() {
 		SetWordWrap(true)
 	ui.HistoryPreview.SetBorder(true).SetTitle(" Preview ")
 
+	ui.HistoryFilter = tview.NewInputField().
+		SetLabel("Filter: ").
+		SetPlaceholder("title words, #tag, folder:name")
+	ui.HistoryFilter.SetFieldBackgroundColor(tcell.ColorBlack)
+	ui.HistoryFilter.SetChangedFunc(func(string) { ui.reloadHistory() })
+	ui.HistoryFilter.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEsc {
+			ui.HistoryFilter.SetText("")
+		}
+		ui.App.SetFocus(ui.HistoryList)
+	})
+
 	historyFlex := tview.NewFlex().SetDirection(tview.FlexColumn).
-		AddItem(ui.HistoryList, 35, 1, true).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(ui.HistoryFilter, 1, 0, false).
+			AddItem(ui.HistoryList, 0, 1, true), 45, 1, true).
 		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
 			AddItem(ui.HistoryPreview, 0, 1, false).
 			AddItem(ui.buildHistoryBar(), 3, 1, false), 0, 2, false)
@@ -570,80 +930,100 @@ func (ui *TViewUI) setupHistoryView() {
 func (ui *TViewUI) loadConversation(id string) {
 	if id == "" { return }
 	ui.convID = id
+	if ui.unread[id] {
+		delete(ui.unread, id)
+		ui.updateBadges()
+	}
 	conv, _ := ui.storage.GetConversation(ui.convID)
 	ui.systemPrompt = conv.SystemPrompt
-	ui.messages, _ = ui.storage.GetMessages(ui.convID)
+	ui.collection = conv.Collection
+	msgs, err := ui.storage.ListMessages(ui.convID)
+	ui.messages = msgs
+	ui.selectedMsg = -1
+	clear(ui.markedMsgs)
+	ui.setEditing(-1)
 	ui.refreshChat()
+	if err != nil {
+		ui.appendSystemMsg(fmt.Sprintf("Loading messages failed: %v", err))
+	}
+	ui.refreshTabs()
 	ui.Pages.SwitchToPage("chat")
 }
 
 func (ui *TViewUI) showHistory() {
-	ui.HistoryList.Clear()
-	ui.HistoryPreview.Clear()
-	ui.lastClickedIdx = -1 // Reset click state
-	convs, _ := ui.storage.ListConversations()
-	if len(convs) == 0 {
-		ui.HistoryList.AddItem("No history yet", "", 0, nil)
-	} else {
-		for _, c := range convs {
-			ui.HistoryList.AddItem(c.Title, c.ID, 0, nil)
-		}
-	}
+	ui.reloadHistory()
 	ui.Pages.SwitchToPage("history")
 }
 
-func (ui *TViewUI) showSystemPrompts() {
-	prompts, _ := ui.storage.ListSystemPrompts()
-	list := tview.NewList()
-	for _, p := range prompts {
-		pCopy := p
-		list.AddItem(p.Name, p.Content, 0, func() {
-			ui.systemPrompt = pCopy.Content
-			ui.appendSystemMsg(fmt.Sprintf("System prompt set to: %s", pCopy.Name))
-			ui.Pages.SwitchToPage("chat")
-		})
-	}
-	list.AddItem("Cancel", "", 'c', func() { ui.Pages.SwitchToPage("chat") })
-	list.SetBorder(true).SetTitle(" Select System Prompt ")
-	ui.Pages.AddPage("system_prompts", list, true, true)
-	ui.Pages.SwitchToPage("system_prompts")
-}
-
 func (ui *TViewUI) setupSettingsView() {
+	strategies := []string{types.ContextDrop, types.ContextSummarize}
+	strategyIdx := 0
+	if ui.config.ContextStrategy == types.ContextSummarize {
+		strategyIdx = 1
+	}
+	contextLimit := ""
+	if n, ok := ui.config.ContextLimits[ui.config.Model]; ok {
+		contextLimit = strconv.Itoa(n)
+	}
 	ui.SettingsForm = tview.NewForm().
 		AddInputField("API Key", ui.config.APIKey, 40, nil, nil).
 		AddInputField("Base URL", ui.config.BaseURL, 40, nil, nil).
 		AddInputField("Model", ui.config.Model, 40, nil, nil).
+		AddDropDown("Context Strategy", strategies, strategyIdx, nil).
+		AddInputField("Context Limit (blank = auto)", contextLimit, 10, tview.InputFieldInteger, nil).
+		AddInputField("Export Directory", ui.config.ExportDir, 40, nil, nil).
+		AddTextView("Last Backup", ui.lastBackupText(), 50, 1, false, false).
 		AddButton("Save", func() {
 			ui.config.APIKey = ui.SettingsForm.GetFormItem(0).(*tview.InputField).GetText()
 			ui.config.BaseURL = ui.SettingsForm.GetFormItem(1).(*tview.InputField).GetText()
 			ui.config.Model = ui.SettingsForm.GetFormItem(2).(*tview.InputField).GetText()
+			_, ui.config.ContextStrategy = ui.SettingsForm.GetFormItem(3).(*tview.DropDown).GetCurrentOption()
+			if n, err := strconv.Atoi(ui.SettingsForm.GetFormItem(4).(*tview.InputField).GetText()); err == nil && n > 0 {
+				if ui.config.ContextLimits == nil {
+					ui.config.ContextLimits = make(map[string]int)
+				}
+				ui.config.ContextLimits[ui.config.Model] = n
+			} else {
+				delete(ui.config.ContextLimits, ui.config.Model)
+			}
+			ui.config.ExportDir = strings.TrimSpace(ui.SettingsForm.GetFormItem(5).(*tview.InputField).GetText())
 			config.SaveConfig(ui.config)
 			ui.apiClient = api.NewClient(ui.config)
+			ui.updateInputTitle()
 			ui.Pages.SwitchToPage("chat")
 		}).
 		AddButton("Cancel", func() {
 			ui.Pages.SwitchToPage("chat")
 		})
+	ui.LastBackupView = ui.SettingsForm.GetFormItemByLabel("Last Backup").(*tview.TextView)
 	ui.SettingsForm.SetBorder(true).SetTitle(" Settings ")
 	ui.Pages.AddPage("settings", ui.SettingsForm, true, false)
 }
 
 func (ui *TViewUI) showSettings() {
+	ui.LastBackupView.SetText(ui.lastBackupText())
 	ui.Pages.SwitchToPage("settings")
 }
 
 func (ui *TViewUI) newConversation() {
-	ui.messages = []openai.ChatCompletionMessage{}
+	ui.messages = []types.Message{}
 	ui.convID = ""
+	ui.collection = ""
+	ui.selectedMsg = -1
+	clear(ui.markedMsgs)
+	ui.setEditing(-1)
+	if prompt, ok, _ := ui.storage.DefaultSystemPrompt(); ok {
+		ui.systemPrompt = prompt
+	}
 	ui.ChatView.Clear()
+	ui.refreshTabs()
 	ui.Pages.SwitchToPage("chat")
 	ui.appendSystemMsg(fmt.Sprintf("New conversation started. (Prompt: %s)", ui.systemPrompt))
 }
 
 func (ui *TViewUI) exportHistory() {
 	filename := fmt.Sprintf("chat_export_%d.md", time.Now().Unix())
-	ui.exportToFile(filename)
+	ui.exportCurrent(filename)
 }
 
 func (ui *TViewUI) makeButton(label string, action func()) *tview.Button {
@@ -659,20 +1039,28 @@ func (ui *TViewUI) makeButton(label string, action func()) *tview.Button {
 func (ui *TViewUI) buildFooterBar() *tview.Flex {
 	bar := tview.NewFlex().SetDirection(tview.FlexColumn)
 	bar.SetBorder(true).SetTitle(" Actions ")
-	bar.AddItem(ui.makeButton("New", ui.newConversation), 0, 1, false)
+	bar.AddItem(ui.makeButton("New", ui.openNewChat), 0, 1, false)
 	bar.AddItem(ui.makeButton("History", ui.showHistory), 0, 1, false)
 	bar.AddItem(ui.makeButton("Export", ui.exportHistory), 0, 1, false)
 	bar.AddItem(ui.makeButton("Prompts", ui.showSystemPrompts), 0, 1, false)
 	bar.AddItem(ui.makeButton("Settings", ui.showSettings), 0, 1, false)
-	bar.AddItem(ui.makeButton("Quit", func() { ui.App.Stop() }), 0, 1, false)
+	bar.AddItem(ui.makeButton("Quit", ui.quit), 0, 1, false)
 	return bar
 }
 
 func (ui *TViewUI) buildHistoryBar() *tview.Flex {
 	bar := tview.NewFlex().SetDirection(tview.FlexColumn)
 	bar.SetBorder(true).SetTitle(" History Actions ")
-	bar.AddItem(ui.makeButton("Delete", ui.confirmDeleteSelected), 0, 1, false)
-	bar.AddItem(ui.makeButton("Back", func() { ui.Pages.SwitchToPage("chat") }), 0, 1, false)
+	bar.AddItem(ui.makeButton("Rename", ui.renameSelected), 0, 1, false)
+	bar.AddItem(ui.makeButton("Tags", ui.editTagsSelected), 0, 1, false)
+	bar.AddItem(ui.makeButton("Folder", ui.editFolderSelected), 0, 1, false)
+	bar.AddItem(ui.makeButton("Pin", ui.togglePinConversation), 0, 1, false)
+	bar.AddItem(ui.makeButton("Delete", ui.deleteSelectedConversations), 0, 1, false)
+	bar.AddItem(ui.makeButton("Trash", ui.showTrash), 0, 1, false)
+	bar.AddItem(ui.makeButton("Back", func() {
+		clear(ui.historyMarked)
+		ui.Pages.SwitchToPage("chat")
+	}), 0, 1, false)
 	return bar
 }
 
@@ -683,70 +1071,33 @@ func (ui *TViewUI) getSelectedHistoryID() (string, bool) {
 	return convID, convID != ""
 }
 
-func (ui *TViewUI) confirmDeleteSelected() {
-	convID, ok := ui.getSelectedHistoryID()
-	if !ok { return }
-
-	modal := tview.NewModal().
-		SetText("Delete this conversation?").
-		AddButtons([]string{"Delete", "Cancel"}).
-		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
-			ui.Pages.RemovePage("confirm-delete")
-			if buttonLabel == "Delete" {
-				if err := ui.storage.DeleteConversation(convID); err != nil {
-					ui.appendSystemMsg(fmt.Sprintf("Delete failed: %v", err))
-				} else if ui.convID == convID {
-					ui.convID = ""
-					ui.messages = []openai.ChatCompletionMessage{}
-					ui.ChatView.Clear()
-				}
-				ui.showHistory()
-			}
-		})
-
-	ui.Pages.AddPage("confirm-delete", modal, true, true)
-}
-
-func (ui *TViewUI) showExportDialog() {
-	// Create a form for export options
-	form := tview.NewForm()
-	form.SetBorder(true).SetTitle(" Export Options ").SetTitleAlign(tview.AlignLeft)
-
-	var filename string
-	defaultFilename := fmt.Sprintf("qa_export_%d.md", time.Now().Unix())
-
-	form.AddInputField("Filename:", defaultFilename, 50, nil, func(text string) {
-		filename = text
-	})
-
-	form.AddButton("Export", func() {
-		if filename == "" {
-			filename = defaultFilename
+// deleteSelectedConversations moves the conversations marked with Space to the trash, or
+// the selected one when none are marked.
+func (ui *TViewUI) deleteSelectedConversations() {
+	var ids []string
+	for _, c := range ui.historyConvs {
+		if ui.historyMarked[c.ID] {
+			ids = append(ids, c.ID)
 		}
-		ui.exportToFile(filename)
-		ui.Pages.RemovePage("export-dialog")
-	})
-
-	form.AddButton("Cancel", func() {
-		ui.Pages.RemovePage("export-dialog")
-	})
-
-	form.SetCancelFunc(func() {
-		ui.Pages.RemovePage("export-dialog")
-	})
-
-	// Create a modal-like container
-	modal := tview.NewFlex().SetDirection(tview.FlexRow).
-		AddItem(nil, 0, 1, false).
-		AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
-			AddItem(nil, 0, 1, false).
-			AddItem(form, 60, 1, true).
-			AddItem(nil, 0, 1, false), 8, 1, true).
-		AddItem(nil, 0, 1, false)
-
-	ui.Pages.AddPage("export-dialog", modal, true, true)
+	}
+	if len(ids) == 0 {
+		convID, ok := ui.getSelectedHistoryID()
+		if !ok { return }
+		ids = []string{convID}
+	}
+	ui.trashConversations(ids)
 }
 
 func (ui *TViewUI) Run() error {
-	return ui.App.Run()
+	ui.startWatch()
+	err := ui.App.Run()
+	if ui.watchDone != nil {
+		// Stopped by a terminal error rather than quit.
+		close(ui.watchDone)
+		ui.watchDone = nil
+	}
+	if err != nil {
+		return err
+	}
+	return ui.saveTabs()
 }
@@ -0,0 +1,134 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/evallife/chat-tui/internal/storage"
+	"github.com/evallife/chat-tui/internal/types"
+)
+
+// startUI runs a UI on a simulated screen with a files store in a temporary
+// directory, talking to the API at baseURL. It is stopped when the test ends,
+// or earlier by calling stop.
+func startUI(t *testing.T, baseURL string) (ui *TViewUI, stop func()) {
+	t.Helper()
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return startUIWith(t, baseURL, store)
+}
+
+// startUIWith is startUI with the given store.
+func startUIWith(t *testing.T, baseURL string, store storage.Store) (ui *TViewUI, stop func()) {
+	t.Helper()
+	ui = newUI(t, baseURL, store)
+	stop, _ = runUI(t, ui)
+	return ui, stop
+}
+
+// newUI returns a UI on a simulated screen, not running yet.
+func newUI(t *testing.T, baseURL string, store storage.Store) *TViewUI {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	ui := NewTViewUI(types.Config{BaseURL: baseURL, APIKey: "test", Model: "gpt-4o"}, store)
+	sim := tcell.NewSimulationScreen("")
+	if err := sim.Init(); err != nil {
+		t.Fatal(err)
+	}
+	sim.SetSize(120, 40)
+	ui.App.SetScreen(sim)
+	return ui
+}
+
+// runUI runs ui's application until stop is called, or until it stops by
+// itself as stopped reports; stop must not be called then.
+func runUI(t *testing.T, ui *TViewUI) (stop func(), stopped <-chan struct{}) {
+	t.Helper()
+	ran := make(chan struct{})
+	go func() {
+		defer close(ran)
+		if err := ui.App.Run(); err != nil {
+			t.Error(err)
+		}
+	}()
+	stop = sync.OnceFunc(func() {
+		ui.App.Stop()
+		<-ran
+	})
+	t.Cleanup(func() {
+		select {
+		case <-ran:
+		default:
+			stop()
+		}
+	})
+	do(ui, func() {}) // running before it can be stopped
+	return stop, ran
+}
+
+// do runs f on the UI goroutine and waits for it.
+func do(ui *TViewUI, f func()) {
+	done := make(chan struct{})
+	ui.App.QueueUpdateDraw(func() {
+		f()
+		close(done)
+	})
+	<-done
+}
+
+// fakeAPI serves chat completions. A streamed answer is "Hello " and, once
+// release is closed, "from <model>"; other requests are answered with a title.
+func fakeAPI(t *testing.T, release <-chan struct{}) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !req.Stream {
+			fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"A title"}}]}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunk := func(content string) {
+			data, _ := json.Marshal(content)
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%s}}]}\n\n", data)
+			w.(http.Flusher).Flush()
+		}
+		chunk("Hello ")
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		chunk("from " + req.Model)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// waitFor polls cond on the UI goroutine until it holds.
+func waitFor(t *testing.T, ui *TViewUI, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var ok bool
+		do(ui, func() { ok = cond() })
+		if ok {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
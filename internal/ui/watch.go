@@ -0,0 +1,76 @@
+package ui
+
+import (
+	"time"
+
+	"github.com/evallife/chat-tui/internal/storage"
+)
+
+// watchInterval is how often the store is asked whether another chat-tui
+// instance has written to it.
+const watchInterval = 2 * time.Second
+
+// startWatch runs watchStore until quit stops it.
+func (ui *TViewUI) startWatch() {
+	done, stopped := make(chan struct{}), make(chan struct{})
+	ui.watchDone, ui.watchStopped = done, stopped
+	go func() {
+		defer close(stopped)
+		ui.watchStore(done)
+	}()
+}
+
+// quit stops the application. A running store watcher is stopped and waited
+// for first: it waits for the updates it queues, which a stopped application
+// no longer runs. The wait happens off the UI goroutine, which still has to
+// run the update the watcher may be waiting for.
+func (ui *TViewUI) quit() {
+	if ui.watchDone == nil {
+		ui.App.Stop()
+		return
+	}
+	close(ui.watchDone)
+	ui.watchDone = nil
+	stopped := ui.watchStopped
+	go func() {
+		<-stopped
+		ui.App.Stop()
+	}()
+}
+
+// watchStore refreshes the history, trash and collections pages and the tab
+// titles when the store changes underneath us, until done is closed. Changed
+// is called on the UI goroutine so that it never overlaps a restore reopening
+// the database.
+func (ui *TViewUI) watchStore(done <-chan struct{}) {
+	w, ok := ui.storage.(storage.WatchedStore)
+	if !ok {
+		return
+	}
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		ui.App.QueueUpdate(func() {
+			if changed, _ := w.Changed(); !changed {
+				return
+			}
+			// Another instance may have encrypted the database.
+			if storage.Locked(ui.storage) && !ui.Pages.HasPage("unlock") {
+				ui.showUnlock(func() {
+					ui.stashTab()
+					ui.restoreTab()
+				})
+			}
+			ui.refreshHistoryIfVisible()
+			ui.refreshTrashIfVisible()
+			ui.refreshCollectionsIfVisible()
+			ui.reloadTabTitles()
+			ui.App.ForceDraw()
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package ui
+
+import (
+	"testing"
+	"time"
+
+	"github.com/evallife/chat-tui/internal/storage"
+)
+
+// TestQuitStopsWatcher quits while the store watcher is running: the watcher
+// has to return before the application stops, rather than wait forever for
+// an update that no longer runs.
+func TestQuitStopsWatcher(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ui := newUI(t, "http://127.0.0.1:0", store)
+	_, ran := runUI(t, ui)
+	var watched chan struct{}
+	do(ui, func() {
+		ui.startWatch()
+		watched = ui.watchStopped
+	})
+	// Let it queue an update or two first.
+	time.Sleep(watchInterval + 500*time.Millisecond)
+	do(ui, ui.quit)
+	for what, stopped := range map[string]<-chan struct{}{"watchStore": watched, "the application": ran} {
+		select {
+		case <-stopped:
+		case <-time.After(watchInterval + time.Second):
+			t.Fatalf("%s still running after quit", what)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+// Package workspace lists and reads files of the working tree for attaching
+// them to messages.
+package workspace
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// MaxFileSize is the largest single file that is attached.
+	MaxFileSize = 256 << 10
+	// MaxReadSize is the largest file /read attaches when asked to go over
+	// MaxFileSize.
+	MaxReadSize = 8 << 20
+	// MaxDirFiles and MaxDirSize bound what a directory expands to.
+	MaxDirFiles = 50
+	MaxDirSize  = 512 << 10
+	// MaxImageSize is the largest image that is attached.
+	MaxImageSize = 20 << 20
+)
+
+// List returns the files under root relative to it, slash separated, followed
+// by the directories containing them (with a trailing slash). Ignored files are
+// left out: git decides inside a repository, otherwise the top-level .gitignore
+// is applied.
+func List(root string) ([]string, error) {
+	files, err := gitFiles(root)
+	if err != nil {
+		files, err = walkFiles(root)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, f := range files {
+		for d := path.Dir(f); d != "." && !seen[d]; d = path.Dir(d) {
+			seen[d] = true
+			dirs = append(dirs, d+"/")
+		}
+	}
+	sort.Strings(dirs)
+	return append(files, dirs...), nil
+}
+
+func gitFiles(root string) ([]string, error) {
+	cmd := exec.Command("git", "ls-files", "--cached", "--others", "--exclude-standard", "-z")
+	cmd.Dir = root
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range strings.Split(string(out), "\x00") {
+		if f == "" {
+			continue
+		}
+		// Deleted but still tracked files are listed too.
+		if _, err := os.Stat(filepath.Join(root, f)); err == nil {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func walkFiles(root string) ([]string, error) {
+	ignore := readIgnore(filepath.Join(root, ".gitignore"))
+	var files []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if d.Name() == ".git" || ignored(ignore, rel, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && !ignored(ignore, rel, false) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files, err
+}
+
+func readIgnore(name string) []string {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var patterns []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// ignored covers the common .gitignore forms: globs on the base name, paths
+// anchored with a slash, and directory-only patterns ending in a slash.
+func ignored(patterns []string, rel string, isDir bool) bool {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "/") {
+			if !isDir {
+				continue
+			}
+			p = strings.TrimSuffix(p, "/")
+		}
+		if strings.Contains(strings.TrimPrefix(p, "/"), "/") || strings.HasPrefix(p, "/") {
+			if ok, _ := path.Match(strings.TrimPrefix(p, "/"), rel); ok {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(p, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBinary reports whether data looks like something other than text.
+func IsBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// ErrTooLarge is returned for files, or line ranges, beyond the size limit.
+var ErrTooLarge = errors.New("too large")
+
+// ReadText reads a text file, refusing binary and oversized files.
+func ReadText(name string) (string, error) {
+	return ReadTextLimit(name, MaxFileSize)
+}
+
+// ReadTextLimit is ReadText with a size limit of limit bytes, or none when
+// limit <= 0.
+func ReadTextLimit(name string, limit int64) (string, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", name)
+	}
+	if limit > 0 && info.Size() > limit {
+		return "", fmt.Errorf("%s is %w (%s, limit %s)", name, ErrTooLarge, FormatSize(info.Size()), FormatSize(limit))
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	if IsBinary(data) {
+		return "", fmt.Errorf("%s is a binary file", name)
+	}
+	return string(data), nil
+}
+
+// File is a text file read from the working tree.
+type File struct {
+	Path    string
+	Content string
+}
+
+// ErrEmptyDir is returned when a directory has no attachable files.
+var ErrEmptyDir = errors.New("no text files")
+
+// ExpandDir reads the listed files below dir (as returned by List) up to the
+// directory limits. Skipped reports files left out because they are binary or
+// beyond the limits.
+func ExpandDir(root, dir string, listing []string) (files []File, skipped int, err error) {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	total := 0
+	for _, rel := range listing {
+		if strings.HasSuffix(rel, "/") || !strings.HasPrefix(rel, prefix) {
+			continue
+		}
+		if len(files) >= MaxDirFiles {
+			skipped++
+			continue
+		}
+		content, err := ReadText(filepath.Join(root, filepath.FromSlash(rel)))
+		if err != nil || total+len(content) > MaxDirSize {
+			skipped++
+			continue
+		}
+		total += len(content)
+		files = append(files, File{Path: rel, Content: content})
+	}
+	if len(files) == 0 {
+		return nil, skipped, fmt.Errorf("%s: %w", dir, ErrEmptyDir)
+	}
+	return files, skipped, nil
+}
+
+// FormatSize renders a byte count for display, e.g. "12.3 KB".
+func FormatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// ReadRange reads lines from through to (1-based, inclusive) of a text file;
+// to <= 0 means up to the end. Only the selected part counts against MaxFileSize.
+func ReadRange(name string, from, to int) (string, error) {
+	return ReadRangeLimit(name, from, to, MaxFileSize)
+}
+
+// ReadRangeLimit is ReadRange with a size limit of limit bytes, or none when
+// limit <= 0.
+func ReadRangeLimit(name string, from, to int, limit int64) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 8000)
+	head, _ := r.Peek(8000)
+	if IsBinary(head) {
+		return "", fmt.Errorf("%s is a binary file", name)
+	}
+	var sb strings.Builder
+	for n := 1; to <= 0 || n <= to; n++ {
+		line, err := r.ReadString('\n')
+		if n >= from {
+			sb.WriteString(line)
+			if limit > 0 && int64(sb.Len()) > limit {
+				return "", fmt.Errorf("%s: lines %d-%d are %w (limit %s)", name, from, to, ErrTooLarge, FormatSize(limit))
+			}
+		}
+		if err != nil {
+			if n < from {
+				if line == "" {
+					n--
+				}
+				return "", fmt.Errorf("%s has only %d lines", name, n)
+			}
+			break
+		}
+	}
+	return sb.String(), nil
+}
+
+// imageTypes are the image formats that can be attached.
+var imageTypes = map[string]bool{"image/png": true, "image/jpeg": true, "image/gif": true}
+
+// IsImage reports whether name has the extension of a supported image format.
+func IsImage(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif":
+		return true
+	}
+	return false
+}
+
+// Image is an image file read for attaching.
+type Image struct {
+	MIME          string
+	Data          []byte
+	Width, Height int
+}
+
+// ReadImage reads a PNG, JPEG or GIF file and its dimensions.
+func ReadImage(name string) (Image, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return Image{}, err
+	}
+	if info.Size() > MaxImageSize {
+		return Image{}, fmt.Errorf("%s is too large (%s, limit %s)", name, FormatSize(info.Size()), FormatSize(MaxImageSize))
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return Image{}, err
+	}
+	mime := http.DetectContentType(data)
+	if !imageTypes[mime] {
+		return Image{}, fmt.Errorf("%s is not a PNG, JPEG or GIF image (%s)", name, mime)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, fmt.Errorf("%s: %w", name, err)
+	}
+	return Image{MIME: mime, Data: data, Width: cfg.Width, Height: cfg.Height}, nil
+}